@@ -0,0 +1,221 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Drone Non-Commercial License
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/docker/docker/pkg/term"
+
+	"github.com/drone/drone-runtime/engine"
+	"github.com/drone/drone-runtime/runtime"
+)
+
+const debugUsage = `
+Debug commands:
+  s, shell      opens a shell in a copy of the step container
+  r, rerun      re-runs the step with a different command,
+                and passes the step if the command succeeds
+  c, continue   continues the pipeline
+  a, abort      aborts the pipeline`
+
+// debugger pauses the pipeline when a step fails, and lets
+// the user debug the failed step before the pipeline
+// continues.
+type debugger struct {
+	mu      sync.Mutex
+	engine  engine.Engine
+	spec    *engine.Spec
+	shell   string
+	console *console
+	out     io.Writer
+	cancel  context.CancelFunc
+}
+
+// debug prompts the user for debug commands until the user
+// continues or aborts the pipeline. It returns the step
+// state, which is the state of the last successful re-run
+// of the step, if any.
+func (d *debugger) debug(ctx context.Context, state *runtime.State) *engine.State {
+	// steps may fail concurrently, in which case the
+	// failed steps are debugged one at a time.
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	result := state.State
+	name := state.Step.Metadata.Name
+	if result.OOMKilled {
+		fmt.Fprintf(d.out, "\ndebug: step %s received an oom kill\n", name)
+	} else {
+		fmt.Fprintf(d.out, "\ndebug: step %s failed with exit code %d\n", name, result.ExitCode)
+	}
+	fmt.Fprintln(d.out, debugUsage)
+
+	for {
+		fmt.Fprintf(d.out, "debug %s> ", name)
+		line, err := d.console.readLine(ctx)
+		if err != nil {
+			fmt.Fprintln(d.out)
+			d.cancel()
+			return result
+		}
+		switch strings.TrimSpace(line) {
+		case "s", "shell":
+			d.exec(ctx, state.Step, []string{d.shell}, true)
+		case "r", "rerun":
+			fmt.Fprint(d.out, "command> ")
+			command, err := d.console.readLine(ctx)
+			if err != nil || strings.TrimSpace(command) == "" {
+				continue
+			}
+			rerun := d.exec(ctx, state.Step, []string{"/bin/sh", "-c", command}, false)
+			if rerun != nil && rerun.ExitCode == 0 {
+				fmt.Fprintf(d.out, "debug: step %s passed, continue to resume the pipeline\n", name)
+				result = rerun
+			}
+		case "c", "continue":
+			return result
+		case "a", "abort":
+			d.cancel()
+			return result
+		case "":
+		default:
+			fmt.Fprintln(d.out, debugUsage)
+		}
+	}
+}
+
+// helper function executes the command in a copy of the
+// step container, attached to the terminal.
+func (d *debugger) exec(ctx context.Context, step *engine.Step, command []string, interactive bool) *engine.State {
+	execer, ok := d.engine.(engine.Execer)
+	if !ok {
+		fmt.Fprintln(d.out, "debug: the engine does not support executing commands")
+		return nil
+	}
+
+	opts := &engine.ExecOptions{
+		Command: command,
+		Stdout:  os.Stdout,
+		Stderr:  os.Stderr,
+	}
+	if interactive {
+		done := make(chan struct{})
+		defer close(done)
+		opts.Stdin = d.console.reader(done)
+
+		// if stdin is a terminal, the terminal is placed
+		// in raw mode and a pseudo-terminal is allocated.
+		if fd, ok := term.GetFdInfo(os.Stdin); ok {
+			restore, err := term.MakeRaw(fd)
+			if err == nil {
+				defer term.RestoreTerminal(fd, restore)
+				opts.TTY = true
+				if size, err := term.GetWinsize(fd); err == nil {
+					opts.Height = uint(size.Height)
+					opts.Width = uint(size.Width)
+				}
+			}
+		}
+	}
+
+	state, err := execer.Exec(ctx, d.spec, step, opts)
+	if err != nil {
+		fmt.Fprintf(d.out, "\r\ndebug: %s\n", err)
+		return nil
+	}
+	if state.ExitCode != 0 {
+		fmt.Fprintf(d.out, "\r\ndebug: exit code %d\n", state.ExitCode)
+	}
+	return state
+}
+
+// console shares stdin between the debug prompt and the
+// commands executed in the step container. Stdin is read
+// by a single goroutine, since a blocked read cannot be
+// cancelled when the command exits.
+type console struct {
+	data    chan []byte
+	pending []byte
+}
+
+func newConsole(r io.Reader) *console {
+	c := &console{data: make(chan []byte)}
+	go func() {
+		for {
+			buf := make([]byte, 1024)
+			n, err := r.Read(buf)
+			if n > 0 {
+				c.data <- buf[:n]
+			}
+			if err != nil {
+				close(c.data)
+				return
+			}
+		}
+	}()
+	return c
+}
+
+// readLine reads the next line from stdin.
+func (c *console) readLine(ctx context.Context) (string, error) {
+	for {
+		if i := bytes.IndexByte(c.pending, '\n'); i != -1 {
+			line := string(c.pending[:i])
+			c.pending = c.pending[i+1:]
+			return line, nil
+		}
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case data, ok := <-c.data:
+			if !ok {
+				return "", io.EOF
+			}
+			c.pending = append(c.pending, data...)
+		}
+	}
+}
+
+// reader returns a reader that reads from stdin until the
+// done channel is closed.
+func (c *console) reader(done <-chan struct{}) io.Reader {
+	var pending []byte
+	return readerFunc(func(p []byte) (int, error) {
+		if len(pending) == 0 {
+			select {
+			case <-done:
+				return 0, io.EOF
+			case data, ok := <-c.data:
+				if !ok {
+					return 0, io.EOF
+				}
+				pending = data
+			}
+		}
+		n := copy(p, pending)
+		pending = pending[n:]
+		return n, nil
+	})
+}
+
+// readerFunc implements io.Reader.
+type readerFunc func([]byte) (int, error)
+
+func (fn readerFunc) Read(p []byte) (int, error) {
+	return fn(p)
+}
+
+// errStdinSource is returned when debug or watch mode is
+// requested and the pipeline specification is read from
+// stdin.
+var errStdinSource = errors.New("debug and watch mode cannot read the pipeline specification from stdin")
@@ -15,20 +15,23 @@
 package docker
 
 import (
+	"sort"
 	"strings"
 
 	"github.com/drone/drone-runtime/engine"
 
+	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/mount"
 	"github.com/docker/docker/api/types/network"
+	"github.com/docker/go-units"
 )
 
 // returns a container configuration.
 func toConfig(spec *engine.Spec, step *engine.Step) *container.Config {
 	config := &container.Config{
 		Image:        step.Docker.Image,
-		Labels:       step.Metadata.Labels,
+		Labels:       toLabels(spec, step),
 		WorkingDir:   step.WorkingDir,
 		User:         step.Docker.User,
 		AttachStdin:  false,
@@ -109,6 +112,20 @@ func toHostConfig(spec *engine.Spec, step *engine.Step) *container.HostConfig {
 		}
 	}
 
+	// windows does not support linux security options
+	// so we only apply these values to linux containers.
+	if spec.Platform.OS != "windows" {
+		config.CapAdd = step.Docker.CapAdd
+		config.CapDrop = step.Docker.CapDrop
+		config.ReadonlyRootfs = step.Docker.ReadOnlyRootfs
+		config.SecurityOpt = toSecurityOpts(step)
+		config.Resources.Ulimits = toUlimits(step)
+		config.UsernsMode = container.UsernsMode(step.Docker.UsernsMode)
+		if len(step.Docker.Sysctls) > 0 {
+			config.Sysctls = step.Docker.Sysctls
+		}
+	}
+
 	if len(step.Volumes) != 0 {
 		config.Devices = toDeviceSlice(spec, step)
 		config.Binds = toVolumeSlice(spec, step)
@@ -134,6 +151,120 @@ func toNetConfig(spec *engine.Spec, proc *engine.Step) *network.NetworkingConfig
 	}
 }
 
+// helper function returns the network configuration for
+// the user-defined pipeline network.
+func toNetworkCreate(spec *engine.Spec, net *engine.Network) types.NetworkCreate {
+	to := types.NetworkCreate{
+		Driver:   net.Driver,
+		Internal: net.Internal,
+		Labels:   spec.Metadata.Labels,
+	}
+	if to.Driver == "" {
+		to.Driver = "bridge"
+		if spec.Platform.OS == "windows" {
+			to.Driver = "nat"
+		}
+	}
+	if net.Subnet != "" {
+		to.IPAM = &network.IPAM{
+			Config: []network.IPAMConfig{{
+				Subnet:  net.Subnet,
+				Gateway: net.Gateway,
+			}},
+		}
+	}
+	return to
+}
+
+// helper function returns the additional user-defined
+// network endpoints for the container, keyed by network.
+func toEndpoints(spec *engine.Spec, step *engine.Step) map[string]*network.EndpointSettings {
+	endpoints := map[string]*network.EndpointSettings{}
+	for _, name := range step.Docker.Networks {
+		endpoints[toNetworkID(spec, name)] = &network.EndpointSettings{
+			Aliases: []string{name},
+		}
+	}
+	for _, endpoint := range step.Docker.Endpoints {
+		aliases := endpoint.Aliases
+		if len(aliases) == 0 {
+			aliases = []string{step.Metadata.Name}
+		}
+		settings := &network.EndpointSettings{
+			Aliases: aliases,
+		}
+		if endpoint.IPv4Address != "" || endpoint.IPv6Address != "" {
+			settings.IPAMConfig = &network.EndpointIPAMConfig{
+				IPv4Address: endpoint.IPv4Address,
+				IPv6Address: endpoint.IPv6Address,
+			}
+		}
+		endpoints[toNetworkID(spec, endpoint.Network)] = settings
+	}
+	return endpoints
+}
+
+// helper function returns the names of the networks to
+// which the step is attached, in the order they are
+// defined in the step.
+func toNetworkNames(step *engine.Step) []string {
+	var names []string
+	seen := map[string]bool{}
+	for _, name := range step.Docker.Networks {
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	for _, endpoint := range step.Docker.Endpoints {
+		if !seen[endpoint.Network] {
+			seen[endpoint.Network] = true
+			names = append(names, endpoint.Network)
+		}
+	}
+	return names
+}
+
+// helper function returns the network identifier. If the
+// network is defined by the pipeline, the unique network
+// identifier is returned, else the name is returned as-is
+// to support attaching to existing networks.
+func toNetworkID(spec *engine.Spec, name string) string {
+	if net, ok := engine.LookupNetwork(spec, name); ok {
+		return net.Metadata.UID
+	}
+	return name
+}
+
+// helper function returns the container security options.
+func toSecurityOpts(step *engine.Step) []string {
+	var opts []string
+	if step.Docker.NoNewPrivileges {
+		opts = append(opts, "no-new-privileges")
+	}
+	if step.Docker.SeccompProfile != "" {
+		opts = append(opts, "seccomp="+step.Docker.SeccompProfile)
+	}
+	if step.Docker.ApparmorProfile != "" {
+		opts = append(opts, "apparmor="+step.Docker.ApparmorProfile)
+	}
+	return opts
+}
+
+// helper function that converts a slice of ulimits to a
+// slice of docker ulimits.
+func toUlimits(step *engine.Step) []*units.Ulimit {
+	var to []*units.Ulimit
+	for _, ulimit := range step.Docker.Ulimits {
+		to = append(to, &units.Ulimit{
+			Name: ulimit.Name,
+			Soft: ulimit.Soft,
+			Hard: ulimit.Hard,
+		})
+	}
+	return to
+}
+
 // helper function that converts a slice of device paths to a slice of
 // container.DeviceMapping.
 func toDeviceSlice(spec *engine.Spec, step *engine.Step) []container.DeviceMapping {
@@ -270,6 +401,23 @@ func toVolumeType(from *engine.Volume) mount.Type {
 	}
 }
 
+// helper function returns the container labels. The
+// pipeline labels are included so that containers can be
+// located and pruned using the pipeline labels.
+func toLabels(spec *engine.Spec, step *engine.Step) map[string]string {
+	if len(spec.Metadata.Labels) == 0 {
+		return step.Metadata.Labels
+	}
+	labels := map[string]string{}
+	for k, v := range spec.Metadata.Labels {
+		labels[k] = v
+	}
+	for k, v := range step.Metadata.Labels {
+		labels[k] = v
+	}
+	return labels
+}
+
 // helper function that converts a key value map of
 // environment variables to a string slice in key=value
 // format.
@@ -278,6 +426,9 @@ func toEnv(env map[string]string) []string {
 	for k, v := range env {
 		envs = append(envs, k+"="+v)
 	}
+	// sort the variables to ensure the container
+	// configuration is deterministic.
+	sort.Strings(envs)
 	return envs
 }
 
@@ -10,9 +10,11 @@ import (
 
 	"github.com/drone/drone-runtime/engine"
 
+	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/mount"
 	"github.com/docker/docker/api/types/network"
+	"github.com/docker/go-units"
 
 	"github.com/google/go-cmp/cmp"
 )
@@ -157,6 +159,73 @@ func TestToHostConfig(t *testing.T) {
 	}
 }
 
+func TestToHostConfigSecurity(t *testing.T) {
+	step := &engine.Step{
+		Metadata: engine.Metadata{
+			UID:  "123",
+			Name: "test",
+		},
+		Docker: &engine.DockerStep{
+			Image:           "golang:latest",
+			CapAdd:          []string{"NET_ADMIN"},
+			CapDrop:         []string{"ALL"},
+			ReadOnlyRootfs:  true,
+			NoNewPrivileges: true,
+			SeccompProfile:  "unconfined",
+			ApparmorProfile: "drone-default",
+			UsernsMode:      "host",
+			Ulimits: []*engine.Ulimit{
+				{Name: "nofile", Soft: 1024, Hard: 2048},
+			},
+			Sysctls: map[string]string{
+				"net.ipv4.ip_forward": "1",
+			},
+		},
+	}
+	spec := &engine.Spec{
+		Metadata: engine.Metadata{
+			UID: "abc123",
+		},
+		Steps: []*engine.Step{step},
+	}
+	a := &container.HostConfig{
+		LogConfig: container.LogConfig{
+			Type: "json-file",
+		},
+		CapAdd:         []string{"NET_ADMIN"},
+		CapDrop:        []string{"ALL"},
+		ReadonlyRootfs: true,
+		SecurityOpt: []string{
+			"no-new-privileges",
+			"seccomp=unconfined",
+			"apparmor=drone-default",
+		},
+		UsernsMode: "host",
+		Sysctls: map[string]string{
+			"net.ipv4.ip_forward": "1",
+		},
+		Resources: container.Resources{
+			Ulimits: []*units.Ulimit{
+				{Name: "nofile", Soft: 1024, Hard: 2048},
+			},
+		},
+	}
+	b := toHostConfig(spec, step)
+	if diff := cmp.Diff(a, b); diff != "" {
+		t.Errorf("Unexpected container.HostConfig")
+		t.Log(diff)
+	}
+
+	// windows does not support linux security options
+	// and we therefore expect these values are ignored.
+
+	spec.Platform.OS = "windows"
+	b = toHostConfig(spec, step)
+	if len(b.CapAdd) != 0 || len(b.SecurityOpt) != 0 || b.ReadonlyRootfs {
+		t.Errorf("Expect security options ignored on windows")
+	}
+}
+
 func TestToNetConfig(t *testing.T) {
 	step := &engine.Step{
 		Docker: &engine.DockerStep{},
@@ -184,6 +253,82 @@ func TestToNetConfig(t *testing.T) {
 	}
 }
 
+func TestToEndpoints(t *testing.T) {
+	step := &engine.Step{
+		Metadata: engine.Metadata{
+			Name: "redis",
+		},
+		Docker: &engine.DockerStep{
+			Networks: []string{"external"},
+			Endpoints: []*engine.Endpoint{
+				{Network: "backend"},
+				{Network: "frontend", Aliases: []string{"cache"}, IPv4Address: "10.0.0.10"},
+			},
+		},
+	}
+	spec := &engine.Spec{
+		Steps: []*engine.Step{step},
+		Docker: &engine.DockerConfig{
+			Networks: []*engine.Network{
+				{Metadata: engine.Metadata{Name: "backend", UID: "uid_backend"}},
+				{Metadata: engine.Metadata{Name: "frontend", UID: "uid_frontend"}},
+			},
+		},
+	}
+	a := toEndpoints(spec, step)
+	b := map[string]*network.EndpointSettings{
+		"external": {
+			Aliases: []string{"external"},
+		},
+		"uid_backend": {
+			Aliases: []string{"redis"},
+		},
+		"uid_frontend": {
+			Aliases: []string{"cache"},
+			IPAMConfig: &network.EndpointIPAMConfig{
+				IPv4Address: "10.0.0.10",
+			},
+		},
+	}
+	if diff := cmp.Diff(a, b); diff != "" {
+		t.Errorf("Unexpected network endpoints")
+		t.Log(diff)
+	}
+}
+
+func TestToNetworkCreate(t *testing.T) {
+	spec := &engine.Spec{
+		Metadata: engine.Metadata{
+			Labels: map[string]string{"io.drone": "true"},
+		},
+	}
+	net := &engine.Network{
+		Internal: true,
+		Subnet:   "10.0.0.0/24",
+		Gateway:  "10.0.0.1",
+	}
+	a := toNetworkCreate(spec, net)
+	b := types.NetworkCreate{
+		Driver:   "bridge",
+		Internal: true,
+		Labels:   spec.Metadata.Labels,
+		IPAM: &network.IPAM{
+			Config: []network.IPAMConfig{
+				{Subnet: "10.0.0.0/24", Gateway: "10.0.0.1"},
+			},
+		},
+	}
+	if diff := cmp.Diff(a, b); diff != "" {
+		t.Errorf("Unexpected network configuration")
+		t.Log(diff)
+	}
+
+	spec.Platform.OS = "windows"
+	if got, want := toNetworkCreate(spec, net).Driver, "nat"; got != want {
+		t.Errorf("Want network driver %q, got %q", want, got)
+	}
+}
+
 func TestToVolumeSlice(t *testing.T) {
 	step := &engine.Step{
 		Volumes: []*engine.VolumeMount{
@@ -21,15 +21,23 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"time"
 
 	"github.com/drone/drone-runtime/engine"
 	"github.com/drone/drone-runtime/engine/docker/auth"
 	"github.com/drone/drone-runtime/engine/docker/stdcopy"
 
 	"github.com/docker/docker/api/types"
-	"github.com/docker/docker/api/types/network"
 	"github.com/docker/docker/api/types/volume"
 	"github.com/docker/docker/client"
+	"github.com/docker/docker/errdefs"
+)
+
+// the number of attempts and backoff duration used when a
+// resource cannot be removed because it is in use.
+var (
+	removeAttempts = 5
+	removeBackoff  = time.Second
 )
 
 type dockerEngine struct {
@@ -93,8 +101,21 @@ func (e *dockerEngine) Setup(ctx context.Context, spec *engine.Spec) error {
 		Driver: driver,
 		Labels: spec.Metadata.Labels,
 	})
+	if err != nil {
+		return err
+	}
 
-	return err
+	// creates the additional user-defined networks. Steps
+	// are attached to these networks by name.
+	if spec.Docker != nil {
+		for _, net := range spec.Docker.Networks {
+			_, err := e.client.NetworkCreate(ctx, net.Metadata.UID, toNetworkCreate(spec, net))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
 }
 
 func (e *dockerEngine) Create(ctx context.Context, spec *engine.Spec, step *engine.Step) error {
@@ -105,7 +126,7 @@ func (e *dockerEngine) Create(ctx context.Context, spec *engine.Spec, step *engi
 	// parse the docker image name. We need to extract the
 	// image domain name and match to registry credentials
 	// stored in the .docker/config.json object.
-	_, domain, latest, err := parseImage(step.Docker.Image)
+	_, domain, _, err := engine.ParseImage(step.Docker.Image)
 	if err != nil {
 		return err
 	}
@@ -119,22 +140,27 @@ func (e *dockerEngine) Create(ctx context.Context, spec *engine.Spec, step *engi
 
 	// automatically pull the latest version of the image if requested
 	// by the process configuration.
-	if step.Docker.PullPolicy == engine.PullAlways ||
-		(step.Docker.PullPolicy == engine.PullDefault && latest) {
-		// TODO(bradrydzewski) implement the PullDefault strategy to pull
-		// the image if the tag is :latest
-		rc, perr := e.client.ImagePull(ctx, step.Docker.Image, pullopts)
-		if perr == nil {
-			io.Copy(ioutil.Discard, rc)
-			rc.Close()
+	if engine.ShouldPull(step) {
+		if err := e.pull(ctx, step.Docker.Image, pullopts); err != nil {
+			return err
 		}
-		if perr != nil {
-			return perr
+	}
+
+	// verify the image matches the expected digest before
+	// the container is created. The container is created
+	// from the verified image identifier, and not the tag,
+	// in case the tag is moved to a different image.
+	config := toConfig(spec, step)
+	if digest := engine.ImageDigest(step); digest != "" {
+		id, err := e.verify(ctx, step, digest, pullopts)
+		if err != nil {
+			return err
 		}
+		config.Image = id
 	}
 
 	_, err = e.client.ContainerCreate(ctx,
-		toConfig(spec, step),
+		config,
 		toHostConfig(spec, step),
 		toNetConfig(spec, step),
 		step.Metadata.UID,
@@ -143,17 +169,14 @@ func (e *dockerEngine) Create(ctx context.Context, spec *engine.Spec, step *engi
 	// automatically pull and try to re-create the image if the
 	// failure is caused because the image does not exist.
 	if client.IsErrNotFound(err) && step.Docker.PullPolicy != engine.PullNever {
-		rc, perr := e.client.ImagePull(ctx, step.Docker.Image, pullopts)
-		if perr != nil {
-			return perr
+		if err := e.pull(ctx, step.Docker.Image, pullopts); err != nil {
+			return err
 		}
-		io.Copy(ioutil.Discard, rc)
-		rc.Close()
 
 		// once the image is successfully pulled we attempt to
 		// re-create the container.
 		_, err = e.client.ContainerCreate(ctx,
-			toConfig(spec, step),
+			config,
 			toHostConfig(spec, step),
 			toNetConfig(spec, step),
 			step.Metadata.UID,
@@ -179,16 +202,20 @@ func (e *dockerEngine) Create(ctx context.Context, spec *engine.Spec, step *engi
 		}
 	}
 
-	// use the default user-defined network if network_mode
-	// is not otherwise specified.
-	// QUESTION: is this even used?
+	// attach the container to additional user-defined
+	// networks if network_mode is not otherwise specified.
+	// Networks are attached in the order they are defined.
 	if step.Docker.Network == "" {
-		for _, net := range step.Docker.Networks {
-			err = e.client.NetworkConnect(ctx, net, step.Metadata.UID, &network.EndpointSettings{
-				Aliases: []string{net},
-			})
+		endpoints := toEndpoints(spec, step)
+		for _, name := range toNetworkNames(step) {
+			id := toNetworkID(spec, name)
+			err = e.client.NetworkConnect(ctx, id, step.Metadata.UID, endpoints[id])
 			if err != nil {
-				return nil
+				return &NetworkError{
+					Name:    step.Metadata.Name,
+					Network: name,
+					Err:     err,
+				}
 			}
 		}
 	}
@@ -196,31 +223,116 @@ func (e *dockerEngine) Create(ctx context.Context, spec *engine.Spec, step *engi
 	return nil
 }
 
+// helper function pulls the image.
+func (e *dockerEngine) pull(ctx context.Context, image string, opts types.ImagePullOptions) error {
+	rc, err := e.client.ImagePull(ctx, image, opts)
+	if err != nil {
+		return err
+	}
+	io.Copy(ioutil.Discard, rc)
+	rc.Close()
+	return nil
+}
+
+// helper function verifies the local image matches the
+// digest, and returns the image identifier. If the image
+// does not exist it is pulled, unless the pull policy is
+// set to never.
+func (e *dockerEngine) verify(ctx context.Context, step *engine.Step, digest string, opts types.ImagePullOptions) (string, error) {
+	info, _, err := e.client.ImageInspectWithRaw(ctx, step.Docker.Image)
+	if client.IsErrNotFound(err) && step.Docker.PullPolicy != engine.PullNever {
+		if err := e.pull(ctx, step.Docker.Image, opts); err != nil {
+			return "", err
+		}
+		info, _, err = e.client.ImageInspectWithRaw(ctx, step.Docker.Image)
+	}
+	if err != nil {
+		return "", err
+	}
+	if !matchDigest(info, digest) {
+		return "", &DigestError{
+			Name:   step.Metadata.Name,
+			Image:  step.Docker.Image,
+			Digest: digest,
+		}
+	}
+	return info.ID, nil
+}
+
 func (e *dockerEngine) Start(ctx context.Context, spec *engine.Spec, step *engine.Step) error {
 	return e.client.ContainerStart(ctx, step.Metadata.UID, types.ContainerStartOptions{})
 }
 
 func (e *dockerEngine) Wait(ctx context.Context, spec *engine.Spec, step *engine.Step) (*engine.State, error) {
-	wait, errc := e.client.ContainerWait(ctx, step.Metadata.UID, "")
-	select {
-	case <-wait:
-	case <-errc:
+	for {
+		wait, errc := e.client.ContainerWait(ctx, step.Metadata.UID, "")
+		select {
+		case res := <-wait:
+			if res.Error != nil && res.Error.Message != "" {
+				return nil, errors.New(res.Error.Message)
+			}
+		case err := <-errc:
+			// the error channel receives the context error
+			// when the context is cancelled, which is
+			// handled below. Any other error indicates the
+			// connection to the daemon failed.
+			if ctx.Err() == nil {
+				return nil, err
+			}
+		case <-ctx.Done():
+		}
+
+		if err := ctx.Err(); err != nil {
+			// note that we use a new context to kill the
+			// container since the current context is in a
+			// canceled state.
+			e.client.ContainerKill(context.Background(), step.Metadata.UID, "9")
+			return nil, err
+		}
+
+		info, err := e.client.ContainerInspect(ctx, step.Metadata.UID)
+		if err != nil {
+			return nil, err
+		}
+
+		// the wait request may return before the container
+		// exits (for example, if the container is restarted)
+		// in which case we need to wait again.
+		if info.State.Running {
+			continue
+		}
+
+		state := &engine.State{
+			Exited:    true,
+			ExitCode:  info.State.ExitCode,
+			OOMKilled: info.State.OOMKilled,
+			Error:     info.State.Error,
+		}
+		if t, err := time.Parse(time.RFC3339Nano, info.State.FinishedAt); err == nil {
+			state.Finished = t.Unix()
+		}
+		// resolve the digest of the image used to create the
+		// container, which can be used to record exactly
+		// which image was executed.
+		if image, _, err := e.client.ImageInspectWithRaw(ctx, info.Image); err == nil {
+			state.Digest = resolveDigest(image, step.Docker.Image)
+		}
+		return state, nil
 	}
+}
 
+// Digest returns the digest of the image used to create
+// the step container.
+func (e *dockerEngine) Digest(ctx context.Context, spec *engine.Spec, step *engine.Step) (string, error) {
 	info, err := e.client.ContainerInspect(ctx, step.Metadata.UID)
 	if err != nil {
-		return nil, err
+		return "", err
 	}
-	if info.State.Running {
-		// TODO(bradrydewski) if the state is still running
-		// we should call wait again.
+	image, _, err := e.client.ImageInspectWithRaw(ctx, info.Image)
+	if err != nil {
+		return "", err
 	}
-
-	return &engine.State{
-		Exited:    true,
-		ExitCode:  info.State.ExitCode,
-		OOMKilled: info.State.OOMKilled,
-	}, nil
+	return resolveDigest(image, step.Docker.Image), nil
 }
 
 func (e *dockerEngine) Tail(ctx context.Context, spec *engine.Spec, step *engine.Step) (io.ReadCloser, error) {
@@ -254,14 +366,25 @@ func (e *dockerEngine) Destroy(ctx context.Context, spec *engine.Spec) error {
 		RemoveVolumes: true,
 	}
 
-	// stop all containers
+	// stop all containers. note that we ignore errors
+	// because the container may have already exited, and
+	// is forcibly removed below.
 	for _, step := range spec.Steps {
 		e.client.ContainerKill(ctx, step.Metadata.UID, "9")
 	}
 
-	// cleanup all containers
+	errs := new(MultiError)
+
+	// cleanup all containers. note that a container does
+	// not exist if the step was skipped, which is not
+	// considered an error.
 	for _, step := range spec.Steps {
-		e.client.ContainerRemove(ctx, step.Metadata.UID, removeOpts)
+		err := retry(ctx, func() error {
+			return e.client.ContainerRemove(ctx, step.Metadata.UID, removeOpts)
+		})
+		if err != nil && !client.IsErrNotFound(err) {
+			errs.append(err)
+		}
 	}
 
 	// cleanup all volumes
@@ -275,16 +398,62 @@ func (e *dockerEngine) Destroy(ctx context.Context, spec *engine.Spec) error {
 			if vol.EmptyDir.Medium == "memory" {
 				continue
 			}
-			e.client.VolumeRemove(ctx, vol.Metadata.UID, true)
+			err := retry(ctx, func() error {
+				return e.client.VolumeRemove(ctx, vol.Metadata.UID, true)
+			})
+			if err != nil && !client.IsErrNotFound(err) {
+				errs.append(err)
+			}
+		}
+	}
+
+	// cleanup the user-defined networks
+	if spec.Docker != nil {
+		for _, net := range spec.Docker.Networks {
+			err := retry(ctx, func() error {
+				return e.client.NetworkRemove(ctx, net.Metadata.UID)
+			})
+			if err != nil && !client.IsErrNotFound(err) {
+				errs.append(err)
+			}
 		}
 	}
 
 	// cleanup the network
-	e.client.NetworkRemove(ctx, spec.Metadata.UID)
+	err := retry(ctx, func() error {
+		return e.client.NetworkRemove(ctx, spec.Metadata.UID)
+	})
+	if err != nil && !client.IsErrNotFound(err) {
+		errs.append(err)
+	}
 
-	// notice that we never collect or return any errors.
-	// this is because we silently ignore cleanup failures
-	// and instead ask the system admin to periodically run
-	// `docker prune` commands.
-	return nil
+	// note that resources which cannot be removed are
+	// reported to the caller. These resources can be
+	// removed at a later time using the Prune function.
+	return errs.errorOrNil()
+}
+
+// helper function retries the function when the resource
+// cannot be removed because it is still in use, for
+// example, a network with an attached container that is
+// still being removed.
+func retry(ctx context.Context, fn func() error) (err error) {
+	for i := 0; i < removeAttempts; i++ {
+		err = fn()
+		if err == nil || !isInUse(err) {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(removeBackoff):
+		}
+	}
+	return err
+}
+
+// helper function returns true if the error indicates
+// the resource is still in use.
+func isInUse(err error) bool {
+	return errdefs.IsConflict(err) || errdefs.IsForbidden(err)
 }
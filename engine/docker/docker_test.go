@@ -3,3 +3,536 @@
 // that can be found in the LICENSE file.
 
 package docker
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/drone/drone-runtime/engine"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/api/types/volume"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/errdefs"
+	"github.com/google/go-cmp/cmp"
+)
+
+// fakeClient implements a subset of the docker client
+// required to unit test the engine.
+type fakeClient struct {
+	client.APIClient
+
+	waits    int
+	waitErr  error
+	inspects []types.ContainerJSON
+	killed   []string
+
+	// removeErrs defines the errors returned when removing
+	// a resource, by resource id, in order.
+	removeErrs map[string][]error
+	removed    []string
+
+	connectErr error
+	connected  []string
+
+	images map[string]types.ImageInspect
+	pulled []string
+
+	waitCode int64
+	created  []*container.Config
+	started  []string
+	output   string
+
+	volumes []*types.Volume
+}
+
+func (c *fakeClient) ContainerCommit(_ context.Context, id string, _ types.ContainerCommitOptions) (types.IDResponse, error) {
+	return types.IDResponse{ID: "sha256:" + id}, nil
+}
+
+func (c *fakeClient) ContainerAttach(context.Context, string, types.ContainerAttachOptions) (types.HijackedResponse, error) {
+	conn, _ := net.Pipe()
+	return types.HijackedResponse{
+		Conn:   conn,
+		Reader: bufio.NewReader(strings.NewReader(c.output)),
+	}, nil
+}
+
+func (c *fakeClient) ContainerStart(_ context.Context, id string, _ types.ContainerStartOptions) error {
+	c.started = append(c.started, id)
+	return nil
+}
+
+func (c *fakeClient) ImageRemove(_ context.Context, id string, _ types.ImageRemoveOptions) ([]types.ImageDeleteResponseItem, error) {
+	return nil, c.remove(id)
+}
+
+func (c *fakeClient) ImageInspectWithRaw(_ context.Context, image string) (types.ImageInspect, []byte, error) {
+	info, ok := c.images[image]
+	if !ok {
+		return info, nil, errdefs.NotFound(errors.New("No such image: " + image))
+	}
+	return info, nil, nil
+}
+
+func (c *fakeClient) ImagePull(_ context.Context, image string, _ types.ImagePullOptions) (io.ReadCloser, error) {
+	c.pulled = append(c.pulled, image)
+	return ioutil.NopCloser(strings.NewReader("")), nil
+}
+
+func (c *fakeClient) ContainerCreate(_ context.Context, config *container.Config, _ *container.HostConfig, _ *network.NetworkingConfig, name string) (container.ContainerCreateCreatedBody, error) {
+	c.created = append(c.created, config)
+	if name == "" {
+		name = "exec_1"
+	}
+	return container.ContainerCreateCreatedBody{ID: name}, nil
+}
+
+func (c *fakeClient) NetworkConnect(_ context.Context, id, _ string, _ *network.EndpointSettings) error {
+	c.connected = append(c.connected, id)
+	return c.connectErr
+}
+
+func (c *fakeClient) ContainerWait(ctx context.Context, id string, _ container.WaitCondition) (<-chan container.ContainerWaitOKBody, <-chan error) {
+	c.waits++
+	waitc := make(chan container.ContainerWaitOKBody, 1)
+	errc := make(chan error, 1)
+	switch {
+	case c.waitErr != nil:
+		errc <- c.waitErr
+	case ctx.Err() != nil:
+		errc <- ctx.Err()
+	default:
+		waitc <- container.ContainerWaitOKBody{StatusCode: c.waitCode}
+	}
+	return waitc, errc
+}
+
+func (c *fakeClient) ContainerInspect(_ context.Context, id string) (types.ContainerJSON, error) {
+	info := c.inspects[0]
+	if len(c.inspects) > 1 {
+		c.inspects = c.inspects[1:]
+	}
+	return info, nil
+}
+
+func (c *fakeClient) ContainerKill(_ context.Context, id, _ string) error {
+	c.killed = append(c.killed, id)
+	return nil
+}
+
+func (c *fakeClient) remove(id string) error {
+	if errs := c.removeErrs[id]; len(errs) != 0 {
+		c.removeErrs[id] = errs[1:]
+		return errs[0]
+	}
+	c.removed = append(c.removed, id)
+	return nil
+}
+
+func (c *fakeClient) ContainerRemove(_ context.Context, id string, _ types.ContainerRemoveOptions) error {
+	return c.remove(id)
+}
+
+func (c *fakeClient) VolumeRemove(_ context.Context, id string, _ bool) error {
+	return c.remove(id)
+}
+
+func (c *fakeClient) NetworkRemove(_ context.Context, id string) error {
+	return c.remove(id)
+}
+
+func (c *fakeClient) ContainerList(context.Context, types.ContainerListOptions) ([]types.Container, error) {
+	return nil, nil
+}
+
+func (c *fakeClient) VolumeList(context.Context, filters.Args) (volume.VolumeListOKBody, error) {
+	return volume.VolumeListOKBody{Volumes: c.volumes}, nil
+}
+
+func (c *fakeClient) NetworkList(context.Context, types.NetworkListOptions) ([]types.NetworkResource, error) {
+	return nil, nil
+}
+
+func newContainerJSON(state *types.ContainerState) types.ContainerJSON {
+	return types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{
+			Image: "sha256:b5fb3d8b",
+			State: state,
+		},
+	}
+}
+
+const testDigest = "sha256:9e0d5d6b6d1a0ac8b4b1b5f9b0c6b6ba35e3b0c9c0c0f6e5d4c1d1d3d5b7b3f4"
+
+var testStep = &engine.Step{
+	Metadata: engine.Metadata{UID: "uid_1", Name: "build"},
+	Docker:   &engine.DockerStep{Image: "golang:1.11"},
+}
+
+func TestWait(t *testing.T) {
+	cli := &fakeClient{
+		inspects: []types.ContainerJSON{
+			newContainerJSON(&types.ContainerState{Running: true}),
+			newContainerJSON(&types.ContainerState{
+				ExitCode:   2,
+				OOMKilled:  true,
+				Error:      "oops",
+				FinishedAt: "2019-08-20T12:00:00.000000000Z",
+			}),
+		},
+		images: map[string]types.ImageInspect{
+			"sha256:b5fb3d8b": {
+				ID:          "sha256:b5fb3d8b",
+				RepoDigests: []string{"golang@" + testDigest},
+			},
+		},
+	}
+	state, err := New(cli).Wait(context.Background(), &engine.Spec{}, testStep)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if got, want := cli.waits, 2; got != want {
+		t.Errorf("Want wait until container exits, got %d waits", got)
+	}
+	if got, want := state.ExitCode, 2; got != want {
+		t.Errorf("Want exit code %d, got %d", want, got)
+	}
+	if !state.Exited || !state.OOMKilled {
+		t.Errorf("Want exited and oom killed state")
+	}
+	if got, want := state.Error, "oops"; got != want {
+		t.Errorf("Want error message %q, got %q", want, got)
+	}
+	if got, want := state.Finished, int64(1566302400); got != want {
+		t.Errorf("Want finished time %d, got %d", want, got)
+	}
+	if got, want := state.Digest, testDigest; got != want {
+		t.Errorf("Want image digest %q, got %q", want, got)
+	}
+}
+
+func TestWaitError(t *testing.T) {
+	cli := &fakeClient{
+		waitErr: errors.New("connection refused"),
+	}
+	_, err := New(cli).Wait(context.Background(), &engine.Spec{}, testStep)
+	if err != cli.waitErr {
+		t.Errorf("Want daemon error returned, got %v", err)
+	}
+}
+
+func TestWaitCancel(t *testing.T) {
+	cli := &fakeClient{}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := New(cli).Wait(ctx, &engine.Spec{}, testStep)
+	if err != context.Canceled {
+		t.Errorf("Want context cancel error, got %v", err)
+	}
+	if len(cli.killed) != 1 || cli.killed[0] != testStep.Metadata.UID {
+		t.Errorf("Want container killed on cancel")
+	}
+}
+
+func TestDestroy(t *testing.T) {
+	removeBackoff = 0
+
+	spec := &engine.Spec{
+		Metadata: engine.Metadata{UID: "network_1"},
+		Steps: []*engine.Step{
+			{Metadata: engine.Metadata{UID: "step_1"}},
+			{Metadata: engine.Metadata{UID: "step_2"}},
+			{Metadata: engine.Metadata{UID: "step_3"}},
+		},
+		Docker: &engine.DockerConfig{
+			Volumes: []*engine.Volume{
+				{
+					Metadata: engine.Metadata{UID: "volume_1"},
+					EmptyDir: &engine.VolumeEmptyDir{},
+				},
+			},
+		},
+	}
+
+	failure := errors.New("permission denied")
+	cli := &fakeClient{
+		removeErrs: map[string][]error{
+			// the container was never created, which is
+			// not considered an error.
+			"step_2": {errdefs.NotFound(errors.New("not found"))},
+			// the container cannot be removed.
+			"step_3": {failure},
+			// the volume is in use and is removed once
+			// the removal is retried.
+			"volume_1": {errdefs.Conflict(errors.New("volume is in use"))},
+		},
+	}
+
+	err := New(cli).Destroy(context.Background(), spec)
+	merr, ok := err.(*MultiError)
+	if !ok {
+		t.Errorf("Want MultiError, got %v", err)
+		return
+	}
+	if len(merr.Errors) != 1 || merr.Errors[0] != failure {
+		t.Errorf("Want removal errors reported, got %v", merr.Errors)
+	}
+	want := []string{"step_1", "volume_1", "network_1"}
+	if diff := cmp.Diff(want, cli.removed); diff != "" {
+		t.Errorf("Unexpected removed resources")
+		t.Log(diff)
+	}
+}
+
+func TestCreateNetworkError(t *testing.T) {
+	step := &engine.Step{
+		Metadata: engine.Metadata{UID: "uid_1", Name: "build"},
+		Docker: &engine.DockerStep{
+			Image:    "golang:1.11",
+			Networks: []string{"backend"},
+		},
+	}
+	cli := &fakeClient{
+		connectErr: errors.New("network backend not found"),
+	}
+	err := New(cli).Create(context.Background(), &engine.Spec{}, step)
+	nerr, ok := err.(*NetworkError)
+	if !ok {
+		t.Errorf("Want NetworkError, got %v", err)
+		return
+	}
+	if got, want := nerr.Network, "backend"; got != want {
+		t.Errorf("Want network %q, got %q", want, got)
+	}
+	if nerr.Err != cli.connectErr {
+		t.Errorf("Want network error wrapped")
+	}
+}
+
+func TestCreateNetworkOrder(t *testing.T) {
+	spec := &engine.Spec{
+		Docker: &engine.DockerConfig{
+			Networks: []*engine.Network{
+				{Metadata: engine.Metadata{UID: "uid_backend", Name: "backend"}},
+			},
+		},
+	}
+	step := &engine.Step{
+		Metadata: engine.Metadata{UID: "uid_1", Name: "build"},
+		Docker: &engine.DockerStep{
+			Image:    "golang:1.11",
+			Networks: []string{"frontend", "backend", "cache"},
+			Endpoints: []*engine.Endpoint{
+				{Network: "backend", Aliases: []string{"api"}},
+				{Network: "monitoring"},
+			},
+		},
+	}
+	for i := 0; i < 10; i++ {
+		cli := &fakeClient{}
+		if err := New(cli).Create(context.Background(), spec, step); err != nil {
+			t.Error(err)
+			return
+		}
+		want := []string{"frontend", "uid_backend", "cache", "monitoring"}
+		if diff := cmp.Diff(want, cli.connected); diff != "" {
+			t.Errorf("Want networks connected in order")
+			t.Log(diff)
+			return
+		}
+	}
+}
+
+func TestCreateNetworkErrorName(t *testing.T) {
+	spec := &engine.Spec{
+		Docker: &engine.DockerConfig{
+			Networks: []*engine.Network{
+				{Metadata: engine.Metadata{UID: "uid_backend", Name: "backend"}},
+			},
+		},
+	}
+	step := &engine.Step{
+		Metadata: engine.Metadata{UID: "uid_1", Name: "build"},
+		Docker: &engine.DockerStep{
+			Image:    "golang:1.11",
+			Networks: []string{"backend"},
+		},
+	}
+	cli := &fakeClient{
+		connectErr: errors.New("network not found"),
+	}
+	err := New(cli).Create(context.Background(), spec, step)
+	if nerr, ok := err.(*NetworkError); !ok || nerr.Network != "backend" {
+		t.Errorf("Want NetworkError for network backend, got %v", err)
+	}
+}
+
+func TestCreateDigest(t *testing.T) {
+	step := &engine.Step{
+		Metadata: engine.Metadata{UID: "uid_1", Name: "build"},
+		Docker: &engine.DockerStep{
+			Image:  "golang:1.11",
+			Digest: "sha256:9e0d5d6b",
+		},
+	}
+	cli := &fakeClient{
+		images: map[string]types.ImageInspect{
+			"golang:1.11": {
+				ID:          "sha256:b5fb3d8b",
+				RepoDigests: []string{"golang@sha256:9e0d5d6b"},
+			},
+		},
+	}
+	err := New(cli).Create(context.Background(), &engine.Spec{}, step)
+	if err != nil {
+		t.Error(err)
+	}
+	// the container is created from the verified image
+	// identifier, and not the tag.
+	if got, want := cli.created[0].Image, "sha256:b5fb3d8b"; got != want {
+		t.Errorf("Want container created from image %q, got %q", want, got)
+	}
+
+	// if the local image does not match the expected
+	// digest a digest error is returned.
+	step.Docker.Digest = "sha256:0dfe0ac6"
+	err = New(cli).Create(context.Background(), &engine.Spec{}, step)
+	if _, ok := err.(*DigestError); !ok {
+		t.Errorf("Want DigestError, got %v", err)
+	}
+}
+
+func TestCreateDigestPull(t *testing.T) {
+	step := &engine.Step{
+		Metadata: engine.Metadata{UID: "uid_1", Name: "build"},
+		Docker: &engine.DockerStep{
+			Image:      "golang:1.11",
+			Digest:     "sha256:9e0d5d6b",
+			PullPolicy: engine.PullNever,
+		},
+	}
+
+	// if the image does not exist and the pull policy
+	// is set to never, the image is not pulled.
+	cli := &fakeClient{}
+	err := New(cli).Create(context.Background(), &engine.Spec{}, step)
+	if !client.IsErrNotFound(err) {
+		t.Errorf("Want image not found error, got %v", err)
+	}
+	if len(cli.pulled) != 0 {
+		t.Errorf("Want image not pulled")
+	}
+
+	step.Docker.PullPolicy = engine.PullDefault
+	New(cli).Create(context.Background(), &engine.Spec{}, step)
+	if len(cli.pulled) != 1 {
+		t.Errorf("Want image pulled before digest is verified")
+	}
+}
+
+func TestDigest(t *testing.T) {
+	cli := &fakeClient{
+		inspects: []types.ContainerJSON{
+			newContainerJSON(&types.ContainerState{Running: true}),
+		},
+		images: map[string]types.ImageInspect{
+			"sha256:b5fb3d8b": {
+				ID:          "sha256:b5fb3d8b",
+				RepoDigests: []string{"golang@" + testDigest},
+			},
+		},
+	}
+	digest, err := New(cli).(engine.Digester).Digest(context.Background(), &engine.Spec{}, testStep)
+	if err != nil {
+		t.Error(err)
+	}
+	if digest != testDigest {
+		t.Errorf("Want digest %q, got %q", testDigest, digest)
+	}
+}
+
+func TestExec(t *testing.T) {
+	removeBackoff = 0
+
+	cli := &fakeClient{
+		waitCode: 2,
+		output:   "hello world\n",
+	}
+
+	var buf bytes.Buffer
+	state, err := New(cli).(engine.Execer).Exec(context.Background(), &engine.Spec{}, testStep, &engine.ExecOptions{
+		Command: []string{"/bin/sh", "-c", "go test"},
+		TTY:     true,
+		Stdout:  &buf,
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if got, want := state.ExitCode, 2; got != want {
+		t.Errorf("Want exit code %d, got %d", want, got)
+	}
+	if got, want := buf.String(), cli.output; got != want {
+		t.Errorf("Want output %q, got %q", want, got)
+	}
+	if len(cli.created) != 1 {
+		t.Errorf("Want container created")
+		return
+	}
+	config := cli.created[0]
+	if got, want := config.Image, "sha256:uid_1"; got != want {
+		t.Errorf("Want container created from committed image %q, got %q", want, got)
+	}
+	if diff := cmp.Diff([]string{"/bin/sh", "-c", "go test"}, []string(config.Entrypoint)); diff != "" {
+		t.Errorf("Unexpected entrypoint")
+		t.Log(diff)
+	}
+	if config.OpenStdin || !config.Tty {
+		t.Errorf("Want tty without stdin")
+	}
+	if diff := cmp.Diff([]string{"exec_1"}, cli.started); diff != "" {
+		t.Errorf("Want exec container started")
+		t.Log(diff)
+	}
+	if diff := cmp.Diff([]string{"exec_1", "sha256:uid_1"}, cli.removed); diff != "" {
+		t.Errorf("Want exec container and image removed")
+		t.Log(diff)
+	}
+}
+
+func TestPruneVolumeAge(t *testing.T) {
+	c := &fakeClient{
+		volumes: []*types.Volume{
+			{Name: "old", CreatedAt: time.Now().Add(-2 * time.Hour).Format(time.RFC3339)},
+			{Name: "new", CreatedAt: time.Now().Format(time.RFC3339)},
+			{Name: "unknown", CreatedAt: "yesterday"},
+		},
+	}
+	labels := map[string]string{"io.drone": "true"}
+	report, err := prune(context.Background(), c, labels, time.Hour)
+	if err != nil {
+		t.Error(err)
+	}
+	if diff := cmp.Diff([]string{"old"}, report.Volumes); diff != "" {
+		t.Errorf("Want only volumes older than the duration removed")
+		t.Log(diff)
+	}
+	if diff := cmp.Diff([]string{"old"}, c.removed); diff != "" {
+		t.Errorf("Unexpected removed volumes")
+		t.Log(diff)
+	}
+}
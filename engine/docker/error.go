@@ -0,0 +1,78 @@
+// Copyright 2019 Drone IO, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package docker
+
+import (
+	"fmt"
+	"strings"
+)
+
+// A MultiError reports multiple errors, for example, when
+// one or more pipeline resources cannot be removed.
+type MultiError struct {
+	Errors []error
+}
+
+// Error returns the error message in string format.
+func (e *MultiError) Error() string {
+	var msgs []string
+	for _, err := range e.Errors {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// helper function appends the error to the list of
+// errors, if not nil.
+func (e *MultiError) append(err error) {
+	if err != nil {
+		e.Errors = append(e.Errors, err)
+	}
+}
+
+// helper function returns the MultiError if it contains
+// one or more errors, else nil.
+func (e *MultiError) errorOrNil() error {
+	if len(e.Errors) == 0 {
+		return nil
+	}
+	return e
+}
+
+// A NetworkError reports the step container could not be
+// attached to the named network.
+type NetworkError struct {
+	Name    string
+	Network string
+	Err     error
+}
+
+// Error returns the error message in string format.
+func (e *NetworkError) Error() string {
+	return fmt.Sprintf("%s : cannot connect to network %s: %s", e.Name, e.Network, e.Err)
+}
+
+// A DigestError reports the image does not match the
+// expected image digest.
+type DigestError struct {
+	Name   string
+	Image  string
+	Digest string
+}
+
+// Error returns the error message in string format.
+func (e *DigestError) Error() string {
+	return fmt.Sprintf("%s : image %s does not match digest %s", e.Name, e.Image, e.Digest)
+}
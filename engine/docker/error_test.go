@@ -0,0 +1,48 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Drone Non-Commercial License
+// that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestMultiError(t *testing.T) {
+	err := new(MultiError)
+	if err.errorOrNil() != nil {
+		t.Errorf("Want nil error when no errors appended")
+	}
+	err.append(nil)
+	err.append(errors.New("No such volume: foo"))
+	err.append(errors.New("No such network: bar"))
+	got, want := err.errorOrNil().Error(), "No such volume: foo; No such network: bar"
+	if got != want {
+		t.Errorf("Want error message %q, got %q", want, got)
+	}
+}
+
+func TestNetworkError(t *testing.T) {
+	err := NetworkError{
+		Name:    "build",
+		Network: "backend",
+		Err:     errors.New("network not found"),
+	}
+	got, want := err.Error(), "build : cannot connect to network backend: network not found"
+	if got != want {
+		t.Errorf("Want error message %q, got %q", want, got)
+	}
+}
+
+func TestDigestError(t *testing.T) {
+	err := DigestError{
+		Name:   "build",
+		Image:  "golang:1.11",
+		Digest: "sha256:9e0d5d6b",
+	}
+	got, want := err.Error(), "build : image golang:1.11 does not match digest sha256:9e0d5d6b"
+	if got != want {
+		t.Errorf("Want error message %q, got %q", want, got)
+	}
+}
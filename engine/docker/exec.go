@@ -0,0 +1,162 @@
+// Copyright 2019 Drone IO, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package docker
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+
+	"github.com/drone/drone-runtime/engine"
+	"github.com/drone/drone-runtime/engine/docker/stdcopy"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+)
+
+// Exec executes the command in a new container, created
+// from a snapshot of the step container. The new container
+// is created with the step configuration, volumes and
+// networks, and is removed when the command exits.
+func (e *dockerEngine) Exec(ctx context.Context, spec *engine.Spec, step *engine.Step, opts *engine.ExecOptions) (*engine.State, error) {
+	if step.Docker == nil {
+		return nil, errors.New("engine: missing docker configuration")
+	}
+
+	// snapshot the step container, including any changes
+	// to the container file system made by the step.
+	commit, err := e.client.ContainerCommit(ctx, step.Metadata.UID, types.ContainerCommitOptions{})
+	if err != nil {
+		return nil, err
+	}
+	defer e.client.ImageRemove(context.Background(), commit.ID, types.ImageRemoveOptions{
+		Force:         true,
+		PruneChildren: true,
+	})
+
+	created, err := e.client.ContainerCreate(ctx,
+		toExecConfig(spec, step, commit.ID, opts),
+		toHostConfig(spec, step),
+		toNetConfig(spec, step),
+		"",
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer e.client.ContainerRemove(context.Background(), created.ID, types.ContainerRemoveOptions{
+		Force:         true,
+		RemoveVolumes: true,
+	})
+
+	// networks are attached in the order they are defined,
+	// matching the step container.
+	if step.Docker.Network == "" {
+		endpoints := toEndpoints(spec, step)
+		for _, name := range toNetworkNames(step) {
+			id := toNetworkID(spec, name)
+			err = e.client.NetworkConnect(ctx, id, created.ID, endpoints[id])
+			if err != nil {
+				return nil, &NetworkError{
+					Name:    step.Metadata.Name,
+					Network: name,
+					Err:     err,
+				}
+			}
+		}
+	}
+
+	attach, err := e.client.ContainerAttach(ctx, created.ID, types.ContainerAttachOptions{
+		Stream: true,
+		Stdin:  opts.Stdin != nil,
+		Stdout: true,
+		Stderr: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer attach.Close()
+
+	// note that the stdin copy is not awaited, since the
+	// reader may block after the command exits.
+	if opts.Stdin != nil {
+		go func() {
+			io.Copy(attach.Conn, opts.Stdin)
+			attach.CloseWrite()
+		}()
+	}
+	done := make(chan struct{})
+	go func() {
+		stdout, stderr := opts.Stdout, opts.Stderr
+		if stdout == nil {
+			stdout = ioutil.Discard
+		}
+		if stderr == nil {
+			stderr = stdout
+		}
+		if opts.TTY {
+			io.Copy(stdout, attach.Reader)
+		} else {
+			stdcopy.StdCopy(stdout, stderr, attach.Reader)
+		}
+		close(done)
+	}()
+
+	// wait for the next exit before the container is
+	// started to ensure the exit is not missed.
+	wait, errc := e.client.ContainerWait(ctx, created.ID, container.WaitConditionNextExit)
+	if err := e.client.ContainerStart(ctx, created.ID, types.ContainerStartOptions{}); err != nil {
+		return nil, err
+	}
+	if opts.TTY && opts.Height != 0 && opts.Width != 0 {
+		e.client.ContainerResize(ctx, created.ID, types.ResizeOptions{
+			Height: opts.Height,
+			Width:  opts.Width,
+		})
+	}
+
+	select {
+	case res := <-wait:
+		if res.Error != nil && res.Error.Message != "" {
+			return nil, errors.New(res.Error.Message)
+		}
+		<-done
+		return &engine.State{
+			Exited:   true,
+			ExitCode: int(res.StatusCode),
+		}, nil
+	case err := <-errc:
+		return nil, err
+	case <-ctx.Done():
+		e.client.ContainerKill(context.Background(), created.ID, "9")
+		return nil, ctx.Err()
+	}
+}
+
+// helper function returns the container configuration
+// used to execute a command in a copy of the step.
+func toExecConfig(spec *engine.Spec, step *engine.Step, image string, opts *engine.ExecOptions) *container.Config {
+	config := toConfig(spec, step)
+	config.Image = image
+	config.Entrypoint = opts.Command
+	config.Cmd = nil
+	config.Tty = opts.TTY
+	config.OpenStdin = opts.Stdin != nil
+	config.StdinOnce = opts.Stdin != nil
+	config.AttachStdin = opts.Stdin != nil
+	config.AttachStdout = true
+	config.AttachStderr = true
+	return config
+}
@@ -18,27 +18,42 @@ import (
 	"strings"
 
 	"github.com/docker/distribution/reference"
+	"github.com/docker/docker/api/types"
 )
 
-// helper function parses the image and returns the
-// canonical image name, domain name, and whether or not
-// the image tag is :latest.
-func parseImage(s string) (canonical, domain string, latest bool, err error) {
-	// parse the docker image name. We need to extract the
-	// image domain name and match to registry credentials
-	// stored in the .docker/config.json object.
-	named, err := reference.ParseNormalizedNamed(s)
-	if err != nil {
-		return
+// helper function returns true if the image matches the
+// digest. The digest may be a repository digest, or the
+// image identifier.
+func matchDigest(image types.ImageInspect, digest string) bool {
+	if image.ID == digest {
+		return true
+	}
+	for _, repoDigest := range image.RepoDigests {
+		if strings.HasSuffix(repoDigest, "@"+digest) {
+			return true
+		}
 	}
-	// the canonical image name, for some reason, excludes
-	// the tag name. So we need to make sure it is included
-	// in the image name so we can determine if the :latest
-	// tag is specified
-	named = reference.TagNameOnly(named)
+	return false
+}
 
-	return named.String(),
-		reference.Domain(named),
-		strings.HasSuffix(named.String(), ":latest"),
-		nil
+// helper function returns the repository digest for the
+// named image. If the image does not have a repository
+// digest, for example, if the image was built locally,
+// the image identifier is returned.
+func resolveDigest(image types.ImageInspect, name string) string {
+	named, err := reference.ParseNormalizedNamed(name)
+	if err != nil {
+		return image.ID
+	}
+	for _, repoDigest := range image.RepoDigests {
+		ref, err := reference.ParseNormalizedNamed(repoDigest)
+		if err != nil {
+			continue
+		}
+		digested, ok := ref.(reference.Digested)
+		if ok && ref.Name() == named.Name() {
+			return digested.Digest().String()
+		}
+	}
+	return image.ID
 }
@@ -4,53 +4,43 @@
 
 package docker
 
-import "testing"
+import (
+	"testing"
 
-func TestParseImage(t *testing.T) {
-	tests := []struct {
-		image     string
-		canonical string
-		domain    string
-		latest    bool
-		err       bool
-	}{
-		{
-			image:     "golang",
-			canonical: "docker.io/library/golang:latest",
-			domain:    "docker.io",
-			latest:    true,
-		},
-		{
-			image:     "golang:1.11",
-			canonical: "docker.io/library/golang:1.11",
-			domain:    "docker.io",
-			latest:    false,
-		},
-		{
-			image: "",
-			err:   true,
-		},
+	"github.com/docker/docker/api/types"
+)
+
+func TestMatchDigest(t *testing.T) {
+	image := types.ImageInspect{
+		ID:          "sha256:b5fb3d8b",
+		RepoDigests: []string{"golang@sha256:9e0d5d6b"},
+	}
+	if !matchDigest(image, "sha256:9e0d5d6b") {
+		t.Errorf("Expect match repository digest")
+	}
+	if !matchDigest(image, "sha256:b5fb3d8b") {
+		t.Errorf("Expect match image id")
 	}
+	if matchDigest(image, "sha256:0dfe0ac6") {
+		t.Errorf("Expect digest mismatch")
+	}
+}
 
-	for _, test := range tests {
-		canonical, domain, latest, err := parseImage(test.image)
-		if test.err {
-			if err == nil {
-				t.Errorf("Expect error parsing image %s", test.image)
-			}
-			continue
-		}
-		if err != nil {
-			t.Error(err)
-		}
-		if got, want := canonical, test.canonical; got != want {
-			t.Errorf("Want image %s, got %s", want, got)
-		}
-		if got, want := domain, test.domain; got != want {
-			t.Errorf("Want image domain %s, got %s", want, got)
-		}
-		if got, want := latest, test.latest; got != want {
-			t.Errorf("Want image latest %v, got %v", want, got)
-		}
+func TestResolveDigest(t *testing.T) {
+	const digest = "sha256:9e0d5d6b6d1a0ac8b4b1b5f9b0c6b6ba35e3b0c9c0c0f6e5d4c1d1d3d5b7b3f4"
+	image := types.ImageInspect{
+		ID: "sha256:b5fb3d8b",
+		RepoDigests: []string{
+			"mirror.company.com/golang@sha256:0dfe0ac6a1e4b2c2d2c5b7e0c3d9a7f1b6e8c4d2a0f9e7b5c3a1d8f6e4c2b0a9",
+			"golang@" + digest,
+		},
+	}
+	if got, want := resolveDigest(image, "golang:1.11"), digest; got != want {
+		t.Errorf("Want repository digest %q, got %q", want, got)
+	}
+	// if the image has no repository digest, the image
+	// identifier is returned.
+	if got, want := resolveDigest(image, "alpine:3.8"), image.ID; got != want {
+		t.Errorf("Want image id %q, got %q", want, got)
 	}
 }
@@ -0,0 +1,110 @@
+// Copyright 2019 Drone IO, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package docker
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/drone/drone-runtime/engine"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/api/types/volume"
+)
+
+type (
+	// manifest describes the docker resources created for
+	// the pipeline.
+	manifest struct {
+		Volumes    []*volume.VolumeCreateBody `json:"volumes"`
+		Networks   []*networkManifest         `json:"networks"`
+		Containers []*containerManifest       `json:"containers"`
+	}
+
+	// networkManifest describes a docker network.
+	networkManifest struct {
+		Name string `json:"name"`
+		types.NetworkCreate
+	}
+
+	// containerManifest describes a docker container.
+	containerManifest struct {
+		Name             string                    `json:"name"`
+		Config           *container.Config         `json:"config"`
+		HostConfig       *container.HostConfig     `json:"host_config"`
+		NetworkingConfig *network.NetworkingConfig `json:"networking_config"`
+	}
+)
+
+// Print writes the docker volumes, networks and containers
+// created for the specification to w, in json format.
+func Print(w io.Writer, spec *engine.Spec) error {
+	m := &manifest{
+		Volumes:    []*volume.VolumeCreateBody{},
+		Networks:   []*networkManifest{},
+		Containers: []*containerManifest{},
+	}
+
+	if spec.Docker != nil {
+		for _, vol := range spec.Docker.Volumes {
+			if vol.EmptyDir == nil {
+				continue
+			}
+			m.Volumes = append(m.Volumes, &volume.VolumeCreateBody{
+				Name:   vol.Metadata.UID,
+				Driver: "local",
+				Labels: spec.Metadata.Labels,
+			})
+		}
+	}
+
+	driver := "bridge"
+	if spec.Platform.OS == "windows" {
+		driver = "nat"
+	}
+	m.Networks = append(m.Networks, &networkManifest{
+		Name: spec.Metadata.UID,
+		NetworkCreate: types.NetworkCreate{
+			Driver: driver,
+			Labels: spec.Metadata.Labels,
+		},
+	})
+	if spec.Docker != nil {
+		for _, net := range spec.Docker.Networks {
+			m.Networks = append(m.Networks, &networkManifest{
+				Name:          net.Metadata.UID,
+				NetworkCreate: toNetworkCreate(spec, net),
+			})
+		}
+	}
+
+	for _, step := range spec.Steps {
+		if step.Docker == nil {
+			continue
+		}
+		m.Containers = append(m.Containers, &containerManifest{
+			Name:             step.Metadata.UID,
+			Config:           toConfig(spec, step),
+			HostConfig:       toHostConfig(spec, step),
+			NetworkingConfig: toNetConfig(spec, step),
+		})
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(m)
+}
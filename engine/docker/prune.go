@@ -0,0 +1,130 @@
+// Copyright 2019 Drone IO, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package docker
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/client"
+)
+
+// PruneReport lists the resources removed by Prune.
+type PruneReport struct {
+	Containers []string
+	Volumes    []string
+	Networks   []string
+}
+
+// Prune removes the containers, volumes and networks that
+// match the pipeline labels and were created before the
+// specified duration, using the docker client configured
+// from the environment. This can be used to remove
+// resources that were not removed when the pipeline
+// completed.
+func Prune(ctx context.Context, labels map[string]string, olderThan time.Duration) (*PruneReport, error) {
+	cli, err := client.NewClientWithOpts(client.FromEnv)
+	if err != nil {
+		return nil, err
+	}
+	return prune(ctx, cli, labels, olderThan)
+}
+
+// helper function removes the resources that match the
+// pipeline labels and were created before the specified
+// duration, using the docker client.
+func prune(ctx context.Context, cli client.APIClient, labels map[string]string, olderThan time.Duration) (*PruneReport, error) {
+	// we require at least one label to prevent removing
+	// resources that were not created by the engine.
+	if len(labels) == 0 {
+		return nil, errors.New("engine: prune requires one or more labels")
+	}
+
+	args := filters.NewArgs()
+	for k, v := range labels {
+		args.Add("label", k+"="+v)
+	}
+	before := time.Now().Add(-olderThan)
+	report := new(PruneReport)
+	errs := new(MultiError)
+
+	containers, err := cli.ContainerList(ctx, types.ContainerListOptions{
+		All:     true,
+		Filters: args,
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range containers {
+		if time.Unix(c.Created, 0).After(before) {
+			continue
+		}
+		err := cli.ContainerRemove(ctx, c.ID, types.ContainerRemoveOptions{
+			Force:         true,
+			RemoveVolumes: true,
+		})
+		if err != nil && !client.IsErrNotFound(err) {
+			errs.append(err)
+			continue
+		}
+		report.Containers = append(report.Containers, c.ID)
+	}
+
+	volumes, err := cli.VolumeList(ctx, args)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range volumes.Volumes {
+		// volumes with an unknown creation time are
+		// skipped, since their age cannot be verified.
+		created, err := time.Parse(time.RFC3339, v.CreatedAt)
+		if err != nil || created.After(before) {
+			continue
+		}
+		err = retry(ctx, func() error {
+			return cli.VolumeRemove(ctx, v.Name, true)
+		})
+		if err != nil && !client.IsErrNotFound(err) {
+			errs.append(err)
+			continue
+		}
+		report.Volumes = append(report.Volumes, v.Name)
+	}
+
+	networks, err := cli.NetworkList(ctx, types.NetworkListOptions{
+		Filters: args,
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, n := range networks {
+		if n.Created.After(before) {
+			continue
+		}
+		err := retry(ctx, func() error {
+			return cli.NetworkRemove(ctx, n.ID)
+		})
+		if err != nil && !client.IsErrNotFound(err) {
+			errs.append(err)
+			continue
+		}
+		report.Networks = append(report.Networks, n.Name)
+	}
+
+	return report, errs.errorOrNil()
+}
@@ -31,3 +31,69 @@ type Engine interface {
 	// Destroy the pipeline environment.
 	Destroy(context.Context, *Spec) error
 }
+
+// ExecOptions configures the execution of a command in a
+// step container.
+type ExecOptions struct {
+	// Command is the command and arguments to execute.
+	Command []string
+
+	// TTY allocates a pseudo-terminal, with the specified
+	// height and width, if non-zero.
+	TTY    bool
+	Height uint
+	Width  uint
+
+	// Stdin, Stdout and Stderr are attached to the command.
+	// If Stdin is nil, the command does not read from stdin.
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// Execer is an optional interface implemented by engines
+// that can execute a command in the environment of a step
+// after the step has exited, for example, to debug a
+// failed step.
+type Execer interface {
+	// Exec executes the command in a copy of the step
+	// container, and returns the completion results.
+	Exec(context.Context, *Spec, *Step, *ExecOptions) (*State, error)
+}
+
+// Describer is an optional interface implemented by engines
+// that can describe the resources created for a pipeline,
+// without creating them, for example, in a dry run.
+type Describer interface {
+	// Describe returns the engine resources created for
+	// the pipeline.
+	Describe(*Spec) *Description
+}
+
+// Description describes the engine resources created for a
+// pipeline.
+type Description struct {
+	// Namespace is the namespace in which the pipeline
+	// resources are created.
+	Namespace string
+
+	// Volumes describes the source of each pipeline volume,
+	// by volume name.
+	Volumes map[string]string
+
+	// PullSecrets names the secrets used to pull images.
+	PullSecrets []string
+
+	// Networks names the networks created for the
+	// pipeline, if any.
+	Networks []string
+}
+
+// Digester is an optional interface implemented by engines
+// that can resolve the digest of the image used to create
+// the step container, before the step exits.
+type Digester interface {
+	// Digest returns the image digest of the step
+	// container.
+	Digest(context.Context, *Spec, *Step) (string, error)
+}
@@ -0,0 +1,184 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Drone Non-Commercial License
+// that can be found in the LICENSE file.
+
+package engine
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Output formats supported by WriteGraph.
+const (
+	GraphDOT     = "dot"
+	GraphMermaid = "mermaid"
+)
+
+// Step status of a completed run, which is written to the
+// log directory index, and used to color the graph nodes.
+const (
+	StatusSuccess    = "success"
+	StatusFailure    = "failure"
+	StatusSkipped    = "skipped"
+	StatusDetached   = "detached"
+	StatusIncomplete = "incomplete"
+)
+
+// graphStatus defines the order in which the node classes
+// are written.
+var graphStatus = []string{
+	StatusSuccess,
+	StatusFailure,
+	StatusSkipped,
+	StatusDetached,
+	StatusIncomplete,
+}
+
+// graphColors maps the step status to the node fill color.
+var graphColors = map[string]string{
+	StatusSuccess:    "#c8e6c9",
+	StatusFailure:    "#ffcdd2",
+	StatusSkipped:    "#eeeeee",
+	StatusDetached:   "#bbdefb",
+	StatusIncomplete: "#fff9c4",
+}
+
+// GraphOptions configures the step graph output.
+type GraphOptions struct {
+	// Format defines the output format, either dot or
+	// mermaid. The default format is dot.
+	Format string
+
+	// Status maps step names to the step status of a
+	// completed run, which is used to color the nodes.
+	// If empty, the nodes are not colored.
+	Status map[string]string
+}
+
+// graphEdge is a dependency between two steps.
+type graphEdge struct {
+	from, to int
+}
+
+// WriteGraph writes the step graph of the specification to
+// w, in Graphviz DOT or Mermaid format. Nodes are labeled
+// with the step name, image, run policy, and whether the
+// step is detached, and edges point from a dependency to
+// the dependent step. If the steps have no dependencies,
+// steps are executed in order, and each step is connected
+// to the following step.
+func WriteGraph(w io.Writer, spec *Spec, opts GraphOptions) error {
+	buf := bufio.NewWriter(w)
+	switch opts.Format {
+	case GraphDOT, "":
+		writeDOT(buf, spec, opts.Status)
+	case GraphMermaid:
+		writeMermaid(buf, spec, opts.Status)
+	default:
+		return fmt.Errorf("graph: unsupported output format %q", opts.Format)
+	}
+	return buf.Flush()
+}
+
+func writeDOT(w io.Writer, spec *Spec, status map[string]string) {
+	fmt.Fprintln(w, "digraph pipeline {")
+	fmt.Fprintln(w, "  node [shape=box];")
+	for _, step := range spec.Steps {
+		name := step.Metadata.Name
+		attrs := fmt.Sprintf("label=%s", quoteDOT(strings.Join(toGraphLabel(step), "\n")))
+		if color, ok := graphColors[status[name]]; ok {
+			attrs += fmt.Sprintf(", style=filled, fillcolor=%q", color)
+		}
+		fmt.Fprintf(w, "  %s [%s];\n", quoteDOT(name), attrs)
+	}
+	for _, edge := range toGraphEdges(spec) {
+		fmt.Fprintf(w, "  %s -> %s;\n",
+			quoteDOT(spec.Steps[edge.from].Metadata.Name),
+			quoteDOT(spec.Steps[edge.to].Metadata.Name),
+		)
+	}
+	fmt.Fprintln(w, "}")
+}
+
+func writeMermaid(w io.Writer, spec *Spec, status map[string]string) {
+	fmt.Fprintln(w, "graph TD")
+
+	// mermaid node identifiers cannot contain special
+	// characters, so nodes are identified by index.
+	classes := map[string]bool{}
+	for i, step := range spec.Steps {
+		fmt.Fprintf(w, "  n%d[\"%s\"]\n", i, quoteMermaid(strings.Join(toGraphLabel(step), "<br/>")))
+		if _, ok := graphColors[status[step.Metadata.Name]]; ok {
+			classes[status[step.Metadata.Name]] = true
+		}
+	}
+	for _, edge := range toGraphEdges(spec) {
+		fmt.Fprintf(w, "  n%d --> n%d\n", edge.from, edge.to)
+	}
+	for _, s := range graphStatus {
+		if classes[s] {
+			fmt.Fprintf(w, "  classDef %s fill:%s\n", s, graphColors[s])
+		}
+	}
+	for i, step := range spec.Steps {
+		if s := status[step.Metadata.Name]; classes[s] {
+			fmt.Fprintf(w, "  class n%d %s\n", i, s)
+		}
+	}
+}
+
+// helper function returns the node label lines for the
+// step.
+func toGraphLabel(step *Step) []string {
+	label := []string{step.Metadata.Name}
+	if step.Docker != nil && step.Docker.Image != "" {
+		label = append(label, step.Docker.Image)
+	}
+	label = append(label, "run: "+step.RunPolicy.String())
+	if step.Detach {
+		label = append(label, "detached")
+	}
+	return label
+}
+
+// helper function returns the graph edges. Dependencies on
+// unknown steps are ignored.
+func toGraphEdges(spec *Spec) []graphEdge {
+	index := map[string]int{}
+	for i, step := range spec.Steps {
+		index[step.Metadata.Name] = i
+	}
+	var edges []graphEdge
+	serial := true
+	for i, step := range spec.Steps {
+		for _, name := range step.DependsOn {
+			serial = false
+			if from, ok := index[name]; ok {
+				edges = append(edges, graphEdge{from, i})
+			}
+		}
+	}
+	if serial {
+		for i := 1; i < len(spec.Steps); i++ {
+			edges = append(edges, graphEdge{i - 1, i})
+		}
+	}
+	return edges
+}
+
+// helper function quotes the string as a DOT identifier.
+func quoteDOT(s string) string {
+	s = strings.Replace(s, `\`, `\\`, -1)
+	s = strings.Replace(s, `"`, `\"`, -1)
+	s = strings.Replace(s, "\n", `\n`, -1)
+	return `"` + s + `"`
+}
+
+// helper function escapes the string for use in a quoted
+// mermaid label.
+func quoteMermaid(s string) string {
+	return strings.Replace(s, `"`, "#quot;", -1)
+}
@@ -0,0 +1,112 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Drone Non-Commercial License
+// that can be found in the LICENSE file.
+
+package engine
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var graphSpec = &Spec{
+	Steps: []*Step{
+		{
+			Metadata: Metadata{Name: "redis"},
+			Docker:   &DockerStep{Image: "redis:4"},
+			Detach:   true,
+		},
+		{
+			Metadata:  Metadata{Name: "test"},
+			Docker:    &DockerStep{Image: "golang:1.12"},
+			DependsOn: []string{"redis"},
+		},
+		{
+			Metadata:  Metadata{Name: `say "hi"`},
+			DependsOn: []string{"test"},
+			RunPolicy: RunOnFailure,
+		},
+	},
+}
+
+func TestWriteGraphDOT(t *testing.T) {
+	want := `digraph pipeline {
+  node [shape=box];
+  "redis" [label="redis\nredis:4\nrun: on-success\ndetached", style=filled, fillcolor="#bbdefb"];
+  "test" [label="test\ngolang:1.12\nrun: on-success", style=filled, fillcolor="#ffcdd2"];
+  "say \"hi\"" [label="say \"hi\"\nrun: on-failure"];
+  "redis" -> "test";
+  "test" -> "say \"hi\"";
+}
+`
+	var buf bytes.Buffer
+	err := WriteGraph(&buf, graphSpec, GraphOptions{
+		Status: map[string]string{
+			"redis": "detached",
+			"test":  "failure",
+		},
+	})
+	if err != nil {
+		t.Error(err)
+	}
+	if diff := cmp.Diff(want, buf.String()); diff != "" {
+		t.Errorf("Unexpected dot graph")
+		t.Log(diff)
+	}
+}
+
+func TestWriteGraphMermaid(t *testing.T) {
+	want := `graph TD
+  n0["redis<br/>redis:4<br/>run: on-success<br/>detached"]
+  n1["test<br/>golang:1.12<br/>run: on-success"]
+  n2["say #quot;hi#quot;<br/>run: on-failure"]
+  n0 --> n1
+  n1 --> n2
+  classDef success fill:#c8e6c9
+  class n1 success
+`
+	var buf bytes.Buffer
+	err := WriteGraph(&buf, graphSpec, GraphOptions{
+		Format: GraphMermaid,
+		Status: map[string]string{"test": "success"},
+	})
+	if err != nil {
+		t.Error(err)
+	}
+	if diff := cmp.Diff(want, buf.String()); diff != "" {
+		t.Errorf("Unexpected mermaid graph")
+		t.Log(diff)
+	}
+}
+
+func TestWriteGraphSerial(t *testing.T) {
+	spec := &Spec{
+		Steps: []*Step{
+			{Metadata: Metadata{Name: "build"}},
+			{Metadata: Metadata{Name: "test"}},
+		},
+	}
+	want := `graph TD
+  n0["build<br/>run: on-success"]
+  n1["test<br/>run: on-success"]
+  n0 --> n1
+`
+	var buf bytes.Buffer
+	if err := WriteGraph(&buf, spec, GraphOptions{Format: GraphMermaid}); err != nil {
+		t.Error(err)
+	}
+	if diff := cmp.Diff(want, buf.String()); diff != "" {
+		t.Errorf("Unexpected serial graph")
+		t.Log(diff)
+	}
+}
+
+func TestWriteGraphFormat(t *testing.T) {
+	var buf bytes.Buffer
+	err := WriteGraph(&buf, graphSpec, GraphOptions{Format: "svg"})
+	if err == nil {
+		t.Errorf("Want error for unsupported format")
+	}
+}
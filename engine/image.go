@@ -0,0 +1,69 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Drone Non-Commercial License
+// that can be found in the LICENSE file.
+
+package engine
+
+import (
+	"strings"
+
+	"github.com/docker/distribution/reference"
+)
+
+// ParseImage parses the image and returns the canonical
+// image name, domain name, and whether or not the image tag
+// is :latest.
+func ParseImage(s string) (canonical, domain string, latest bool, err error) {
+	// parse the docker image name. We need to extract the
+	// image domain name and match to registry credentials
+	// stored in the .docker/config.json object.
+	named, err := reference.ParseNormalizedNamed(s)
+	if err != nil {
+		return
+	}
+	// the canonical image name, for some reason, excludes
+	// the tag name. So we need to make sure it is included
+	// in the image name so we can determine if the :latest
+	// tag is specified
+	named = reference.TagNameOnly(named)
+
+	return named.String(),
+		reference.Domain(named),
+		strings.HasSuffix(named.String(), ":latest"),
+		nil
+}
+
+// ImageDigest returns the expected image digest for the
+// step. The digest is sourced from the step digest or from
+// the image reference (e.g. image@sha256:...)
+func ImageDigest(step *Step) string {
+	if step.Docker.Digest != "" {
+		return step.Docker.Digest
+	}
+	named, err := reference.ParseNormalizedNamed(step.Docker.Image)
+	if err != nil {
+		return ""
+	}
+	if digested, ok := named.(reference.Digested); ok {
+		return digested.Digest().String()
+	}
+	return ""
+}
+
+// ShouldPull returns true if the step image is pulled
+// before the step container is created, even if the image
+// exists. The image is pulled if the pull policy is always,
+// or if the pull policy is default and the image tag is
+// :latest. Otherwise the image is only pulled if it does
+// not exist, unless the pull policy is never.
+func ShouldPull(step *Step) bool {
+	switch step.Docker.PullPolicy {
+	case PullAlways:
+		return true
+	case PullDefault:
+		_, _, latest, err := ParseImage(step.Docker.Image)
+		return err == nil && latest
+	default:
+		return false
+	}
+}
@@ -0,0 +1,113 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Drone Non-Commercial License
+// that can be found in the LICENSE file.
+
+package engine
+
+import "testing"
+
+func TestParseImage(t *testing.T) {
+	tests := []struct {
+		image     string
+		canonical string
+		domain    string
+		latest    bool
+		err       bool
+	}{
+		{
+			image:     "golang",
+			canonical: "docker.io/library/golang:latest",
+			domain:    "docker.io",
+			latest:    true,
+		},
+		{
+			image:     "golang:1.11",
+			canonical: "docker.io/library/golang:1.11",
+			domain:    "docker.io",
+			latest:    false,
+		},
+		{
+			image:     "golang@sha256:9e0d5d6b6d1a0ac8b4b1b5f9b0c6b6ba35e3b0c9c0c0f6e5d4c1d1d3d5b7b3f4",
+			canonical: "docker.io/library/golang@sha256:9e0d5d6b6d1a0ac8b4b1b5f9b0c6b6ba35e3b0c9c0c0f6e5d4c1d1d3d5b7b3f4",
+			domain:    "docker.io",
+			latest:    false,
+		},
+		{
+			image: "",
+			err:   true,
+		},
+	}
+
+	for _, test := range tests {
+		canonical, domain, latest, err := ParseImage(test.image)
+		if test.err {
+			if err == nil {
+				t.Errorf("Expect error parsing image %s", test.image)
+			}
+			continue
+		}
+		if err != nil {
+			t.Error(err)
+		}
+		if got, want := canonical, test.canonical; got != want {
+			t.Errorf("Want image %s, got %s", want, got)
+		}
+		if got, want := domain, test.domain; got != want {
+			t.Errorf("Want image domain %s, got %s", want, got)
+		}
+		if got, want := latest, test.latest; got != want {
+			t.Errorf("Want image latest %v, got %v", want, got)
+		}
+	}
+}
+
+func TestImageDigest(t *testing.T) {
+	const digest = "sha256:9e0d5d6b6d1a0ac8b4b1b5f9b0c6b6ba35e3b0c9c0c0f6e5d4c1d1d3d5b7b3f4"
+	tests := []struct {
+		image  string
+		digest string
+		want   string
+	}{
+		{image: "golang:1.11", want: ""},
+		{image: "golang:1.11", digest: digest, want: digest},
+		{image: "golang@" + digest, want: digest},
+		{image: "", want: ""},
+	}
+	for _, test := range tests {
+		step := &Step{
+			Docker: &DockerStep{
+				Image:  test.image,
+				Digest: test.digest,
+			},
+		}
+		if got := ImageDigest(step); got != test.want {
+			t.Errorf("Want digest %q, got %q", test.want, got)
+		}
+	}
+}
+
+func TestShouldPull(t *testing.T) {
+	tests := []struct {
+		image  string
+		policy PullPolicy
+		want   bool
+	}{
+		{image: "golang", policy: PullDefault, want: true},
+		{image: "golang:latest", policy: PullDefault, want: true},
+		{image: "golang:1.11", policy: PullDefault, want: false},
+		{image: "golang:1.11", policy: PullAlways, want: true},
+		{image: "golang", policy: PullIfNotExists, want: false},
+		{image: "golang", policy: PullNever, want: false},
+	}
+	for _, test := range tests {
+		step := &Step{
+			Docker: &DockerStep{
+				Image:      test.image,
+				PullPolicy: test.policy,
+			},
+		}
+		if got := ShouldPull(step); got != test.want {
+			t.Errorf("Want pull %v for image %s with policy %s, got %v", test.want, test.image, test.policy, got)
+		}
+	}
+}
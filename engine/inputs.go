@@ -0,0 +1,87 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Drone Non-Commercial License
+// that can be found in the LICENSE file.
+
+package engine
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// Affected returns the names of the steps affected by
+// changes to the host paths. A step is affected if one of
+// its inputs matches a changed path, or if the step depends
+// on an affected step. An input matches a path if the input
+// is the path, is a parent directory of the path, or is a
+// glob pattern that matches the path. If the steps have no
+// dependencies, steps are executed in order, and steps that
+// follow an affected step are affected.
+func Affected(spec *Spec, paths []string) []string {
+	affected := map[string]bool{}
+	for _, step := range spec.Steps {
+		for _, input := range step.Inputs {
+			if matchAny(input, paths) {
+				affected[step.Metadata.Name] = true
+				break
+			}
+		}
+	}
+
+	serial := true
+	for _, step := range spec.Steps {
+		if len(step.DependsOn) != 0 {
+			serial = false
+		}
+	}
+
+	var names []string
+	for i, step := range spec.Steps {
+		name := step.Metadata.Name
+		switch {
+		case affected[name]:
+		case serial && i > 0 && affected[spec.Steps[i-1].Metadata.Name]:
+			affected[name] = true
+		case !serial && dependsOnAny(spec, step, affected, map[string]bool{}):
+			affected[name] = true
+		default:
+			continue
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+// helper function returns true if the step depends on an
+// affected step, directly or indirectly.
+func dependsOnAny(spec *Spec, step *Step, affected, visited map[string]bool) bool {
+	for _, name := range step.DependsOn {
+		if affected[name] {
+			return true
+		}
+		if visited[name] {
+			continue
+		}
+		visited[name] = true
+		if dep, ok := LookupStep(spec, name); ok && dependsOnAny(spec, dep, affected, visited) {
+			return true
+		}
+	}
+	return false
+}
+
+// helper function returns true if the input matches any
+// of the paths.
+func matchAny(input string, paths []string) bool {
+	input = filepath.Clean(input)
+	for _, path := range paths {
+		path = filepath.Clean(path)
+		if path == input || strings.HasPrefix(path, input+string(filepath.Separator)) {
+			return true
+		}
+		if ok, _ := filepath.Match(input, path); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,56 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Drone Non-Commercial License
+// that can be found in the LICENSE file.
+
+package engine
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestAffected(t *testing.T) {
+	spec := &Spec{
+		Steps: []*Step{
+			{Metadata: Metadata{Name: "frontend"}, Inputs: []string{"/src/web"}},
+			{Metadata: Metadata{Name: "backend"}, Inputs: []string{"/src/*.go"}},
+			{Metadata: Metadata{Name: "test"}, DependsOn: []string{"backend"}},
+			{Metadata: Metadata{Name: "deploy"}, DependsOn: []string{"test", "frontend"}},
+		},
+	}
+
+	tests := []struct {
+		paths []string
+		want  []string
+	}{
+		{[]string{"/src/web/index.html"}, []string{"frontend", "deploy"}},
+		{[]string{"/src/main.go"}, []string{"backend", "test", "deploy"}},
+		{[]string{"/src/web"}, []string{"frontend", "deploy"}},
+		{[]string{"/src/webapp/index.html"}, nil},
+		{[]string{"/src/pkg/main.go"}, nil},
+	}
+	for _, test := range tests {
+		got := Affected(spec, test.paths)
+		if diff := cmp.Diff(test.want, got); diff != "" {
+			t.Errorf("Unexpected steps affected by %v", test.paths)
+			t.Log(diff)
+		}
+	}
+}
+
+func TestAffectedSerial(t *testing.T) {
+	spec := &Spec{
+		Steps: []*Step{
+			{Metadata: Metadata{Name: "lint"}, Inputs: []string{"/src/.lint"}},
+			{Metadata: Metadata{Name: "build"}, Inputs: []string{"/src"}},
+			{Metadata: Metadata{Name: "test"}},
+		},
+	}
+	got := Affected(spec, []string{"/src/main.go"})
+	want := []string{"build", "test"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Want steps that follow an affected step affected")
+		t.Log(diff)
+	}
+}
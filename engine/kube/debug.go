@@ -5,12 +5,16 @@
 package kube
 
 import (
-	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
 
 	"github.com/drone/drone-runtime/engine"
 	"github.com/ghodss/yaml"
+
 	"k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 )
 
 const (
@@ -18,67 +22,159 @@ const (
 	documentEnd   = "...\n"
 )
 
-// Print encodes returns specification as a Kubernetes
-// multi-document yaml configuration file, in string format.
-func Print(spec *engine.Spec) string {
-	buf := new(bytes.Buffer)
-
-	//
-	// Secret Encoding.
-	//
-
-	for _, secret := range spec.Secrets {
-		buf.WriteString(documentBegin)
-		res := toSecret(spec, secret)
-		res.Namespace = spec.Metadata.Namespace
-		res.Kind = "Secret"
-		res.Type = "Opaque"
-		raw, _ := yaml.Marshal(res)
-		buf.Write(raw)
-	}
-
-	//
-	// Config Map Encoding.
-	//
-
-	for _, file := range spec.Files {
-		res := &v1.ConfigMap{
-			ObjectMeta: metav1.ObjectMeta{
-				Name: file.Metadata.UID,
-			},
-			Data: map[string]string{
-				file.Metadata.UID: string(file.Data),
-			},
+// Output formats supported by Print.
+const (
+	FormatYAML = "yaml"
+	FormatJSON = "json"
+)
+
+// PrintOptions configures the Kubernetes manifest output.
+type PrintOptions struct {
+	// Format defines the output format, either yaml or
+	// json. The default format is yaml.
+	Format string
+
+	// Step limits the output to the objects created for
+	// the named step. If empty, all objects are written.
+	Step string
+}
+
+// Print writes the Kubernetes objects created for the
+// specification to w, as a multi-document yaml file or as
+// a json list. The output includes every object created
+// by the engine when the pipeline is executed. The service
+// account and image pull secrets are copied from the source
+// namespace when the pipeline is executed, and are written
+// without the source labels and secret data.
+func Print(w io.Writer, spec *engine.Spec, popts PrintOptions, opts ...Option) error {
+	e := &kubeEngine{options: defaultOptions()}
+	for _, opt := range opts {
+		opt(e)
+	}
+
+	objects, err := toObjects(spec, popts.Step, &e.options)
+	if err != nil {
+		return err
+	}
+	for _, obj := range objects {
+		setTypeMeta(obj)
+	}
+
+	switch popts.Format {
+	case FormatYAML, "":
+		return printYAML(w, objects)
+	case FormatJSON:
+		return printJSON(w, objects)
+	default:
+		return fmt.Errorf("kubernetes: unsupported output format %q", popts.Format)
+	}
+}
+
+// helper function returns the kubernetes objects for the
+// specification. If a step name is provided, only the
+// objects created for the step are returned.
+func toObjects(spec *engine.Spec, name string, opts *options) ([]runtime.Object, error) {
+	if name != "" {
+		if opts.singlePod {
+			return nil, fmt.Errorf("kubernetes: cannot render a single step in single pod mode")
 		}
-		res.Namespace = spec.Metadata.Namespace
-		res.Kind = "ConfigMap"
-		buf.WriteString(documentBegin)
-		raw, _ := yaml.Marshal(res)
-		buf.Write(raw)
+		step, ok := lookupStep(spec, name)
+		if !ok {
+			return nil, fmt.Errorf("kubernetes: step %q not found", name)
+		}
+		return toStepObjects(spec, step, opts), nil
+	}
+
+	if err := checkPullSecrets(spec, opts); err != nil {
+		return nil, err
+	}
+	objects := []runtime.Object{toNamespace(spec, opts)}
+	setup, err := toSetupObjects(spec, opts)
+	if err != nil {
+		return nil, err
 	}
+	objects = append(objects, setup...)
+	account, secrets := toSourceObjects(spec, opts)
+	scheduling, err := toSchedulingObjects(toNamespaceName(spec, opts), account, secrets)
+	if err != nil {
+		return nil, err
+	}
+	objects = append(objects, scheduling...)
+	if opts.singlePod {
+		return append(objects, toPipelinePod(spec, opts)), nil
+	}
+	for _, step := range spec.Steps {
+		objects = append(objects, toStepObjects(spec, step, opts)...)
+	}
+	return objects, nil
+}
 
-	//
-	// Step Encoding.
-	//
+// helper function returns placeholders for the service
+// account and image pull secrets in the source namespace,
+// which are not read when the objects are printed.
+func toSourceObjects(spec *engine.Spec, opts *options) (*v1.ServiceAccount, []*v1.Secret) {
+	var account *v1.ServiceAccount
+	if name := opts.serviceAccount; name != "" {
+		account = &v1.ServiceAccount{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+		}
+	}
+	var secrets []*v1.Secret
+	for _, name := range toScheduling(spec, opts).ImagePullSecrets {
+		secrets = append(secrets, &v1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Type:       v1.SecretTypeDockerConfigJson,
+		})
+	}
+	return account, secrets
+}
 
+// helper function returns the named step.
+func lookupStep(spec *engine.Spec, name string) (*engine.Step, bool) {
 	for _, step := range spec.Steps {
-		buf.WriteString(documentBegin)
-		res := toPod(spec, step)
-		res.Namespace = spec.Metadata.Namespace
-		res.Kind = "Pod"
-		raw, _ := yaml.Marshal(res)
-		buf.Write(raw)
-
-		if len(step.Docker.Ports) != 0 {
-			buf.WriteString(documentBegin)
-			res := toService(spec, step)
-			res.Namespace = spec.Metadata.Namespace
-			res.Kind = "Service"
-			raw, _ := yaml.Marshal(res)
-			buf.Write(raw)
+		if step.Metadata.Name == name {
+			return step, true
 		}
 	}
+	return nil, false
+}
 
-	buf.WriteString(documentEnd)
-	return buf.String()
+// helper function writes the objects as a multi-document
+// yaml file.
+func printYAML(w io.Writer, objects []runtime.Object) error {
+	for _, obj := range objects {
+		raw, err := yaml.Marshal(obj)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(w, documentBegin); err != nil {
+			return err
+		}
+		if _, err := w.Write(raw); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(w, documentEnd)
+	return err
+}
+
+// helper function writes the objects as a json list.
+func printJSON(w io.Writer, objects []runtime.Object) error {
+	list := &v1.List{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "List",
+			APIVersion: "v1",
+		},
+		Items: []runtime.RawExtension{},
+	}
+	for _, obj := range objects {
+		list.Items = append(list.Items, runtime.RawExtension{Object: obj})
+	}
+	raw, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+	raw = append(raw, '\n')
+	_, err = w.Write(raw)
+	return err
 }
@@ -0,0 +1,131 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Drone Non-Commercial License
+// that can be found in the LICENSE file.
+
+package kube
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/drone/drone-runtime/engine"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var update = flag.Bool("update", false, "update the golden files")
+
+func TestPrint(t *testing.T) {
+	matches, err := filepath.Glob("../../samples/kubernetes/*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) == 0 {
+		t.Fatal("no sample files found")
+	}
+	for _, match := range matches {
+		spec, err := engine.ParseFile(match)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		name := strings.TrimSuffix(filepath.Base(match), ".json")
+		for _, format := range []string{FormatYAML, FormatJSON} {
+			buf := new(bytes.Buffer)
+			err := Print(buf, spec, PrintOptions{Format: format})
+			if err != nil {
+				t.Errorf("%s: %s", match, err)
+				continue
+			}
+			golden := filepath.Join("testdata", name+"."+format)
+			testGolden(t, golden, buf.Bytes())
+		}
+	}
+}
+
+func TestPrintStep(t *testing.T) {
+	spec, err := engine.ParseFile("../../samples/kubernetes/2_redis.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := new(bytes.Buffer)
+	err = Print(buf, spec, PrintOptions{Step: "redis"})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	testGolden(t, filepath.Join("testdata", "2_redis_step.yaml"), buf.Bytes())
+
+	err = Print(buf, spec, PrintOptions{Step: "unknown"})
+	if err == nil {
+		t.Errorf("Want error when step not found")
+	}
+}
+
+func TestPrintSchedulingObjects(t *testing.T) {
+	spec := &engine.Spec{
+		Metadata: engine.Metadata{UID: "uid-pipeline", Namespace: "ns-pipeline"},
+		Docker:   &engine.DockerConfig{},
+		Kube:     &engine.KubeConfig{ImagePullSecrets: []string{"mirror"}},
+	}
+	buf := new(bytes.Buffer)
+	err := Print(buf, spec, PrintOptions{},
+		WithServiceAccount("drone"),
+		WithImagePullSecrets("registry"),
+		WithAllowedPullSecrets("mirror"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := documentBegin +
+		"apiVersion: v1\nkind: Namespace\nmetadata:\n  creationTimestamp: null\n  name: ns-pipeline\nspec: {}\nstatus: {}\n" +
+		documentBegin +
+		"apiVersion: v1\nkind: ServiceAccount\nmetadata:\n  creationTimestamp: null\n  name: drone\n  namespace: ns-pipeline\n" +
+		documentBegin +
+		"apiVersion: v1\nkind: Secret\nmetadata:\n  creationTimestamp: null\n  name: registry\n  namespace: ns-pipeline\ntype: kubernetes.io/dockerconfigjson\n" +
+		documentBegin +
+		"apiVersion: v1\nkind: Secret\nmetadata:\n  creationTimestamp: null\n  name: mirror\n  namespace: ns-pipeline\ntype: kubernetes.io/dockerconfigjson\n" +
+		documentEnd
+	if diff := cmp.Diff(want, buf.String()); diff != "" {
+		t.Errorf("Unexpected scheduling objects")
+		t.Log(diff)
+	}
+
+	// the pipeline cannot name a secret that is not
+	// allowed by the engine.
+	err = Print(new(bytes.Buffer), spec, PrintOptions{}, WithImagePullSecrets("registry"))
+	if err == nil {
+		t.Errorf("Want error printing a pull secret that is not allowed")
+	}
+}
+
+func TestPrintFormat(t *testing.T) {
+	err := Print(new(bytes.Buffer), &engine.Spec{}, PrintOptions{Format: "toml"})
+	if err == nil {
+		t.Errorf("Want error for unsupported format")
+	}
+}
+
+// helper function compares the output to the golden file,
+// or updates the golden file if the update flag is set.
+func testGolden(t *testing.T, golden string, got []byte) {
+	if *update {
+		if err := ioutil.WriteFile(golden, got, 0644); err != nil {
+			t.Error(err)
+		}
+		return
+	}
+	want, err := ioutil.ReadFile(golden)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if diff := cmp.Diff(string(want), string(got)); diff != "" {
+		t.Errorf("Unexpected output for %s", golden)
+		t.Log(diff)
+	}
+}
@@ -0,0 +1,58 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Drone Non-Commercial License
+// that can be found in the LICENSE file.
+
+package kube
+
+import (
+	"fmt"
+
+	"github.com/drone/drone-runtime/engine"
+
+	"k8s.io/api/core/v1"
+)
+
+// Describe returns the namespace, volume sources and image
+// pull secrets used to execute the pipeline.
+func (e *kubeEngine) Describe(spec *engine.Spec) *engine.Description {
+	// the kubernetes engine does not create networks.
+	d := &engine.Description{
+		Namespace: toNamespaceName(spec, &e.options),
+		Volumes:   map[string]string{},
+	}
+	for _, ref := range toPullSecrets(spec, toScheduling(spec, &e.options)) {
+		d.PullSecrets = append(d.PullSecrets, ref.Name)
+	}
+	if spec.Docker != nil {
+		for _, vol := range spec.Docker.Volumes {
+			d.Volumes[vol.Metadata.Name] = toVolumeDescription(spec, vol, &e.options)
+		}
+	}
+	return d
+}
+
+// helper function returns a description of the kubernetes
+// volume source used for the volume.
+func toVolumeDescription(spec *engine.Spec, vol *engine.Volume, opts *options) string {
+	switch {
+	case vol.HostPath != nil:
+		return "host " + vol.HostPath.Path
+	case vol.EmptyDir == nil:
+		return ""
+	}
+	source := toEmptyDirSource(spec, vol, opts)
+	switch {
+	case source.PersistentVolumeClaim != nil:
+		claim := toPersistentVolumeClaim(spec, vol, opts)
+		size := claim.Spec.Resources.Requests[v1.ResourceStorage]
+		class := "default"
+		if claim.Spec.StorageClassName != nil {
+			class = *claim.Spec.StorageClassName
+		}
+		return fmt.Sprintf("claim %s, class %s, size %s", claim.Name, class, size.String())
+	case source.HostPath != nil:
+		return "host " + source.HostPath.Path
+	default:
+		return "empty_dir"
+	}
+}
@@ -0,0 +1,52 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Drone Non-Commercial License
+// that can be found in the LICENSE file.
+
+package kube
+
+import (
+	"testing"
+
+	"github.com/drone/drone-runtime/engine"
+
+	"github.com/google/go-cmp/cmp"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestDescribe(t *testing.T) {
+	spec := &engine.Spec{
+		Metadata: engine.Metadata{Namespace: "ns-pipeline"},
+		Docker: &engine.DockerConfig{
+			Auths: []*engine.DockerAuth{{Address: "gcr.io"}},
+			Volumes: []*engine.Volume{
+				{
+					Metadata: engine.Metadata{UID: "uid-cache", Name: "cache"},
+					EmptyDir: &engine.VolumeEmptyDir{},
+				},
+				{
+					Metadata: engine.Metadata{UID: "uid-docker", Name: "docker"},
+					HostPath: &engine.VolumeHostPath{Path: "/var/run/docker.sock"},
+				},
+			},
+		},
+	}
+	e := New(fake.NewSimpleClientset(),
+		WithVolumeClaim("fast", resource.MustParse("5Gi")),
+		WithImagePullSecrets("mirror"),
+	).(*kubeEngine)
+
+	want := &engine.Description{
+		Namespace: "ns-pipeline",
+		Volumes: map[string]string{
+			"cache":  "claim uid-cache, class fast, size 5Gi",
+			"docker": "host /var/run/docker.sock",
+		},
+		PullSecrets: []string{"docker-auth-config", "mirror"},
+	}
+	got := e.Describe(spec)
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Unexpected description")
+		t.Log(diff)
+	}
+}
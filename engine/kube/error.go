@@ -0,0 +1,25 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Drone Non-Commercial License
+// that can be found in the LICENSE file.
+
+package kube
+
+import "fmt"
+
+// A PodError reports the pod cannot be started, or was
+// terminated by the system. For example, the image cannot
+// be pulled, the pod cannot be scheduled, or the pod was
+// evicted from the node.
+type PodError struct {
+	Name    string
+	Reason  string
+	Message string
+}
+
+// Error returns the error message in string format.
+func (e *PodError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("%s : %s", e.Name, e.Reason)
+	}
+	return fmt.Sprintf("%s : %s: %s", e.Name, e.Reason, e.Message)
+}
@@ -0,0 +1,25 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Drone Non-Commercial License
+// that can be found in the LICENSE file.
+
+package kube
+
+import "testing"
+
+func TestPodError(t *testing.T) {
+	err := PodError{
+		Name:    "build",
+		Reason:  "ErrImagePull",
+		Message: "image not found",
+	}
+	got, want := err.Error(), "build : ErrImagePull: image not found"
+	if got != want {
+		t.Errorf("Want error message %q, got %q", want, got)
+	}
+
+	err.Message = ""
+	got, want = err.Error(), "build : ErrImagePull"
+	if got != want {
+		t.Errorf("Want error message %q, got %q", want, got)
+	}
+}
@@ -0,0 +1,196 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Drone Non-Commercial License
+// that can be found in the LICENSE file.
+
+package kube
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+
+	"github.com/drone/drone-runtime/engine"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/remotecommand"
+	"k8s.io/client-go/util/exec"
+)
+
+// debugScript defines the script executed by the debug pod
+// with the entrypoint shim, which keeps the pod running
+// until it is removed, regardless of the step image.
+const debugScript = `trap 'exit 0' TERM
+%s/busybox sleep 2147483647 &
+wait`
+
+// Exec executes the command in a new pod, created with the
+// step configuration and volumes. The command is executed
+// with the pod exec subresource, and the pod is removed
+// when the command exits. Note that changes made by the
+// step to the container file system are not copied.
+func (e *kubeEngine) Exec(ctx context.Context, spec *engine.Spec, step *engine.Step, opts *engine.ExecOptions) (*engine.State, error) {
+	if e.config == nil {
+		return nil, errors.New("kubernetes: executing commands requires a rest client configuration")
+	}
+	if step.Docker == nil {
+		return nil, errors.New("engine: missing docker configuration")
+	}
+
+	pod := toDebugPod(spec, step, &e.options)
+	pods := e.client.CoreV1().Pods(pod.Namespace)
+	if _, err := pods.Create(pod); err != nil {
+		return nil, err
+	}
+	defer pods.Delete(pod.Name, &metav1.DeleteOptions{})
+
+	watcher, err := e.watcher(spec)
+	if err != nil {
+		return nil, err
+	}
+	_, err = watcher.wait(ctx, pod.Name, func(pod *v1.Pod) (bool, error) {
+		if err := toPodError(step, pod, e.scheduleTimeout); err != nil {
+			return false, err
+		}
+		switch pod.Status.Phase {
+		case v1.PodRunning:
+			return true, nil
+		case v1.PodSucceeded, v1.PodFailed, v1.PodUnknown:
+			return false, errors.New("kubernetes: the debug pod exited before the command was executed")
+		}
+		return false, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return execStream(ctx, e.config, pod, opts)
+}
+
+// helper function returns the pod used to execute commands
+// in the environment of the step. The step container is
+// kept running with the entrypoint shim, which does not
+// depend on a shell in the step image.
+func toDebugPod(spec *engine.Spec, step *engine.Step, opts *options) *v1.Pod {
+	pod := toPod(spec, step, opts)
+	pod.Name = step.Metadata.UID + "-debug"
+
+	// the debug pod must not be selected by the step
+	// service.
+	delete(pod.Labels, stepLabel)
+
+	pod.Spec.InitContainers = append(pod.Spec.InitContainers, toShimContainer(opts))
+	pod.Spec.Volumes = append(pod.Spec.Volumes, toShimVolume())
+
+	container := &pod.Spec.Containers[0]
+	container.Command = []string{
+		path.Join(shimPath, "busybox"), "sh", "-c",
+		fmt.Sprintf(debugScript, shimPath),
+	}
+	container.Args = nil
+	container.Ports = nil
+	container.VolumeMounts = append(container.VolumeMounts, toShimMount())
+	return pod
+}
+
+// helper function executes the command in the first
+// container of the pod, and streams the command input and
+// output until the command exits.
+func execStream(ctx context.Context, config *rest.Config, pod *v1.Pod, opts *engine.ExecOptions) (*engine.State, error) {
+	client, err := toRESTClient(config)
+	if err != nil {
+		return nil, err
+	}
+	req := client.Post().
+		Namespace(pod.Namespace).
+		Resource("pods").
+		Name(pod.Name).
+		SubResource("exec").
+		VersionedParams(&v1.PodExecOptions{
+			Container: pod.Spec.Containers[0].Name,
+			Command:   opts.Command,
+			Stdin:     opts.Stdin != nil,
+			Stdout:    true,
+			// stderr is merged with stdout when a tty is
+			// allocated.
+			Stderr: !opts.TTY,
+			TTY:    opts.TTY,
+		}, scheme.ParameterCodec)
+
+	executor, err := remotecommand.NewSPDYExecutor(config, "POST", req.URL())
+	if err != nil {
+		return nil, err
+	}
+
+	streamopts := remotecommand.StreamOptions{
+		Stdin:  opts.Stdin,
+		Stdout: opts.Stdout,
+		Stderr: opts.Stderr,
+		Tty:    opts.TTY,
+	}
+	if opts.TTY && opts.Height != 0 && opts.Width != 0 {
+		streamopts.TerminalSizeQueue = newSizeQueue(opts.Width, opts.Height)
+	}
+	if streamopts.Stderr == nil && !opts.TTY {
+		streamopts.Stderr = streamopts.Stdout
+	}
+
+	// the stream does not accept a context, and is closed
+	// when the debug pod is removed if the context is
+	// cancelled.
+	errc := make(chan error, 1)
+	go func() {
+		errc <- executor.Stream(streamopts)
+	}()
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case err := <-errc:
+		return toExecState(err)
+	}
+}
+
+// helper function returns a rest client for the core api
+// group, used to create the pod exec request.
+func toRESTClient(config *rest.Config) (*rest.RESTClient, error) {
+	copy := *config
+	copy.APIPath = "/api"
+	copy.GroupVersion = &v1.SchemeGroupVersion
+	copy.NegotiatedSerializer = scheme.Codecs
+	return rest.RESTClientFor(&copy)
+}
+
+// helper function returns the command exit state from the
+// error returned by the exec stream.
+func toExecState(err error) (*engine.State, error) {
+	if err == nil {
+		return &engine.State{Exited: true}, nil
+	}
+	if exit, ok := err.(exec.CodeExitError); ok {
+		return &engine.State{Exited: true, ExitCode: exit.Code}, nil
+	}
+	return nil, err
+}
+
+// sizeQueue returns the terminal size once, which is the
+// only size known when the command is executed.
+type sizeQueue chan remotecommand.TerminalSize
+
+func newSizeQueue(width, height uint) sizeQueue {
+	q := make(sizeQueue, 1)
+	q <- remotecommand.TerminalSize{Width: uint16(width), Height: uint16(height)}
+	close(q)
+	return q
+}
+
+// Next returns the terminal size, or nil when the queue is
+// empty, which stops the terminal resize monitor.
+func (q sizeQueue) Next() *remotecommand.TerminalSize {
+	size, ok := <-q
+	if !ok {
+		return nil
+	}
+	return &size
+}
@@ -0,0 +1,205 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Drone Non-Commercial License
+// that can be found in the LICENSE file.
+
+package kube
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/drone/drone-runtime/engine"
+
+	"github.com/google/go-cmp/cmp"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/httpstream"
+	"k8s.io/apimachinery/pkg/util/httpstream/spdy"
+	"k8s.io/apimachinery/pkg/util/remotecommand"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/util/exec"
+)
+
+func TestToDebugPod(t *testing.T) {
+	opts := defaultOptions()
+	pod := toDebugPod(testSpec, testStep, &opts)
+	if got, want := pod.Name, "uid-step-debug"; got != want {
+		t.Errorf("Want debug pod name %q, got %q", want, got)
+	}
+	if _, ok := pod.Labels[stepLabel]; ok {
+		t.Errorf("Want debug pod not selected by the step service")
+	}
+	container := pod.Spec.Containers[0]
+	if got, want := container.Image, testStep.Docker.Image; got != want {
+		t.Errorf("Want debug pod image %q, got %q", want, got)
+	}
+
+	// the debug container is kept running by the shim,
+	// which does not depend on a shell in the step image.
+	if got, want := container.Command[0], "/usr/drone/bin/busybox"; got != want {
+		t.Errorf("Want debug command executed by the shim, got %q", got)
+	}
+	if len(container.Args) != 0 {
+		t.Errorf("Want step arguments removed from the debug container")
+	}
+	if got, want := len(pod.Spec.InitContainers), 1; got != want {
+		t.Errorf("Want shim init container")
+	} else if got, want := pod.Spec.InitContainers[0].Image, defaultInitImage; got != want {
+		t.Errorf("Want shim init image %q, got %q", want, got)
+	}
+	if got, want := len(pod.Spec.Volumes), 2; got != want {
+		t.Errorf("Want debug pod volumes copied from the step, and the shim volume")
+	}
+	if got, want := pod.Spec.RestartPolicy, v1.RestartPolicyNever; got != want {
+		t.Errorf("Want debug pod never restarted")
+	}
+}
+
+func TestToExecState(t *testing.T) {
+	tests := []struct {
+		err   error
+		state *engine.State
+		fail  bool
+	}{
+		{
+			err:   nil,
+			state: &engine.State{Exited: true},
+		},
+		{
+			err:   exec.CodeExitError{Err: errors.New("exit"), Code: 2},
+			state: &engine.State{Exited: true, ExitCode: 2},
+		},
+		{
+			err:  errors.New("container not found"),
+			fail: true,
+		},
+	}
+	for _, test := range tests {
+		state, err := toExecState(test.err)
+		if test.fail != (err != nil) {
+			t.Errorf("Want error %v for %v, got %v", test.fail, test.err, err)
+			continue
+		}
+		if diff := cmp.Diff(test.state, state); diff != "" {
+			t.Errorf("Unexpected state for %v", test.err)
+			t.Log(diff)
+		}
+	}
+}
+
+// helper function returns a test server that implements the
+// pod exec subresource. The server echoes stdin to stdout,
+// and exits with exit code 3.
+func newExecServer(query *string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*query = r.URL.RawQuery
+		_, err := httpstream.Handshake(r, w, []string{remotecommand.StreamProtocolV4Name})
+		if err != nil {
+			return
+		}
+		streams := make(chan httpstream.Stream, 4)
+		conn := spdy.NewResponseUpgrader().UpgradeResponse(w, r,
+			func(stream httpstream.Stream, replySent <-chan struct{}) error {
+				streams <- stream
+				return nil
+			},
+		)
+		if conn == nil {
+			return
+		}
+		defer conn.Close()
+
+		byType := map[string]httpstream.Stream{}
+		for len(byType) < 4 {
+			stream := <-streams
+			byType[stream.Headers().Get(v1.StreamType)] = stream
+		}
+		stdin, _ := ioutil.ReadAll(byType[v1.StreamTypeStdin])
+		byType[v1.StreamTypeStdout].Write(stdin)
+		byType[v1.StreamTypeStderr].Write([]byte("warning"))
+		byType[v1.StreamTypeError].Write([]byte(
+			`{"status":"Failure","reason":"NonZeroExitCode","details":{"causes":[{"reason":"ExitCode","message":"3"}]}}`,
+		))
+		for _, stream := range byType {
+			stream.Close()
+		}
+	}))
+}
+
+func TestExec(t *testing.T) {
+	var query string
+	server := newExecServer(&query)
+	defer server.Close()
+
+	e, client := newTestEngine(t, WithRestConfig(&rest.Config{Host: server.URL}))
+	defer e.Destroy(context.Background(), testSpec)
+
+	// the debug pod is running after a short delay.
+	go func() {
+		pods := client.CoreV1().Pods(testSpec.Metadata.Namespace)
+		for {
+			time.Sleep(10 * time.Millisecond)
+			pod, err := pods.Get("uid-step-debug", metav1.GetOptions{})
+			if err != nil {
+				continue
+			}
+			pod.Status.Phase = v1.PodRunning
+			pods.UpdateStatus(pod)
+			return
+		}
+	}()
+
+	var stdout, stderr bytes.Buffer
+	state, err := e.Exec(context.Background(), testSpec, testStep, &engine.ExecOptions{
+		Command: []string{"/bin/sh", "-c", "cat"},
+		Stdin:   bytes.NewBufferString("hello"),
+		Stdout:  &stdout,
+		Stderr:  &stderr,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := state.ExitCode, 3; got != want {
+		t.Errorf("Want exit code %d, got %d", want, got)
+	}
+	if got, want := stdout.String(), "hello"; got != want {
+		t.Errorf("Want stdout %q, got %q", want, got)
+	}
+	if got, want := stderr.String(), "warning"; got != want {
+		t.Errorf("Want stderr %q, got %q", want, got)
+	}
+	if got, want := query, "command=%2Fbin%2Fsh&command=-c&command=cat&container=uid-step&stderr=true&stdin=true&stdout=true"; got != want {
+		t.Errorf("Want exec query %q, got %q", want, got)
+	}
+
+	// the debug pod is removed when the command exits.
+	if _, err := client.CoreV1().Pods(testSpec.Metadata.Namespace).Get("uid-step-debug", metav1.GetOptions{}); err == nil {
+		t.Errorf("Want debug pod removed")
+	}
+}
+
+func TestExecNoConfig(t *testing.T) {
+	e, _ := newTestEngine(t)
+	defer e.Destroy(context.Background(), testSpec)
+
+	_, err := e.Exec(context.Background(), testSpec, testStep, &engine.ExecOptions{})
+	if err == nil {
+		t.Errorf("Want error executing without a rest configuration")
+	}
+}
+
+func TestSizeQueue(t *testing.T) {
+	q := newSizeQueue(80, 24)
+	if size := q.Next(); size == nil || size.Width != 80 || size.Height != 24 {
+		t.Errorf("Want terminal size 80x24, got %v", size)
+	}
+	if size := q.Next(); size != nil {
+		t.Errorf("Want nil size when the queue is empty")
+	}
+}
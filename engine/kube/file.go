@@ -0,0 +1,265 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Drone Non-Commercial License
+// that can be found in the LICENSE file.
+
+package kube
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/drone/drone-runtime/engine"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+const (
+	// defaultInitImage defines the default image used to
+	// write files to the pod file system.
+	defaultInitImage = "busybox:1"
+
+	// filesVolume defines the name of the emptyDir volume
+	// in which files are written.
+	filesVolume = "drone-files"
+
+	// filesPath defines the path at which the files volume
+	// is mounted in the init container.
+	filesPath = "/drone/files"
+
+	// chunksPath defines the path at which the file chunks
+	// are mounted in the init container.
+	chunksPath = "/drone/chunks"
+)
+
+// fileChunkSize defines the maximum size of file data
+// stored in a single config map or secret. Kubernetes
+// limits the size of these objects to 1MB, including the
+// object metadata. Larger files are split into chunks.
+var fileChunkSize = 960 * 1024
+
+// helper function returns true if the file must be split
+// into multiple chunks.
+func isChunked(file *engine.File) bool {
+	return len(file.Data) > fileChunkSize
+}
+
+// helper function splits the file data into chunks.
+func toChunks(file *engine.File) [][]byte {
+	if !isChunked(file) {
+		return [][]byte{file.Data}
+	}
+	var chunks [][]byte
+	for data := file.Data; len(data) > 0; {
+		n := fileChunkSize
+		if n > len(data) {
+			n = len(data)
+		}
+		chunks = append(chunks, data[:n])
+		data = data[n:]
+	}
+	return chunks
+}
+
+// helper function returns the name of the config map or
+// secret that stores the file chunk.
+func toChunkName(file *engine.File, index int) string {
+	if !isChunked(file) {
+		return file.Metadata.UID
+	}
+	return fmt.Sprintf("%s-%d", file.Metadata.UID, index)
+}
+
+// helper function returns the kubernetes objects used to
+// store the file. Sensitive files are stored as secrets,
+// all other files are stored as config maps.
+func toFileObjects(spec *engine.Spec, file *engine.File, opts *options) []runtime.Object {
+	var objects []runtime.Object
+	for i, chunk := range toChunks(file) {
+		meta := metav1.ObjectMeta{
+			Name:      toChunkName(file, i),
+			Namespace: toNamespaceName(spec, opts),
+			Labels:    opts.labels,
+		}
+		data := map[string][]byte{
+			file.Metadata.UID: chunk,
+		}
+		if file.Secret {
+			objects = append(objects, &v1.Secret{
+				ObjectMeta: meta,
+				Type:       "Opaque",
+				Data:       data,
+			})
+		} else {
+			objects = append(objects, &v1.ConfigMap{
+				ObjectMeta: meta,
+				BinaryData: data,
+			})
+		}
+	}
+	return objects
+}
+
+// helper function returns the volume projection that
+// exposes the file chunk at the given path.
+func toChunkProjection(file *engine.File, index int, path string, mode *int32) v1.VolumeProjection {
+	optional := false
+	items := []v1.KeyToPath{{
+		Key:  file.Metadata.UID,
+		Path: path,
+		Mode: mode,
+	}}
+	ref := v1.LocalObjectReference{
+		Name: toChunkName(file, index),
+	}
+	if file.Secret {
+		return v1.VolumeProjection{
+			Secret: &v1.SecretProjection{
+				LocalObjectReference: ref,
+				Items:                items,
+				Optional:             &optional,
+			},
+		}
+	}
+	return v1.VolumeProjection{
+		ConfigMap: &v1.ConfigMapProjection{
+			LocalObjectReference: ref,
+			Items:                items,
+			Optional:             &optional,
+		},
+	}
+}
+
+// helper function returns the pod volumes used to mount
+// the step files. The file chunks are mounted in the init
+// container, which writes the files to a shared volume.
+// Projected volumes are always mounted read-only, and the
+// files are copied so that steps can modify them, matching
+// the docker engine.
+func toFileVolumes(spec *engine.Spec, step *engine.Step) []v1.Volume {
+	var to []v1.Volume
+	for _, mount := range step.Files {
+		file, ok := engine.LookupFile(spec, mount.Name)
+		if !ok {
+			continue
+		}
+		var sources []v1.VolumeProjection
+		for i := range toChunks(file) {
+			sources = append(sources, toChunkProjection(file, i, fmt.Sprint(i), nil))
+		}
+		to = append(to, v1.Volume{
+			Name: file.Metadata.UID,
+			VolumeSource: v1.VolumeSource{
+				Projected: &v1.ProjectedVolumeSource{
+					Sources: sources,
+				},
+			},
+		})
+	}
+	if len(to) != 0 {
+		// sensitive files are written to memory to avoid
+		// storing secrets on the node file system. The
+		// medium depends on the pipeline files, and not the
+		// step files, since the volume is shared by all
+		// steps in single pod mode.
+		var medium v1.StorageMedium
+		if hasSecretFiles(spec) {
+			medium = v1.StorageMediumMemory
+		}
+		to = append(to, v1.Volume{
+			Name: filesVolume,
+			VolumeSource: v1.VolumeSource{
+				EmptyDir: &v1.EmptyDirVolumeSource{Medium: medium},
+			},
+		})
+	}
+	return to
+}
+
+// helper function returns true if the pipeline defines
+// sensitive files.
+func hasSecretFiles(spec *engine.Spec) bool {
+	for _, file := range spec.Files {
+		if file.Secret {
+			return true
+		}
+	}
+	return false
+}
+
+// helper function returns the path of the step file in
+// the files volume. Files are written to a directory per
+// step, so that changes made by a step are not visible to
+// other steps that share the volume.
+func toFilePath(step *engine.Step, file *engine.File) string {
+	return path.Join(step.Metadata.UID, file.Metadata.UID)
+}
+
+// helper function returns the step container volume
+// mounts for the step files. Each file is mounted at its
+// exact path using a sub path, so that existing files in
+// the parent directory are not shadowed. The files are
+// writable, matching the docker engine.
+func toFileMounts(spec *engine.Spec, step *engine.Step) []v1.VolumeMount {
+	var to []v1.VolumeMount
+	for _, mount := range step.Files {
+		file, ok := engine.LookupFile(spec, mount.Name)
+		if !ok {
+			continue
+		}
+		to = append(to, v1.VolumeMount{
+			Name:      filesVolume,
+			MountPath: mount.Path,
+			SubPath:   toFilePath(step, file),
+		})
+	}
+	return to
+}
+
+// helper function returns the init container that writes
+// the step files to the shared files volume, or nil if the
+// step has no files.
+func toFileInitContainer(spec *engine.Spec, step *engine.Step, opts *options) *v1.Container {
+	var mounts []v1.VolumeMount
+	var script []string
+	for _, mount := range step.Files {
+		file, ok := engine.LookupFile(spec, mount.Name)
+		if !ok {
+			continue
+		}
+		dir := path.Join(chunksPath, file.Metadata.UID)
+		dest := path.Join(filesPath, toFilePath(step, file))
+		mounts = append(mounts, v1.VolumeMount{
+			Name:      file.Metadata.UID,
+			MountPath: dir,
+			ReadOnly:  true,
+		})
+		var parts []string
+		for i := range toChunks(file) {
+			parts = append(parts, path.Join(dir, fmt.Sprint(i)))
+		}
+		script = append(script,
+			fmt.Sprintf("mkdir -p %s", path.Dir(dest)),
+			fmt.Sprintf("cat %s > %s", strings.Join(parts, " "), dest),
+			fmt.Sprintf("chmod %o %s", mount.Mode, dest),
+		)
+	}
+	if len(script) == 0 {
+		return nil
+	}
+	mounts = append(mounts, v1.VolumeMount{
+		Name:      filesVolume,
+		MountPath: filesPath,
+	})
+	return &v1.Container{
+		Name:            "drone-files",
+		Image:           opts.initImage,
+		ImagePullPolicy: v1.PullIfNotPresent,
+		Command:         []string{"/bin/sh", "-c"},
+		Args:            []string{strings.Join(script, " && ")},
+		VolumeMounts:    mounts,
+		Resources:       toResources(step, opts),
+	}
+}
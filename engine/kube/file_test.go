@@ -0,0 +1,193 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Drone Non-Commercial License
+// that can be found in the LICENSE file.
+
+package kube
+
+import (
+	"testing"
+
+	"github.com/drone/drone-runtime/engine"
+
+	"github.com/google/go-cmp/cmp"
+	"k8s.io/api/core/v1"
+)
+
+func TestToFileObjects(t *testing.T) {
+	opts := defaultOptions()
+	spec := &engine.Spec{
+		Metadata: engine.Metadata{Namespace: "ns-pipeline"},
+	}
+
+	file := &engine.File{
+		Metadata: engine.Metadata{UID: "uid-file"},
+		Data:     []byte("hello world"),
+	}
+	objects := toFileObjects(spec, file, &opts)
+	if len(objects) != 1 {
+		t.Errorf("Want a single object, got %d", len(objects))
+		return
+	}
+	configMap, ok := objects[0].(*v1.ConfigMap)
+	if !ok {
+		t.Errorf("Want file stored as config map, got %T", objects[0])
+		return
+	}
+	if got, want := string(configMap.BinaryData["uid-file"]), "hello world"; got != want {
+		t.Errorf("Want file data %q, got %q", want, got)
+	}
+
+	// sensitive files are stored as secrets.
+	file.Secret = true
+	objects = toFileObjects(spec, file, &opts)
+	if _, ok := objects[0].(*v1.Secret); !ok {
+		t.Errorf("Want file stored as secret, got %T", objects[0])
+	}
+}
+
+func TestToFileObjectsChunked(t *testing.T) {
+	defer func(size int) { fileChunkSize = size }(fileChunkSize)
+	fileChunkSize = 4
+
+	opts := defaultOptions()
+	spec := &engine.Spec{}
+	file := &engine.File{
+		Metadata: engine.Metadata{UID: "uid-file"},
+		Data:     []byte("hello world"),
+	}
+	objects := toFileObjects(spec, file, &opts)
+	if got, want := len(objects), 3; got != want {
+		t.Errorf("Want %d chunks, got %d", want, got)
+		return
+	}
+	var data []string
+	var names []string
+	for _, obj := range objects {
+		configMap := obj.(*v1.ConfigMap)
+		names = append(names, configMap.Name)
+		data = append(data, string(configMap.BinaryData["uid-file"]))
+	}
+	if diff := cmp.Diff([]string{"uid-file-0", "uid-file-1", "uid-file-2"}, names); diff != "" {
+		t.Errorf("Unexpected chunk names")
+		t.Log(diff)
+	}
+	if diff := cmp.Diff([]string{"hell", "o wo", "rld"}, data); diff != "" {
+		t.Errorf("Unexpected chunk data")
+		t.Log(diff)
+	}
+}
+
+func TestToFileMounts(t *testing.T) {
+	spec := &engine.Spec{
+		Files: []*engine.File{
+			{
+				Metadata: engine.Metadata{UID: "uid-file", Name: "netrc"},
+				Data:     []byte("machine github.com"),
+			},
+		},
+	}
+	step := &engine.Step{
+		Metadata: engine.Metadata{UID: "uid-step"},
+		Files: []*engine.FileMount{
+			{Name: "netrc", Path: "/root/.netrc", Mode: 0600},
+		},
+	}
+
+	// files are mounted from the writable files volume,
+	// since the docker engine copies files to the container
+	// and steps may modify them.
+	want := []v1.VolumeMount{{
+		Name:      filesVolume,
+		MountPath: "/root/.netrc",
+		SubPath:   "uid-step/uid-file",
+	}}
+	if diff := cmp.Diff(want, toFileMounts(spec, step)); diff != "" {
+		t.Errorf("Unexpected file mounts")
+		t.Log(diff)
+	}
+
+	volumes := toFileVolumes(spec, step)
+	if got, want := len(volumes), 2; got != want {
+		t.Errorf("Want %d volumes, got %d", want, got)
+		return
+	}
+	if volumes[0].Projected == nil {
+		t.Errorf("Want projected file volume")
+	}
+	if got, want := volumes[1].EmptyDir.Medium, v1.StorageMedium(""); got != want {
+		t.Errorf("Want files written to disk")
+	}
+
+	container := toFileInitContainer(spec, step, &options{})
+	if container == nil {
+		t.Errorf("Want init container for small files")
+		return
+	}
+	script := "mkdir -p /drone/files/uid-step && cat /drone/chunks/uid-file/0 > /drone/files/uid-step/uid-file && chmod 600 /drone/files/uid-step/uid-file"
+	if got := container.Args[0]; got != script {
+		t.Errorf("Want init script %q, got %q", script, got)
+	}
+}
+
+func TestToFileMountsNone(t *testing.T) {
+	spec := &engine.Spec{}
+	step := &engine.Step{}
+	if volumes := toFileVolumes(spec, step); len(volumes) != 0 {
+		t.Errorf("Want no file volumes")
+	}
+	if c := toFileInitContainer(spec, step, &options{}); c != nil {
+		t.Errorf("Want no init container without files")
+	}
+}
+
+func TestToFileInitContainer(t *testing.T) {
+	defer func(size int) { fileChunkSize = size }(fileChunkSize)
+	fileChunkSize = 4
+
+	opts := defaultOptions()
+	spec := &engine.Spec{
+		Files: []*engine.File{
+			{
+				Metadata: engine.Metadata{UID: "uid-file", Name: "key"},
+				Data:     []byte("hello world"),
+				Secret:   true,
+			},
+		},
+	}
+	step := &engine.Step{
+		Metadata: engine.Metadata{UID: "uid-step"},
+		Files: []*engine.FileMount{
+			{Name: "key", Path: "/root/.ssh/id_rsa", Mode: 0600},
+		},
+	}
+
+	mounts := toFileMounts(spec, step)
+	if got, want := mounts[0].Name, filesVolume; got != want {
+		t.Errorf("Want file mounted from volume %q, got %q", want, got)
+	}
+
+	volumes := toFileVolumes(spec, step)
+	if got, want := len(volumes), 2; got != want {
+		t.Errorf("Want %d volumes, got %d", want, got)
+		return
+	}
+	if got, want := len(volumes[0].Projected.Sources), 3; got != want {
+		t.Errorf("Want %d chunk sources, got %d", want, got)
+	}
+	if got, want := volumes[1].EmptyDir.Medium, v1.StorageMediumMemory; got != want {
+		t.Errorf("Want sensitive files written to memory")
+	}
+
+	container := toFileInitContainer(spec, step, &opts)
+	if container == nil {
+		t.Errorf("Want init container")
+		return
+	}
+	if got, want := container.Image, defaultInitImage; got != want {
+		t.Errorf("Want init image %q, got %q", want, got)
+	}
+	script := "mkdir -p /drone/files/uid-step && cat /drone/chunks/uid-file/0 /drone/chunks/uid-file/1 /drone/chunks/uid-file/2 > /drone/files/uid-step/uid-file && chmod 600 /drone/files/uid-step/uid-file"
+	if got := container.Args[0]; got != script {
+		t.Errorf("Want init script %q, got %q", script, got)
+	}
+}
@@ -6,32 +6,50 @@ package kube
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"io"
-	"os"
-	"path/filepath"
-	"time"
+	"sync"
 
 	"github.com/drone/drone-runtime/engine"
-	"github.com/drone/drone-runtime/engine/docker/auth"
 
 	"k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/util/wait"
-	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/kubernetes/scheme"
-	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 )
 
 type kubeEngine struct {
-	client *kubernetes.Clientset
-	node   string
+	options
+
+	client kubernetes.Interface
+	config *rest.Config
+
+	mu       sync.Mutex
+	watchers map[string]*podWatcher
+}
+
+// New returns a new Kubernetes engine using the given
+// Kubernetes client.
+func New(client kubernetes.Interface, opts ...Option) engine.Engine {
+	e := &kubeEngine{
+		options:  defaultOptions(),
+		client:   client,
+		watchers: map[string]*podWatcher{},
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+	if e.singlePod {
+		return &podEngine{e}
+	}
+	return e
 }
 
 // NewFile returns a new Kubernetes engine from a
 // Kubernetes configuration file (~/.kube/config).
-func NewFile(url, path, node string) (engine.Engine, error) {
+func NewFile(url, path, node string, opts ...Option) (engine.Engine, error) {
 	config, err := clientcmd.BuildConfigFromFlags(url, path)
 	if err != nil {
 		return nil, err
@@ -40,11 +58,34 @@ func NewFile(url, path, node string) (engine.Engine, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &kubeEngine{client: client, node: node}, nil
+	opts = append([]Option{WithNode(node), WithRestConfig(config)}, opts...)
+	return New(client, opts...), nil
+}
+
+// NewInCluster returns a new Kubernetes engine using the
+// service account credentials of the pod in which the
+// engine is running.
+func NewInCluster(opts ...Option) (engine.Engine, error) {
+	config, err := rest.InClusterConfig()
+	if err != nil {
+		return nil, err
+	}
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	opts = append([]Option{WithRestConfig(config)}, opts...)
+	return New(client, opts...), nil
 }
 
 func (e *kubeEngine) Setup(ctx context.Context, spec *engine.Spec) error {
-	ns := toNamespace(spec)
+	// the pipeline must only use image pull secrets that
+	// are allowed by the engine.
+	if err := checkPullSecrets(spec, &e.options); err != nil {
+		return err
+	}
+
+	ns := toNamespace(spec, &e.options)
 
 	// create the project namespace. all pods and
 	// containers are created within the namespace, and
@@ -54,68 +95,28 @@ func (e *kubeEngine) Setup(ctx context.Context, spec *engine.Spec) error {
 		return err
 	}
 
-	// create all secrets
-	for _, secret := range spec.Secrets {
-		_, err := e.client.CoreV1().Secrets(ns.Name).Create(
-			toSecret(spec, secret),
-		)
-		if err != nil {
-			return err
-		}
-	}
+	// create the pod watcher. a single namespace-scoped
+	// informer is shared by all steps in the pipeline, and
+	// is stopped when the pipeline is destroyed.
+	e.mu.Lock()
+	e.watchers[ns.Name] = newWatcher(e.client, ns.Name)
+	e.mu.Unlock()
 
-	// create all registry credentials as secrets.
-	if spec.Docker != nil && len(spec.Docker.Auths) > 0 {
-		out, err := auth.Marshal(spec.Docker.Auths)
-		if err != nil {
-			return err
-		}
-		_, err = e.client.CoreV1().Secrets(ns.Name).Create(
-			&v1.Secret{
-				ObjectMeta: metav1.ObjectMeta{
-					Name: "docker-auth-config",
-				},
-				Type: "kubernetes.io/dockerconfigjson",
-				StringData: map[string]string{
-					".dockerconfigjson": string(out),
-				},
-			},
-		)
-		if err != nil {
-			return err
-		}
+	// create all secrets, registry credentials, files
+	// and persistent volume claims.
+	objects, err := toSetupObjects(spec, &e.options)
+	if err != nil {
+		return err
 	}
-
-	// create all files as config maps.
-	for _, file := range spec.Files {
-		_, err := e.client.CoreV1().ConfigMaps(ns.Name).Create(
-			&v1.ConfigMap{
-				ObjectMeta: metav1.ObjectMeta{
-					Name: file.Metadata.UID,
-				},
-				Data: map[string]string{
-					file.Metadata.UID: string(file.Data),
-				},
-			},
-		)
-		if err != nil {
+	for _, obj := range objects {
+		if err := createObject(e.client, ns.Name, obj); err != nil {
 			return err
 		}
 	}
 
-	// pv := toPersistentVolume(e.node, spec.Metadata.Namespace, spec.Metadata.Namespace, filepath.Join("/tmp", spec.Metadata.Namespace))
-	// _, err = e.client.CoreV1().PersistentVolumes().Create(pv)
-	// if err != nil {
-	// 	return err
-	// }
-
-	// pvc := toPersistentVolumeClaim(spec.Metadata.Namespace, spec.Metadata.Namespace)
-	// _, err = e.client.CoreV1().PersistentVolumeClaims(spec.Metadata.Namespace).Create(pvc)
-	// if err != nil {
-	// 	return err
-	// }
-
-	return nil
+	// copy the service account and image pull secrets,
+	// which must exist in the pipeline namespace.
+	return copySchedulingObjects(e.client, spec, &e.options, ns.Name)
 }
 
 func (e *kubeEngine) Create(_ context.Context, _ *engine.Spec, _ *engine.Step) error {
@@ -124,154 +125,139 @@ func (e *kubeEngine) Create(_ context.Context, _ *engine.Spec, _ *engine.Step) e
 }
 
 func (e *kubeEngine) Start(ctx context.Context, spec *engine.Spec, step *engine.Step) error {
-	pod := toPod(spec, step)
-	if len(step.Docker.Ports) != 0 {
-		service := toService(spec, step)
-		_, err := e.client.CoreV1().Services(spec.Metadata.Namespace).Create(service)
-		if err != nil {
+	ns := toNamespaceName(spec, &e.options)
+	for _, obj := range toStepObjects(spec, step, &e.options) {
+		if err := createObject(e.client, ns, obj); err != nil {
 			return err
 		}
 	}
-
-	if e.node != "" {
-		pod.Spec.Affinity = &v1.Affinity{
-			NodeAffinity: &v1.NodeAffinity{
-				RequiredDuringSchedulingIgnoredDuringExecution: &v1.NodeSelector{
-					NodeSelectorTerms: []v1.NodeSelectorTerm{{
-						MatchExpressions: []v1.NodeSelectorRequirement{{
-							Key:      "kubernetes.io/hostname",
-							Operator: v1.NodeSelectorOpIn,
-							Values:   []string{e.node},
-						}},
-					}},
-				},
-			},
-		}
-	}
-
-	_, err := e.client.CoreV1().Pods(spec.Metadata.Namespace).Create(pod)
-	return err
+	return nil
 }
 
 func (e *kubeEngine) Wait(ctx context.Context, spec *engine.Spec, step *engine.Step) (*engine.State, error) {
-	stopper := make(chan struct{})
-	updater := func(old interface{}, new interface{}) {
-		pod := new.(*v1.Pod)
-		// ignore events that do not come from the
-		// current pod namespace.
-		if pod.ObjectMeta.Namespace != step.Metadata.Namespace {
-			return
-		}
-		if pod.Name == step.Metadata.UID {
-			switch pod.Status.Phase {
-			case v1.PodSucceeded, v1.PodFailed, v1.PodUnknown:
-				// TODO need to understand if this could be
-				// invoked multiple times.
-				select {
-				case stopper <- struct{}{}:
-				default:
-				}
-			}
-		}
+	watcher, err := e.watcher(spec)
+	if err != nil {
+		return nil, err
 	}
 
-	factory := informers.NewSharedInformerFactory(e.client, time.Second)
-	informer := factory.Core().V1().Pods().Informer()
-	informer.AddEventHandler(
-		cache.ResourceEventHandlerFuncs{
-			UpdateFunc: updater,
-		},
-	)
-	factory.Start(wait.NeverStop)
-
-	// TODO Cancel on ctx.Done
-	<-stopper
-
-	pod, err := e.client.CoreV1().Pods(spec.Metadata.Namespace).Get(step.Metadata.UID, metav1.GetOptions{
-		IncludeUninitialized: true,
+	pod, err := watcher.wait(ctx, step.Metadata.UID, func(pod *v1.Pod) (bool, error) {
+		if err := toPodError(step, pod, e.scheduleTimeout); err != nil {
+			return false, err
+		}
+		switch pod.Status.Phase {
+		case v1.PodSucceeded, v1.PodFailed, v1.PodUnknown:
+			return true, nil
+		}
+		return false, nil
 	})
 	if err != nil {
 		return nil, err
 	}
-
-	state := &engine.State{
-		ExitCode:  int(pod.Status.ContainerStatuses[0].State.Terminated.ExitCode),
-		Exited:    true,
-		OOMKilled: false,
-	}
-	return state, nil
+	return toState(step, pod)
 }
 
 func (e *kubeEngine) Tail(ctx context.Context, spec *engine.Spec, step *engine.Step) (io.ReadCloser, error) {
-	ns := spec.Metadata.Namespace
-	podName := step.Metadata.UID
-
-	up := make(chan bool)
-
-	var podUpdated = func(old interface{}, new interface{}) {
-		pod := new.(*v1.Pod)
-		if pod.Name == podName {
-			switch pod.Status.Phase {
-			case v1.PodRunning, v1.PodSucceeded, v1.PodFailed:
-				up <- true
-			}
-		}
+	watcher, err := e.watcher(spec)
+	if err != nil {
+		return nil, err
 	}
 
-	si := informers.NewSharedInformerFactory(e.client, 5*time.Minute)
-	si.Core().V1().Pods().Informer().AddEventHandler(
-		cache.ResourceEventHandlerFuncs{
-			UpdateFunc: podUpdated,
-		},
-	)
-	si.Start(wait.NeverStop)
-
-	select {
-	case <-up:
-	case <-ctx.Done():
+	_, err = watcher.wait(ctx, step.Metadata.UID, func(pod *v1.Pod) (bool, error) {
+		if err := toPodError(step, pod, e.scheduleTimeout); err != nil {
+			return false, err
+		}
+		switch pod.Status.Phase {
+		case v1.PodRunning, v1.PodSucceeded, v1.PodFailed:
+			return true, nil
+		}
+		return false, nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	opts := &v1.PodLogOptions{
 		Follow: true,
 	}
 
-	return e.client.CoreV1().RESTClient().Get().
-		Namespace(ns).
-		Name(podName).
-		Resource("pods").
-		SubResource("log").
-		VersionedParams(opts, scheme.ParameterCodec).
+	return e.client.CoreV1().
+		Pods(toNamespaceName(spec, &e.options)).
+		GetLogs(step.Metadata.UID, opts).
 		Stream()
 }
 
 func (e *kubeEngine) Destroy(ctx context.Context, spec *engine.Spec) error {
-	// err := e.client.CoreV1().PersistentVolumes().Delete(spec.Metadata.Namespace, nil)
-	// if err != nil {
-	// 	// TODO show error message
-	// }
-
-	// err = e.client.CoreV1().PersistentVolumeClaims(spec.Metadata.Namespace).Delete("workspace", nil)
-	// if err != nil {
-	// 	// TODO show error message
-	// }
-
-	// this is a complete hack. we are creating a host machine
-	// directory which should be handled by a persistent volume.
-	// I am planning to switch to a persistent volume, but am
-	// leaving this in place as a temporary workaround in the short
-	// term.
-	os.RemoveAll(
-		filepath.Join(
-			"/tmp",
-			"drone",
-			spec.Metadata.Namespace,
-		),
-	)
+	ns := toNamespaceName(spec, &e.options)
+
+	// empty_dir volumes backed by host machine directories
+	// must be removed by the engine, using a pod pinned to
+	// the pipeline node. Persistent volume claims are
+	// removed when the namespace is deleted.
+	cerr := e.cleanup(ctx, spec)
+
+	// stop the pod watcher. any pending waiters are
+	// released and return an error.
+	e.mu.Lock()
+	if watcher, ok := e.watchers[ns]; ok {
+		watcher.close()
+		delete(e.watchers, ns)
+	}
+	e.mu.Unlock()
 
 	// deleting the namespace should destroy all secrets,
 	// volumes, configuration files and more.
-	return e.client.CoreV1().Namespaces().Delete(
-		spec.Metadata.Namespace,
+	err := e.client.CoreV1().Namespaces().Delete(
+		ns,
 		&metav1.DeleteOptions{},
 	)
+	if err != nil {
+		return err
+	}
+	return cerr
+}
+
+// helper function removes the host machine directory that
+// backs the pipeline empty_dir volumes, and waits for the
+// cleanup pod to complete.
+func (e *kubeEngine) cleanup(ctx context.Context, spec *engine.Spec) error {
+	pod := toCleanupPod(spec, &e.options)
+	if pod == nil {
+		return nil
+	}
+	watcher, err := e.watcher(spec)
+	if err != nil {
+		// the pipeline environment was not created, and
+		// no volume data was written.
+		return nil
+	}
+	if _, err := e.client.CoreV1().Pods(pod.Namespace).Create(pod); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, cleanupTimeout)
+	defer cancel()
+	_, err = watcher.wait(ctx, pod.Name, func(pod *v1.Pod) (bool, error) {
+		switch pod.Status.Phase {
+		case v1.PodSucceeded:
+			return true, nil
+		case v1.PodFailed, v1.PodUnknown:
+			return false, errors.New("the cleanup pod failed")
+		}
+		return false, nil
+	})
+	if err != nil {
+		return fmt.Errorf("kubernetes: unable to remove volume data in %s: %s", e.hostPath, err)
+	}
+	return nil
+}
+
+// helper function returns the pod watcher for the pipeline.
+func (e *kubeEngine) watcher(spec *engine.Spec) (*podWatcher, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	watcher, ok := e.watchers[toNamespaceName(spec, &e.options)]
+	if !ok {
+		return nil, errWatcherStopped
+	}
+	return watcher, nil
 }
@@ -0,0 +1,377 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Drone Non-Commercial License
+// that can be found in the LICENSE file.
+
+package kube
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/drone/drone-runtime/engine"
+
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+var (
+	testSpec = &engine.Spec{
+		Metadata: engine.Metadata{
+			UID:       "uid_pipeline",
+			Namespace: "ns-pipeline",
+		},
+		Docker: &engine.DockerConfig{
+			Volumes: []*engine.Volume{
+				{
+					Metadata: engine.Metadata{UID: "uid-volume", Name: "workspace"},
+					EmptyDir: &engine.VolumeEmptyDir{},
+				},
+			},
+		},
+	}
+
+	testStep = &engine.Step{
+		Metadata: engine.Metadata{
+			UID:       "uid-step",
+			Namespace: "ns-pipeline",
+			Name:      "build",
+		},
+		Docker: &engine.DockerStep{
+			Image: "golang:1.11",
+		},
+		Volumes: []*engine.VolumeMount{
+			{Name: "workspace", Path: "/drone/src"},
+		},
+	}
+)
+
+// helper function returns a fake clientset, in which the
+// cleanup pod succeeds after it is created.
+func newTestClient(objects ...runtime.Object) *fake.Clientset {
+	client := fake.NewSimpleClientset(objects...)
+	client.PrependReactor("create", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		pod := action.(k8stesting.CreateAction).GetObject().(*v1.Pod)
+		if pod.Name == cleanupName {
+			go func() {
+				pods := client.CoreV1().Pods(pod.Namespace)
+				for {
+					time.Sleep(10 * time.Millisecond)
+					pod, err := pods.Get(cleanupName, metav1.GetOptions{})
+					if err != nil {
+						continue
+					}
+					pod.Status.Phase = v1.PodSucceeded
+					pods.UpdateStatus(pod)
+					return
+				}
+			}()
+		}
+		return false, nil, nil
+	})
+	return client
+}
+
+// helper function returns a new engine backed by a fake
+// clientset, with the test pipeline environment created.
+func newTestEngine(t *testing.T, opts ...Option) (*kubeEngine, *fake.Clientset) {
+	client := newTestClient()
+	e := New(client, opts...).(*kubeEngine)
+	if err := e.Setup(context.Background(), testSpec); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Start(context.Background(), testSpec, testStep); err != nil {
+		t.Fatal(err)
+	}
+	return e, client
+}
+
+// helper function updates the test pod status after a
+// short delay, to ensure the engine is waiting.
+func updateStatus(client *fake.Clientset, status v1.PodStatus) {
+	updateStatusNamespace(client, testSpec.Metadata.Namespace, status)
+}
+
+// helper function updates the test pod status in the named
+// namespace after a short delay.
+func updateStatusNamespace(client *fake.Clientset, namespace string, status v1.PodStatus) {
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		pods := client.CoreV1().Pods(namespace)
+		pod, _ := pods.Get(testStep.Metadata.UID, metav1.GetOptions{})
+		pod.Status = status
+		pods.UpdateStatus(pod)
+	}()
+}
+
+func TestWait(t *testing.T) {
+	e, client := newTestEngine(t)
+	defer e.Destroy(context.Background(), testSpec)
+
+	finished := metav1.NewTime(time.Unix(1566302400, 0))
+	updateStatus(client, v1.PodStatus{
+		Phase: v1.PodFailed,
+		ContainerStatuses: []v1.ContainerStatus{{
+			Name:    testStep.Metadata.UID,
+			ImageID: "docker-pullable://golang@sha256:9e0d5d6b",
+			State: v1.ContainerState{
+				Terminated: &v1.ContainerStateTerminated{
+					ExitCode:   137,
+					Reason:     "OOMKilled",
+					FinishedAt: finished,
+				},
+			},
+		}},
+	})
+
+	state, err := e.Wait(context.Background(), testSpec, testStep)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if got, want := state.ExitCode, 137; got != want {
+		t.Errorf("Want exit code %d, got %d", want, got)
+	}
+	if !state.Exited || !state.OOMKilled {
+		t.Errorf("Want exited and oom killed state")
+	}
+	if got, want := state.Finished, finished.Unix(); got != want {
+		t.Errorf("Want finished time %d, got %d", want, got)
+	}
+	if got, want := state.Digest, "sha256:9e0d5d6b"; got != want {
+		t.Errorf("Want image digest %q, got %q", want, got)
+	}
+}
+
+func TestWaitPodError(t *testing.T) {
+	tests := []struct {
+		status v1.PodStatus
+		reason string
+	}{
+		{
+			status: v1.PodStatus{
+				Phase: v1.PodPending,
+				ContainerStatuses: []v1.ContainerStatus{{
+					Name: testStep.Metadata.UID,
+					State: v1.ContainerState{
+						Waiting: &v1.ContainerStateWaiting{Reason: "ImagePullBackOff"},
+					},
+				}},
+			},
+			reason: "ImagePullBackOff",
+		},
+		{
+			status: v1.PodStatus{
+				Phase: v1.PodPending,
+				ContainerStatuses: []v1.ContainerStatus{{
+					Name: testStep.Metadata.UID,
+					State: v1.ContainerState{
+						Waiting: &v1.ContainerStateWaiting{Reason: "CreateContainerConfigError"},
+					},
+				}},
+			},
+			reason: "CreateContainerConfigError",
+		},
+		{
+			status: v1.PodStatus{
+				Phase: v1.PodPending,
+				Conditions: []v1.PodCondition{{
+					Type:               v1.PodScheduled,
+					Status:             v1.ConditionFalse,
+					Reason:             v1.PodReasonUnschedulable,
+					LastTransitionTime: metav1.NewTime(time.Now().Add(-time.Hour)),
+				}},
+			},
+			reason: "Unschedulable",
+		},
+		{
+			status: v1.PodStatus{
+				Phase:  v1.PodFailed,
+				Reason: "Evicted",
+			},
+			reason: "Evicted",
+		},
+		{
+			status: v1.PodStatus{
+				Phase: v1.PodUnknown,
+			},
+			reason: "Unknown",
+		},
+	}
+
+	for _, test := range tests {
+		e, client := newTestEngine(t)
+		updateStatus(client, test.status)
+
+		_, err := e.Wait(context.Background(), testSpec, testStep)
+		perr, ok := err.(*PodError)
+		if !ok {
+			t.Errorf("Want PodError, got %v", err)
+		} else if got, want := perr.Reason, test.reason; got != want {
+			t.Errorf("Want reason %q, got %q", want, got)
+		}
+		e.Destroy(context.Background(), testSpec)
+	}
+}
+
+func TestWaitUnschedulable(t *testing.T) {
+	e, client := newTestEngine(t, WithScheduleTimeout(time.Hour))
+	defer e.Destroy(context.Background(), testSpec)
+
+	// the pod is not failed while it is unschedulable for
+	// less than the schedule timeout.
+	updateStatus(client, v1.PodStatus{
+		Phase: v1.PodPending,
+		Conditions: []v1.PodCondition{{
+			Type:               v1.PodScheduled,
+			Status:             v1.ConditionFalse,
+			Reason:             v1.PodReasonUnschedulable,
+			LastTransitionTime: metav1.NewTime(time.Now()),
+		}},
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	_, err := e.Wait(ctx, testSpec, testStep)
+	if err != context.DeadlineExceeded {
+		t.Errorf("Want step pending while unschedulable, got %v", err)
+	}
+}
+
+func TestWaitCancel(t *testing.T) {
+	e, _ := newTestEngine(t)
+	defer e.Destroy(context.Background(), testSpec)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err := e.Wait(ctx, testSpec, testStep)
+	if err != context.DeadlineExceeded {
+		t.Errorf("Want context error, got %v", err)
+	}
+}
+
+func TestWaitDestroy(t *testing.T) {
+	e, _ := newTestEngine(t)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		e.Destroy(context.Background(), testSpec)
+	}()
+
+	_, err := e.Wait(context.Background(), testSpec, testStep)
+	if err != errWatcherStopped {
+		t.Errorf("Want watcher stopped error, got %v", err)
+	}
+}
+
+func TestSetupVolumeClaim(t *testing.T) {
+	e, client := newTestEngine(t, WithVolumeClaim("nfs", resource.MustParse("10Gi")))
+	defer e.Destroy(context.Background(), testSpec)
+
+	claim, err := client.CoreV1().
+		PersistentVolumeClaims(testSpec.Metadata.Namespace).
+		Get("uid-volume", metav1.GetOptions{})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if got, want := *claim.Spec.StorageClassName, "nfs"; got != want {
+		t.Errorf("Want storage class %q, got %q", want, got)
+	}
+
+	pod, err := client.CoreV1().
+		Pods(testSpec.Metadata.Namespace).
+		Get(testStep.Metadata.UID, metav1.GetOptions{})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(pod.Spec.Volumes) != 1 || pod.Spec.Volumes[0].PersistentVolumeClaim == nil {
+		t.Errorf("Want pod volume backed by persistent volume claim")
+	}
+}
+
+func TestNamespacePrefix(t *testing.T) {
+	e, client := newTestEngine(t,
+		WithNamespacePrefix("drone-"),
+		WithLabels(map[string]string{"io.drone.runner": "kube"}),
+	)
+
+	ns, err := client.CoreV1().Namespaces().Get("drone-ns-pipeline", metav1.GetOptions{})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if got, want := ns.Labels["io.drone.runner"], "kube"; got != want {
+		t.Errorf("Want namespace label %q, got %q", want, got)
+	}
+
+	updateStatusNamespace(client, "drone-ns-pipeline", v1.PodStatus{
+		Phase: v1.PodSucceeded,
+		ContainerStatuses: []v1.ContainerStatus{{
+			Name: testStep.Metadata.UID,
+			State: v1.ContainerState{
+				Terminated: &v1.ContainerStateTerminated{},
+			},
+		}},
+	})
+	if _, err := e.Wait(context.Background(), testSpec, testStep); err != nil {
+		t.Error(err)
+	}
+
+	if err := e.Destroy(context.Background(), testSpec); err != nil {
+		t.Error(err)
+	}
+	if _, err := client.CoreV1().Namespaces().Get("drone-ns-pipeline", metav1.GetOptions{}); err == nil {
+		t.Errorf("Want prefixed namespace deleted")
+	}
+}
+
+func TestDestroyCleanupFailed(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	e := New(client).(*kubeEngine)
+	if err := e.Setup(context.Background(), testSpec); err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		pods := client.CoreV1().Pods(testSpec.Metadata.Namespace)
+		for {
+			time.Sleep(10 * time.Millisecond)
+			pod, err := pods.Get(cleanupName, metav1.GetOptions{})
+			if err != nil {
+				continue
+			}
+			pod.Status.Phase = v1.PodFailed
+			pods.UpdateStatus(pod)
+			return
+		}
+	}()
+
+	// the namespace is deleted, and the cleanup error is
+	// returned.
+	if err := e.Destroy(context.Background(), testSpec); err == nil {
+		t.Errorf("Want error when the cleanup pod fails")
+	}
+	if _, err := client.CoreV1().Namespaces().Get("ns-pipeline", metav1.GetOptions{}); err == nil {
+		t.Errorf("Want namespace deleted")
+	}
+}
+
+func TestSetupIsolation(t *testing.T) {
+	e, client := newTestEngine(t, WithNetworkPolicy(), WithResourceQuota())
+	defer e.Destroy(context.Background(), testSpec)
+
+	ns := testSpec.Metadata.Namespace
+	if _, err := client.NetworkingV1().NetworkPolicies(ns).Get("drone-isolation", metav1.GetOptions{}); err != nil {
+		t.Errorf("Want network policy created, got %v", err)
+	}
+	if _, err := client.CoreV1().ResourceQuotas(ns).Get("drone-quota", metav1.GetOptions{}); err != nil {
+		t.Errorf("Want resource quota created, got %v", err)
+	}
+}
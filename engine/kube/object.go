@@ -0,0 +1,123 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Drone Non-Commercial License
+// that can be found in the LICENSE file.
+
+package kube
+
+import (
+	"fmt"
+
+	"github.com/drone/drone-runtime/engine"
+
+	"k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+)
+
+// helper function returns the kubernetes objects created
+// in the pipeline namespace when the pipeline environment
+// is setup, in creation order.
+func toSetupObjects(spec *engine.Spec, opts *options) ([]runtime.Object, error) {
+	var objects []runtime.Object
+	if policy := toNetworkPolicy(spec, opts); policy != nil {
+		objects = append(objects, policy)
+	}
+	if quota := toResourceQuota(spec, opts); quota != nil {
+		objects = append(objects, quota)
+	}
+	if limits := toLimitRange(spec, opts); limits != nil {
+		objects = append(objects, limits)
+	}
+	for _, secret := range spec.Secrets {
+		objects = append(objects, toSecret(spec, secret, opts))
+	}
+	if spec.Docker != nil && len(spec.Docker.Auths) > 0 {
+		secret, err := toAuthSecret(spec, opts)
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, secret)
+	}
+	for _, file := range spec.Files {
+		objects = append(objects, toFileObjects(spec, file, opts)...)
+	}
+	for _, claim := range toPersistentVolumeClaims(spec, opts) {
+		objects = append(objects, claim)
+	}
+	return objects, nil
+}
+
+// helper function returns the kubernetes objects created
+// when the pipeline step is started, in creation order.
+func toStepObjects(spec *engine.Spec, step *engine.Step, opts *options) []runtime.Object {
+	var objects []runtime.Object
+	if hasService(step) {
+		objects = append(objects, toService(spec, step, opts))
+	}
+	return append(objects, toPod(spec, step, opts))
+}
+
+// helper function creates the kubernetes object in the
+// named namespace.
+func createObject(client kubernetes.Interface, namespace string, obj runtime.Object) error {
+	var err error
+	switch o := obj.(type) {
+	case *networkingv1.NetworkPolicy:
+		_, err = client.NetworkingV1().NetworkPolicies(namespace).Create(o)
+	case *v1.ResourceQuota:
+		_, err = client.CoreV1().ResourceQuotas(namespace).Create(o)
+	case *v1.LimitRange:
+		_, err = client.CoreV1().LimitRanges(namespace).Create(o)
+	case *v1.Secret:
+		_, err = client.CoreV1().Secrets(namespace).Create(o)
+	case *v1.ServiceAccount:
+		_, err = client.CoreV1().ServiceAccounts(namespace).Create(o)
+	case *v1.ConfigMap:
+		_, err = client.CoreV1().ConfigMaps(namespace).Create(o)
+	case *v1.PersistentVolumeClaim:
+		_, err = client.CoreV1().PersistentVolumeClaims(namespace).Create(o)
+	case *v1.Service:
+		_, err = client.CoreV1().Services(namespace).Create(o)
+	case *v1.Pod:
+		_, err = client.CoreV1().Pods(namespace).Create(o)
+	default:
+		err = fmt.Errorf("kubernetes: cannot create object of type %T", obj)
+	}
+	return err
+}
+
+// helper function sets the object kind and api version,
+// which are required when the object is encoded.
+func setTypeMeta(obj runtime.Object) {
+	if _, ok := obj.(*networkingv1.NetworkPolicy); ok {
+		obj.GetObjectKind().SetGroupVersionKind(
+			networkingv1.SchemeGroupVersion.WithKind("NetworkPolicy"),
+		)
+		return
+	}
+	var kind string
+	switch obj.(type) {
+	case *v1.ResourceQuota:
+		kind = "ResourceQuota"
+	case *v1.LimitRange:
+		kind = "LimitRange"
+	case *v1.Namespace:
+		kind = "Namespace"
+	case *v1.Secret:
+		kind = "Secret"
+	case *v1.ServiceAccount:
+		kind = "ServiceAccount"
+	case *v1.ConfigMap:
+		kind = "ConfigMap"
+	case *v1.PersistentVolumeClaim:
+		kind = "PersistentVolumeClaim"
+	case *v1.Service:
+		kind = "Service"
+	case *v1.Pod:
+		kind = "Pod"
+	}
+	obj.GetObjectKind().SetGroupVersionKind(
+		v1.SchemeGroupVersion.WithKind(kind),
+	)
+}
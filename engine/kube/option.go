@@ -0,0 +1,353 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Drone Non-Commercial License
+// that can be found in the LICENSE file.
+
+package kube
+
+import (
+	"time"
+
+	"github.com/drone/drone-runtime/engine"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/client-go/rest"
+)
+
+// Option configures a Kubernetes engine option.
+type Option func(*kubeEngine)
+
+// options defines the engine options used to convert the
+// pipeline specification to kubernetes resources.
+type options struct {
+	// node pins all pipeline pods to the named node.
+	node string
+
+	// claim configures the engine to back empty_dir
+	// volumes with persistent volume claims, instead of
+	// directories on the host machine.
+	claim bool
+
+	// storageClass defines the storage class of the
+	// persistent volume claims. If empty, the cluster
+	// default storage class is used.
+	storageClass string
+
+	// volumeSize defines the default size of the
+	// persistent volume claims.
+	volumeSize resource.Quantity
+
+	// hostPath defines the host machine directory in
+	// which empty_dir volumes are created.
+	hostPath string
+
+	// namespacePrefix defines the prefix added to the
+	// name of pipeline namespaces.
+	namespacePrefix string
+
+	// labels defines the labels added to all pipeline
+	// resources.
+	labels map[string]string
+
+	// resources defines the default container resource
+	// requirements, used when not defined by the step.
+	resources *engine.Resources
+
+	// networkPolicy configures the engine to isolate the
+	// pipeline namespace with a network policy.
+	networkPolicy bool
+
+	// egress defines the destinations that step pods are
+	// allowed to reach when the namespace is isolated.
+	egress []*Egress
+
+	// quota configures the engine to limit the compute
+	// resources of the pipeline namespace.
+	quota bool
+
+	// initImage defines the image used to write large
+	// files to the pod file system, and to copy the
+	// entrypoint shim.
+	initImage string
+
+	// singlePod configures the engine to execute all
+	// pipeline steps in a single pod.
+	singlePod bool
+
+	// placeholderImage defines the image used for step
+	// containers that have not yet started, when all steps
+	// are executed in a single pod.
+	placeholderImage string
+
+	// scheduling defines the default pod scheduling
+	// settings, which are merged with the pipeline
+	// scheduling settings.
+	scheduling engine.KubeConfig
+
+	// allowedPullSecrets defines the image pull secrets
+	// that pipelines may use by name.
+	allowedPullSecrets []string
+
+	// serviceAccount defines the service account used to
+	// run pipeline pods, which cannot be set by the
+	// pipeline.
+	serviceAccount string
+
+	// sourceNamespace defines the namespace from which the
+	// service account and image pull secrets are copied.
+	sourceNamespace string
+
+	// automountToken configures the engine to mount the
+	// service account token in pipeline pods.
+	automountToken bool
+
+	// scheduleTimeout defines how long a pod may remain
+	// unschedulable before the step fails.
+	scheduleTimeout time.Duration
+}
+
+// defaultOptions returns the default engine options.
+func defaultOptions() options {
+	return options{
+		volumeSize: defaultVolumeSize,
+		hostPath:   defaultHostPath,
+		initImage:  defaultInitImage,
+
+		placeholderImage: defaultPlaceholderImage,
+		scheduleTimeout:  defaultScheduleTimeout,
+		sourceNamespace:  defaultSourceNamespace,
+	}
+}
+
+// WithNode pins all pipeline pods to the named node. This
+// is required when empty_dir volumes are backed by host
+// machine directories on a multi-node cluster.
+func WithNode(node string) Option {
+	return func(e *kubeEngine) {
+		e.node = node
+	}
+}
+
+// WithVolumeClaim configures the engine to back empty_dir
+// volumes with persistent volume claims, which can be
+// shared by step pods scheduled to different nodes. If the
+// storage class is empty, the cluster default is used.
+func WithVolumeClaim(storageClass string, size resource.Quantity) Option {
+	return func(e *kubeEngine) {
+		e.claim = true
+		e.storageClass = storageClass
+		if !size.IsZero() {
+			e.volumeSize = size
+		}
+	}
+}
+
+// WithHostPath sets the host machine directory in which
+// empty_dir volumes are created. The volume data is removed
+// by a cleanup pod when the pipeline is destroyed. This
+// option is ignored when volumes are backed by persistent
+// volume claims.
+func WithHostPath(path string) Option {
+	return func(e *kubeEngine) {
+		if path != "" {
+			e.hostPath = path
+		}
+	}
+}
+
+// WithNamespacePrefix sets the prefix added to the name of
+// pipeline namespaces.
+func WithNamespacePrefix(prefix string) Option {
+	return func(e *kubeEngine) {
+		e.namespacePrefix = prefix
+	}
+}
+
+// WithLabels sets the labels added to all resources created
+// by the engine, including the pipeline namespace.
+func WithLabels(labels map[string]string) Option {
+	return func(e *kubeEngine) {
+		e.labels = labels
+	}
+}
+
+// WithResources sets the default container resource
+// requirements, used when the resource limits and requests
+// are not defined by the step.
+func WithResources(resources *engine.Resources) Option {
+	return func(e *kubeEngine) {
+		e.resources = resources
+	}
+}
+
+// WithNetworkPolicy isolates the pipeline namespace with a
+// network policy. Step pods can reach other pods in the
+// pipeline namespace, the cluster dns service, and the
+// given egress destinations. All other traffic is denied.
+func WithNetworkPolicy(egress ...*Egress) Option {
+	return func(e *kubeEngine) {
+		e.networkPolicy = true
+		e.egress = egress
+	}
+}
+
+// WithResourceQuota limits the compute resources of the
+// pipeline namespace to the sum of the step resources, and
+// applies the default resources to containers that do not
+// define resources.
+func WithResourceQuota() Option {
+	return func(e *kubeEngine) {
+		e.quota = true
+	}
+}
+
+// WithInitImage sets the image used to write files to the
+// pod file system, to copy the entrypoint shim, and to
+// remove volume data from the host machine. The image must provide
+// a posix shell and a statically linked /bin/busybox.
+func WithInitImage(image string) Option {
+	return func(e *kubeEngine) {
+		if image != "" {
+			e.initImage = image
+		}
+	}
+}
+
+// WithSinglePod configures the engine to execute all
+// pipeline steps in a single pod. Steps share empty_dir
+// volumes and can reach each other on localhost, and the
+// pod is only scheduled once.
+func WithSinglePod() Option {
+	return func(e *kubeEngine) {
+		e.singlePod = true
+	}
+}
+
+// WithPlaceholderImage sets the image used for step
+// containers that have not yet started, when all steps are
+// executed in a single pod. The image must ignore its
+// arguments and sleep until the container is stopped.
+func WithPlaceholderImage(image string) Option {
+	return func(e *kubeEngine) {
+		if image != "" {
+			e.placeholderImage = image
+		}
+	}
+}
+
+// WithScheduleTimeout sets how long a pod may remain
+// unschedulable before the step fails. A pod is temporarily
+// unschedulable while the cluster autoscaler adds nodes, or
+// while a volume claim is bound.
+func WithScheduleTimeout(d time.Duration) Option {
+	return func(e *kubeEngine) {
+		if d > 0 {
+			e.scheduleTimeout = d
+		}
+	}
+}
+
+// WithNodeSelector sets the default node selector used to
+// schedule pipeline pods.
+func WithNodeSelector(selector map[string]string) Option {
+	return func(e *kubeEngine) {
+		e.scheduling.NodeSelector = selector
+	}
+}
+
+// WithTolerations sets the default tolerations used to
+// schedule pipeline pods to tainted nodes.
+func WithTolerations(tolerations ...*engine.Toleration) Option {
+	return func(e *kubeEngine) {
+		e.scheduling.Tolerations = tolerations
+	}
+}
+
+// WithServiceAccount sets the service account used to run
+// pipeline pods. The service account is copied from the
+// source namespace to the pipeline namespace, and cannot be
+// changed by the pipeline.
+func WithServiceAccount(name string) Option {
+	return func(e *kubeEngine) {
+		e.serviceAccount = name
+	}
+}
+
+// WithServiceAccountToken configures the engine to mount
+// the service account token in pipeline pods. The token is
+// not mounted by default.
+func WithServiceAccountToken() Option {
+	return func(e *kubeEngine) {
+		e.automountToken = true
+	}
+}
+
+// WithSourceNamespace sets the namespace from which the
+// service account and image pull secrets are copied to the
+// pipeline namespace.
+func WithSourceNamespace(namespace string) Option {
+	return func(e *kubeEngine) {
+		if namespace != "" {
+			e.sourceNamespace = namespace
+		}
+	}
+}
+
+// WithPriorityClass sets the default priority class of
+// pipeline pods.
+func WithPriorityClass(name string) Option {
+	return func(e *kubeEngine) {
+		e.scheduling.PriorityClass = name
+	}
+}
+
+// WithRuntimeClass sets the default runtime class of
+// pipeline pods.
+func WithRuntimeClass(name string) Option {
+	return func(e *kubeEngine) {
+		e.scheduling.RuntimeClass = name
+	}
+}
+
+// WithPodAnnotations sets the default annotations added
+// to pipeline pods.
+func WithPodAnnotations(annotations map[string]string) Option {
+	return func(e *kubeEngine) {
+		e.scheduling.Annotations = annotations
+	}
+}
+
+// WithPodLabels sets the default labels added to pipeline
+// pods.
+func WithPodLabels(labels map[string]string) Option {
+	return func(e *kubeEngine) {
+		e.scheduling.Labels = labels
+	}
+}
+
+// WithImagePullSecrets sets the names of existing secrets
+// used to pull pipeline images. The secrets are copied from
+// the source namespace to the pipeline namespace.
+func WithImagePullSecrets(names ...string) Option {
+	return func(e *kubeEngine) {
+		e.scheduling.ImagePullSecrets = names
+	}
+}
+
+// WithAllowedPullSecrets sets the names of existing secrets
+// that pipelines may use to pull images. Pipelines cannot
+// use other secrets, since the secrets are copied from the
+// source namespace to the pipeline namespace.
+func WithAllowedPullSecrets(names ...string) Option {
+	return func(e *kubeEngine) {
+		e.allowedPullSecrets = names
+	}
+}
+
+// WithRestConfig sets the rest client configuration used to
+// execute commands in pods, for example, to debug a failed
+// step. It is set by NewFile and NewInCluster.
+func WithRestConfig(config *rest.Config) Option {
+	return func(e *kubeEngine) {
+		e.config = config
+	}
+}
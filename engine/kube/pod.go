@@ -0,0 +1,335 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Drone Non-Commercial License
+// that can be found in the LICENSE file.
+
+package kube
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path"
+
+	"github.com/drone/drone-runtime/engine"
+
+	"github.com/docker/distribution/reference"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+)
+
+// defaultPlaceholderImage defines the default image used
+// for step containers that have not yet started.
+const defaultPlaceholderImage = "drone/placeholder:1"
+
+const (
+	// shimVolume defines the name of the emptyDir volume
+	// that stores the entrypoint shim.
+	shimVolume = "drone-shim"
+
+	// shimPath defines the path where the entrypoint shim
+	// is mounted in the step containers.
+	shimPath = "/usr/drone/bin"
+)
+
+// shimScript defines the entrypoint shim script. The script
+// creates a marker file and sleeps when first executed with
+// the placeholder image. The container is only restarted
+// when the image is replaced with the step image, in which
+// case the marker file exists, and the step command is
+// executed. The script is executed with the statically
+// linked busybox binary copied from the init image, and
+// therefore does not depend on the image file system.
+const shimScript = `if [ -e %[1]s/%[2]s ]; then exec "$@"; fi
+%[1]s/busybox touch %[1]s/%[2]s
+trap 'exit 0' TERM
+%[1]s/busybox sleep 2147483647 &
+wait`
+
+// podEngine executes all pipeline steps as containers in
+// a single pod. The pod is created when the pipeline is
+// setup, with placeholder images for all step containers.
+// The placeholder image is replaced with the step image
+// when the step is started, which restarts the container.
+// Note that kubernetes only permits updates to the image of
+// a pod container, and steps that define a command are
+// therefore executed with an entrypoint shim.
+type podEngine struct {
+	*kubeEngine
+}
+
+func (e *podEngine) Setup(ctx context.Context, spec *engine.Spec) error {
+	if err := e.kubeEngine.Setup(ctx, spec); err != nil {
+		return err
+	}
+	pod := toPipelinePod(spec, &e.options)
+	_, err := e.client.CoreV1().
+		Pods(toNamespaceName(spec, &e.options)).
+		Create(pod)
+	return err
+}
+
+func (e *podEngine) Start(ctx context.Context, spec *engine.Spec, step *engine.Step) error {
+	pods := e.client.CoreV1().Pods(toNamespaceName(spec, &e.options))
+
+	// the pod is updated by the kubelet as containers
+	// change state, so the image update is retried if
+	// the pod was modified since it was read.
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		pod, err := pods.Get(spec.Metadata.UID, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		for i, container := range pod.Spec.Containers {
+			if container.Name == step.Metadata.UID {
+				pod.Spec.Containers[i].Image = step.Docker.Image
+			}
+		}
+		_, err = pods.Update(pod)
+		return err
+	})
+}
+
+func (e *podEngine) Wait(ctx context.Context, spec *engine.Spec, step *engine.Step) (*engine.State, error) {
+	watcher, err := e.watcher(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	pod, err := watcher.wait(ctx, spec.Metadata.UID, func(pod *v1.Pod) (bool, error) {
+		if err := toPodError(step, pod, e.scheduleTimeout); err != nil {
+			return false, err
+		}
+		status, ok := lookupStatus(step, pod)
+		if !ok || !isStepImage(step, status) {
+			return false, nil
+		}
+		return status.State.Terminated != nil, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return toState(step, pod)
+}
+
+func (e *podEngine) Tail(ctx context.Context, spec *engine.Spec, step *engine.Step) (io.ReadCloser, error) {
+	watcher, err := e.watcher(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = watcher.wait(ctx, spec.Metadata.UID, func(pod *v1.Pod) (bool, error) {
+		if err := toPodError(step, pod, e.scheduleTimeout); err != nil {
+			return false, err
+		}
+		status, ok := lookupStatus(step, pod)
+		if !ok || !isStepImage(step, status) {
+			return false, nil
+		}
+		return status.State.Running != nil || status.State.Terminated != nil, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	opts := &v1.PodLogOptions{
+		Container: step.Metadata.UID,
+		Follow:    true,
+	}
+
+	return e.client.CoreV1().
+		Pods(toNamespaceName(spec, &e.options)).
+		GetLogs(spec.Metadata.UID, opts).
+		Stream()
+}
+
+// helper function returns true if the container status
+// reports the step image, and not the placeholder image.
+// The container is restarted when the image is replaced,
+// which is used as a fallback if the container runtime
+// reports the image by identifier.
+func isStepImage(step *engine.Step, status v1.ContainerStatus) bool {
+	return status.RestartCount > 0 ||
+		normalizeImage(status.Image) == normalizeImage(step.Docker.Image)
+}
+
+// helper function returns the normalized image name, so
+// that images can be compared regardless of the registry
+// and tag defaults.
+func normalizeImage(image string) string {
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return image
+	}
+	return reference.TagNameOnly(named).String()
+}
+
+// helper function returns the pipeline pod, which contains
+// a container for every pipeline step. Step containers use
+// the placeholder image until the step is started.
+func toPipelinePod(spec *engine.Spec, opts *options) *v1.Pod {
+	conf := toScheduling(spec, opts)
+
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        spec.Metadata.UID,
+			Namespace:   toNamespaceName(spec, opts),
+			Labels:      mergeMaps(mergeMaps(opts.labels, conf.Labels), spec.Metadata.Labels),
+			Annotations: conf.Annotations,
+		},
+	}
+
+	// steps share the pod network namespace, and are
+	// reachable by name on localhost, matching the docker
+	// network alias.
+	localhost := v1.HostAlias{IP: "127.0.0.1"}
+
+	volumes := map[string]bool{}
+	sysctls := map[string]bool{}
+	for i, step := range spec.Steps {
+		from := toPod(spec, step, opts)
+		if i == 0 {
+			// the scheduling settings are the same for
+			// every step pod.
+			pod.Spec = from.Spec
+			pod.Spec.Containers = nil
+			pod.Spec.InitContainers = nil
+			pod.Spec.Volumes = nil
+			pod.Spec.HostAliases = nil
+			pod.Spec.SecurityContext = nil
+			pod.Spec.DNSConfig = nil
+		}
+
+		container := toPlaceholder(from.Spec.Containers[0], step, opts)
+		pod.Spec.Containers = append(pod.Spec.Containers, container)
+
+		for _, c := range from.Spec.InitContainers {
+			c.Name = c.Name + "-" + step.Metadata.UID
+			pod.Spec.InitContainers = append(pod.Spec.InitContainers, c)
+		}
+		for _, volume := range from.Spec.Volumes {
+			if !volumes[volume.Name] {
+				volumes[volume.Name] = true
+				pod.Spec.Volumes = append(pod.Spec.Volumes, volume)
+			}
+		}
+		if ctx := from.Spec.SecurityContext; ctx != nil {
+			if pod.Spec.SecurityContext == nil {
+				pod.Spec.SecurityContext = &v1.PodSecurityContext{}
+			}
+			for _, sysctl := range ctx.Sysctls {
+				if !sysctls[sysctl.Name] {
+					sysctls[sysctl.Name] = true
+					pod.Spec.SecurityContext.Sysctls = append(pod.Spec.SecurityContext.Sysctls, sysctl)
+				}
+			}
+		}
+		pod.Spec.HostAliases = append(pod.Spec.HostAliases, from.Spec.HostAliases...)
+		if dns := from.Spec.DNSConfig; dns != nil {
+			if pod.Spec.DNSConfig == nil {
+				pod.Spec.DNSConfig = &v1.PodDNSConfig{}
+			}
+			pod.Spec.DNSConfig.Nameservers = appendUnique(pod.Spec.DNSConfig.Nameservers, dns.Nameservers...)
+			pod.Spec.DNSConfig.Searches = appendUnique(pod.Spec.DNSConfig.Searches, dns.Searches...)
+		}
+		pod.Annotations = mergeMaps(pod.Annotations, toSecurityAnnotations(step))
+		localhost.Hostnames = append(localhost.Hostnames, toServiceName(spec, step))
+	}
+	if len(localhost.Hostnames) != 0 {
+		pod.Spec.HostAliases = append(pod.Spec.HostAliases, localhost)
+	}
+	if hasCommand(spec) {
+		pod.Spec.InitContainers = append(pod.Spec.InitContainers, toShimContainer(opts))
+		pod.Spec.Volumes = append(pod.Spec.Volumes, toShimVolume())
+	}
+	return pod
+}
+
+// helper function returns the placeholder container for
+// the step container. If the step defines a command, the
+// command is executed with the entrypoint shim, since the
+// command cannot be updated when the step is started, and
+// would otherwise override the placeholder entrypoint. If
+// the step does not define a command, the image entrypoint
+// is used, and the placeholder image must ignore the step
+// arguments.
+func toPlaceholder(container v1.Container, step *engine.Step, opts *options) v1.Container {
+	container.Image = opts.placeholderImage
+	if len(step.Docker.Command) == 0 {
+		return container
+	}
+	container.Command = []string{
+		path.Join(shimPath, "busybox"), "sh", "-c",
+		fmt.Sprintf(shimScript, shimPath, step.Metadata.UID),
+		"drone-shim",
+	}
+	container.Args = append(append([]string{}, step.Docker.Command...), step.Docker.Args...)
+	container.VolumeMounts = append(container.VolumeMounts, toShimMount())
+	return container
+}
+
+// helper function returns true if any step defines a
+// command, in which case the entrypoint shim is required.
+func hasCommand(spec *engine.Spec) bool {
+	for _, step := range spec.Steps {
+		if step.Docker != nil && len(step.Docker.Command) != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// helper function returns the init container that copies
+// the entrypoint shim to the shim volume, and links the
+// shell, which can be used to debug images without a shell.
+// The init image must provide a statically linked busybox
+// binary.
+func toShimContainer(opts *options) v1.Container {
+	return v1.Container{
+		Name:            shimVolume,
+		Image:           opts.initImage,
+		ImagePullPolicy: v1.PullIfNotPresent,
+		Command:         []string{"/bin/sh", "-c"},
+		Args: []string{
+			fmt.Sprintf("cp /bin/busybox %[1]s/busybox && ln -s busybox %[1]s/sh", shimPath),
+		},
+		VolumeMounts: []v1.VolumeMount{toShimMount()},
+	}
+}
+
+// helper function returns the emptyDir volume that stores
+// the entrypoint shim.
+func toShimVolume() v1.Volume {
+	return v1.Volume{
+		Name: shimVolume,
+		VolumeSource: v1.VolumeSource{
+			EmptyDir: &v1.EmptyDirVolumeSource{},
+		},
+	}
+}
+
+// helper function returns the entrypoint shim volume mount.
+func toShimMount() v1.VolumeMount {
+	return v1.VolumeMount{
+		Name:      shimVolume,
+		MountPath: shimPath,
+	}
+}
+
+// helper function appends the values that are not already
+// in the slice.
+func appendUnique(to []string, values ...string) []string {
+	for _, v := range values {
+		found := false
+		for _, s := range to {
+			if s == v {
+				found = true
+				break
+			}
+		}
+		if !found {
+			to = append(to, v)
+		}
+	}
+	return to
+}
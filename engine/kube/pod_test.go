@@ -0,0 +1,252 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Drone Non-Commercial License
+// that can be found in the LICENSE file.
+
+package kube
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/drone/drone-runtime/engine"
+
+	"github.com/google/go-cmp/cmp"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// helper function returns a pipeline specification with a
+// detached service and a build step.
+func newPipelineSpec() *engine.Spec {
+	workspace := []*engine.VolumeMount{
+		{Name: "workspace", Path: "/drone/src"},
+	}
+	return &engine.Spec{
+		Metadata: engine.Metadata{
+			UID:       "uid-pipeline",
+			Namespace: "ns-pipeline",
+		},
+		Docker: &engine.DockerConfig{
+			Volumes: []*engine.Volume{
+				{
+					Metadata: engine.Metadata{UID: "uid-volume", Name: "workspace"},
+					EmptyDir: &engine.VolumeEmptyDir{},
+				},
+			},
+		},
+		Steps: []*engine.Step{
+			{
+				Metadata: engine.Metadata{UID: "uid-redis", Name: "redis"},
+				Detach:   true,
+				Docker:   &engine.DockerStep{Image: "redis"},
+			},
+			{
+				Metadata: engine.Metadata{UID: "uid-build", Name: "build"},
+				Docker: &engine.DockerStep{
+					Image:      "golang:1.11",
+					ExtraHosts: []string{"example.com:10.0.0.1"},
+				},
+				Volumes: workspace,
+			},
+		},
+	}
+}
+
+func TestToPipelinePod(t *testing.T) {
+	opts := defaultOptions()
+	opts.singlePod = true
+	spec := newPipelineSpec()
+
+	pod := toPipelinePod(spec, &opts)
+	if got, want := pod.Name, "uid-pipeline"; got != want {
+		t.Errorf("Want pod name %q, got %q", want, got)
+	}
+	if got, want := len(pod.Spec.Containers), 2; got != want {
+		t.Errorf("Want %d containers, got %d", want, got)
+		return
+	}
+	for _, container := range pod.Spec.Containers {
+		if got, want := container.Image, defaultPlaceholderImage; got != want {
+			t.Errorf("Want placeholder image %q, got %q", want, got)
+		}
+	}
+	if len(pod.Spec.Volumes) != 1 || pod.Spec.Volumes[0].EmptyDir == nil {
+		t.Errorf("Want workspace backed by empty_dir volume")
+	}
+	aliases := []v1.HostAlias{
+		{IP: "10.0.0.1", Hostnames: []string{"example.com"}},
+		{IP: "127.0.0.1", Hostnames: []string{"redis", "build"}},
+	}
+	if diff := cmp.Diff(aliases, pod.Spec.HostAliases); diff != "" {
+		t.Errorf("Unexpected host aliases")
+		t.Log(diff)
+	}
+}
+
+func TestToPipelinePodShim(t *testing.T) {
+	opts := defaultOptions()
+	opts.singlePod = true
+	spec := newPipelineSpec()
+	spec.Steps[1].Docker.Command = []string{"/bin/sh", "-c"}
+	spec.Steps[1].Docker.Args = []string{"go test"}
+
+	pod := toPipelinePod(spec, &opts)
+
+	// the service does not define a command, and the
+	// placeholder image entrypoint is used.
+	service := pod.Spec.Containers[0]
+	if len(service.Command) != 0 || len(service.Args) != 0 {
+		t.Errorf("Want placeholder entrypoint for step without command")
+	}
+
+	// the step command is executed by the entrypoint shim,
+	// and the step command is passed as arguments.
+	build := pod.Spec.Containers[1]
+	if got, want := build.Image, defaultPlaceholderImage; got != want {
+		t.Errorf("Want placeholder image %q, got %q", want, got)
+	}
+	if got, want := build.Command[0], "/usr/drone/bin/busybox"; got != want {
+		t.Errorf("Want shim command %q, got %q", want, got)
+	}
+	if !strings.Contains(build.Command[3], "/usr/drone/bin/uid-build") {
+		t.Errorf("Want shim marker file named by the step")
+	}
+	if diff := cmp.Diff([]string{"/bin/sh", "-c", "go test"}, build.Args); diff != "" {
+		t.Errorf("Want step command passed to the shim")
+		t.Log(diff)
+	}
+	mount := build.VolumeMounts[len(build.VolumeMounts)-1]
+	if mount.Name != shimVolume || mount.MountPath != shimPath {
+		t.Errorf("Want shim volume mounted in the step container")
+	}
+
+	var init *v1.Container
+	for i, c := range pod.Spec.InitContainers {
+		if c.Name == shimVolume {
+			init = &pod.Spec.InitContainers[i]
+		}
+	}
+	if init == nil {
+		t.Errorf("Want shim init container")
+		return
+	}
+	if got, want := init.Image, defaultInitImage; got != want {
+		t.Errorf("Want shim init image %q, got %q", want, got)
+	}
+	if got, want := pod.Spec.Volumes[len(pod.Spec.Volumes)-1].Name, shimVolume; got != want {
+		t.Errorf("Want shim volume, got %q", got)
+	}
+
+	// the step does not modify the pipeline definition.
+	if got, want := len(spec.Steps[1].Docker.Args), 1; got != want {
+		t.Errorf("Want step arguments unchanged")
+	}
+}
+
+func TestToPipelinePodNoShim(t *testing.T) {
+	opts := defaultOptions()
+	opts.singlePod = true
+	pod := toPipelinePod(newPipelineSpec(), &opts)
+	if got := len(pod.Spec.InitContainers); got != 0 {
+		t.Errorf("Want no shim init container when no step defines a command")
+	}
+}
+
+func TestPodEngine(t *testing.T) {
+	spec := newPipelineSpec()
+	step := spec.Steps[1]
+	step.Docker.Command = []string{"/bin/sh", "-c"}
+	step.Docker.Args = []string{"go test"}
+
+	client := fake.NewSimpleClientset()
+	e, ok := New(client, WithSinglePod()).(*podEngine)
+	if !ok {
+		t.Errorf("Want single pod engine")
+		return
+	}
+	if err := e.Setup(context.Background(), spec); err != nil {
+		t.Error(err)
+		return
+	}
+	defer e.Destroy(context.Background(), spec)
+
+	if err := e.Start(context.Background(), spec, step); err != nil {
+		t.Error(err)
+		return
+	}
+
+	pods := client.CoreV1().Pods("ns-pipeline")
+	pod, err := pods.Get("uid-pipeline", metav1.GetOptions{})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if got, want := pod.Spec.Containers[0].Image, defaultPlaceholderImage; got != want {
+		t.Errorf("Want placeholder image for service not yet started, got %q", got)
+	}
+	if got, want := pod.Spec.Containers[1].Image, "golang:1.11"; got != want {
+		t.Errorf("Want step image %q, got %q", want, got)
+	}
+
+	// only the image is updated when the step is started,
+	// since kubernetes rejects updates to the command.
+	placeholder := toPipelinePod(spec, &e.options).Spec.Containers[1]
+	placeholder.Image = "golang:1.11"
+	if diff := cmp.Diff(placeholder, pod.Spec.Containers[1]); diff != "" {
+		t.Errorf("Want only the image updated when the step is started")
+		t.Log(diff)
+	}
+
+	// the placeholder container status is ignored while
+	// waiting for the step container to exit.
+	pod.Status = v1.PodStatus{
+		Phase: v1.PodRunning,
+		ContainerStatuses: []v1.ContainerStatus{
+			{
+				Name:  "uid-redis",
+				Image: defaultPlaceholderImage,
+				State: v1.ContainerState{Running: &v1.ContainerStateRunning{}},
+			},
+			{
+				Name:  "uid-build",
+				Image: "docker.io/library/golang:1.11",
+				State: v1.ContainerState{
+					Terminated: &v1.ContainerStateTerminated{ExitCode: 1},
+				},
+			},
+		},
+	}
+	if _, err := pods.UpdateStatus(pod); err != nil {
+		t.Error(err)
+		return
+	}
+
+	state, err := e.Wait(context.Background(), spec, step)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if got, want := state.ExitCode, 1; got != want {
+		t.Errorf("Want exit code %d, got %d", want, got)
+	}
+}
+
+func TestIsStepImage(t *testing.T) {
+	step := &engine.Step{Docker: &engine.DockerStep{Image: "golang:1.11"}}
+	tests := []struct {
+		status v1.ContainerStatus
+		want   bool
+	}{
+		{v1.ContainerStatus{Image: "golang:1.11"}, true},
+		{v1.ContainerStatus{Image: "docker.io/library/golang:1.11"}, true},
+		{v1.ContainerStatus{Image: "sha256:b5fb3d8b", RestartCount: 1}, true},
+		{v1.ContainerStatus{Image: "drone/placeholder:1"}, false},
+	}
+	for _, test := range tests {
+		if got := isStepImage(step, test.status); got != test.want {
+			t.Errorf("Want step image %v for %q", test.want, test.status.Image)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Drone Non-Commercial License
+// that can be found in the LICENSE file.
+
+package kube
+
+import (
+	"github.com/drone/drone-runtime/engine"
+
+	"k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// Egress defines a destination that step pods are allowed
+// to reach when the pipeline namespace is isolated. Note
+// that network policies cannot match host names, so
+// external services, such as registries, must be defined
+// by address range.
+type Egress struct {
+	// CIDR defines the destination address range.
+	CIDR string
+
+	// Except defines address ranges excluded from the
+	// destination address range.
+	Except []string
+
+	// Ports defines the allowed destination tcp ports. If
+	// both Ports and UDPPorts are empty, all ports are
+	// allowed.
+	Ports []int
+
+	// UDPPorts defines the allowed destination udp ports.
+	UDPPorts []int
+}
+
+// helper function returns the network policy used to
+// isolate the pipeline namespace, or nil if disabled.
+func toNetworkPolicy(spec *engine.Spec, opts *options) *networkingv1.NetworkPolicy {
+	if !opts.networkPolicy {
+		return nil
+	}
+
+	// peer that matches all pods in the pipeline
+	// namespace.
+	namespace := []networkingv1.NetworkPolicyPeer{{
+		PodSelector: &metav1.LabelSelector{},
+	}}
+
+	// peer that matches the cluster dns pods. The
+	// namespace name label is set automatically since
+	// kubernetes 1.21, and must be added to the kube-system
+	// namespace in older clusters.
+	dns := []networkingv1.NetworkPolicyPeer{{
+		NamespaceSelector: &metav1.LabelSelector{
+			MatchLabels: map[string]string{
+				"kubernetes.io/metadata.name": "kube-system",
+			},
+		},
+		PodSelector: &metav1.LabelSelector{
+			MatchLabels: map[string]string{
+				"k8s-app": "kube-dns",
+			},
+		},
+	}}
+
+	egress := []networkingv1.NetworkPolicyEgressRule{
+		{To: namespace},
+		{
+			To: dns,
+			Ports: []networkingv1.NetworkPolicyPort{
+				toPolicyPort(v1.ProtocolUDP, 53),
+				toPolicyPort(v1.ProtocolTCP, 53),
+			},
+		},
+	}
+	for _, dest := range opts.egress {
+		rule := networkingv1.NetworkPolicyEgressRule{
+			To: []networkingv1.NetworkPolicyPeer{{
+				IPBlock: &networkingv1.IPBlock{
+					CIDR:   dest.CIDR,
+					Except: dest.Except,
+				},
+			}},
+		}
+		for _, port := range dest.Ports {
+			rule.Ports = append(rule.Ports, toPolicyPort(v1.ProtocolTCP, port))
+		}
+		for _, port := range dest.UDPPorts {
+			rule.Ports = append(rule.Ports, toPolicyPort(v1.ProtocolUDP, port))
+		}
+		egress = append(egress, rule)
+	}
+
+	return &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "drone-isolation",
+			Namespace: toNamespaceName(spec, opts),
+			Labels:    opts.labels,
+		},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{},
+			PolicyTypes: []networkingv1.PolicyType{
+				networkingv1.PolicyTypeIngress,
+				networkingv1.PolicyTypeEgress,
+			},
+			Ingress: []networkingv1.NetworkPolicyIngressRule{
+				{From: namespace},
+			},
+			Egress: egress,
+		},
+	}
+}
+
+// helper function returns a network policy port.
+func toPolicyPort(protocol v1.Protocol, port int) networkingv1.NetworkPolicyPort {
+	p := intstr.FromInt(port)
+	return networkingv1.NetworkPolicyPort{
+		Protocol: &protocol,
+		Port:     &p,
+	}
+}
+
+// helper function returns the resource quota for the
+// pipeline namespace, or nil if disabled. The quota is the
+// sum of the step resources. A resource is only limited if
+// it is defined for every step, since kubernetes rejects
+// pods that do not define a limited resource.
+func toResourceQuota(spec *engine.Spec, opts *options) *v1.ResourceQuota {
+	if !opts.quota {
+		return nil
+	}
+	hard := v1.ResourceList{
+		v1.ResourcePods: *resource.NewQuantity(int64(len(spec.Steps)), resource.DecimalSI),
+	}
+	keys := map[v1.ResourceName]v1.ResourceName{
+		v1.ResourceLimitsCPU:      v1.ResourceCPU,
+		v1.ResourceLimitsMemory:   v1.ResourceMemory,
+		v1.ResourceRequestsCPU:    v1.ResourceCPU,
+		v1.ResourceRequestsMemory: v1.ResourceMemory,
+	}
+	for key, name := range keys {
+		total, ok := sumResources(spec, opts, key, name)
+		if ok {
+			hard[key] = total
+		}
+	}
+	return &v1.ResourceQuota{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "drone-quota",
+			Namespace: toNamespaceName(spec, opts),
+			Labels:    opts.labels,
+		},
+		Spec: v1.ResourceQuotaSpec{
+			Hard: hard,
+		},
+	}
+}
+
+// helper function returns the sum of the named step
+// resource, and false if the resource is not defined for
+// every step.
+func sumResources(spec *engine.Spec, opts *options, key, name v1.ResourceName) (resource.Quantity, bool) {
+	var total resource.Quantity
+	if len(spec.Steps) == 0 {
+		return total, false
+	}
+	for _, step := range spec.Steps {
+		resources := toResources(step, opts)
+		list := resources.Limits
+		if key == v1.ResourceRequestsCPU || key == v1.ResourceRequestsMemory {
+			list = resources.Requests
+		}
+		value, ok := list[name]
+		if !ok {
+			return total, false
+		}
+		total.Add(value)
+	}
+	return total, true
+}
+
+// helper function returns the limit range used to apply
+// the default resources to containers in the pipeline
+// namespace that do not define resources, or nil if
+// disabled or no default resources are defined.
+func toLimitRange(spec *engine.Spec, opts *options) *v1.LimitRange {
+	if !opts.quota || opts.resources == nil {
+		return nil
+	}
+	item := v1.LimitRangeItem{
+		Type:           v1.LimitTypeContainer,
+		Default:        toResourceList(opts.resources.Limits, nil),
+		DefaultRequest: toResourceList(opts.resources.Requests, nil),
+	}
+	if len(item.Default) == 0 && len(item.DefaultRequest) == 0 {
+		return nil
+	}
+	return &v1.LimitRange{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "drone-limits",
+			Namespace: toNamespaceName(spec, opts),
+			Labels:    opts.labels,
+		},
+		Spec: v1.LimitRangeSpec{
+			Limits: []v1.LimitRangeItem{item},
+		},
+	}
+}
@@ -0,0 +1,161 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Drone Non-Commercial License
+// that can be found in the LICENSE file.
+
+package kube
+
+import (
+	"testing"
+
+	"github.com/drone/drone-runtime/engine"
+
+	"k8s.io/api/core/v1"
+)
+
+func TestToNetworkPolicy(t *testing.T) {
+	e := &kubeEngine{options: defaultOptions()}
+	spec := &engine.Spec{
+		Metadata: engine.Metadata{Namespace: "ns-pipeline"},
+	}
+	if toNetworkPolicy(spec, &e.options) != nil {
+		t.Errorf("Want no network policy by default")
+	}
+
+	WithNetworkPolicy(&Egress{CIDR: "10.0.0.0/8", Ports: []int{443}, UDPPorts: []int{123}})(e)
+	policy := toNetworkPolicy(spec, &e.options)
+	if policy == nil {
+		t.Errorf("Want network policy")
+		return
+	}
+	if got, want := policy.Namespace, "ns-pipeline"; got != want {
+		t.Errorf("Want namespace %q, got %q", want, got)
+	}
+	if got, want := len(policy.Spec.PolicyTypes), 2; got != want {
+		t.Errorf("Want ingress and egress policy types")
+	}
+	if got, want := len(policy.Spec.Egress), 3; got != want {
+		t.Errorf("Want %d egress rules, got %d", want, got)
+		return
+	}
+	dns := policy.Spec.Egress[1]
+	if len(dns.Ports) != 2 || dns.Ports[0].Port.IntValue() != 53 {
+		t.Errorf("Want dns egress allowed")
+	}
+	// dns egress must be limited to the cluster dns pods,
+	// otherwise dns can be used to reach any address.
+	if len(dns.To) != 1 {
+		t.Errorf("Want dns egress limited to a single peer")
+	} else {
+		peer := dns.To[0]
+		if peer.IPBlock != nil {
+			t.Errorf("Want no dns egress address range")
+		}
+		if peer.NamespaceSelector == nil || peer.NamespaceSelector.MatchLabels["kubernetes.io/metadata.name"] != "kube-system" {
+			t.Errorf("Want dns egress limited to the kube-system namespace")
+		}
+		if peer.PodSelector == nil || peer.PodSelector.MatchLabels["k8s-app"] != "kube-dns" {
+			t.Errorf("Want dns egress limited to the kube-dns pods")
+		}
+	}
+	rule := policy.Spec.Egress[2]
+	if got, want := rule.To[0].IPBlock.CIDR, "10.0.0.0/8"; got != want {
+		t.Errorf("Want egress cidr %q, got %q", want, got)
+	}
+	if got, want := len(rule.Ports), 2; got != want {
+		t.Errorf("Want %d egress ports, got %d", want, got)
+		return
+	}
+	if got, want := rule.Ports[0].Port.IntValue(), 443; got != want {
+		t.Errorf("Want egress port %d, got %d", want, got)
+	}
+	if got, want := *rule.Ports[0].Protocol, v1.ProtocolTCP; got != want {
+		t.Errorf("Want egress protocol %s, got %s", want, got)
+	}
+	if got, want := rule.Ports[1].Port.IntValue(), 123; got != want {
+		t.Errorf("Want egress port %d, got %d", want, got)
+	}
+	if got, want := *rule.Ports[1].Protocol, v1.ProtocolUDP; got != want {
+		t.Errorf("Want egress protocol %s, got %s", want, got)
+	}
+}
+
+func TestToResourceQuota(t *testing.T) {
+	e := &kubeEngine{options: defaultOptions()}
+	spec := &engine.Spec{
+		Steps: []*engine.Step{
+			{
+				Resources: &engine.Resources{
+					Limits:   &engine.ResourceObject{CPU: 1000, Memory: 1073741824},
+					Requests: &engine.ResourceObject{CPU: 250},
+				},
+			},
+			{
+				Resources: &engine.Resources{
+					Limits: &engine.ResourceObject{CPU: 500},
+				},
+			},
+		},
+	}
+	if toResourceQuota(spec, &e.options) != nil {
+		t.Errorf("Want no resource quota by default")
+	}
+
+	WithResourceQuota()(e)
+	quota := toResourceQuota(spec, &e.options)
+	if quota == nil {
+		t.Errorf("Want resource quota")
+		return
+	}
+	hard := quota.Spec.Hard
+	if got, want := hard.Pods().String(), "2"; got != want {
+		t.Errorf("Want pod quota %s, got %s", want, got)
+	}
+	limit := hard[v1.ResourceLimitsCPU]
+	if got, want := limit.String(), "1500m"; got != want {
+		t.Errorf("Want cpu limit quota %s, got %s", want, got)
+	}
+	// resources that are not defined by every step are
+	// not limited.
+	if _, ok := hard[v1.ResourceLimitsMemory]; ok {
+		t.Errorf("Want memory limit not included in quota")
+	}
+	if _, ok := hard[v1.ResourceRequestsCPU]; ok {
+		t.Errorf("Want cpu request not included in quota")
+	}
+
+	// resources are limited when the engine default
+	// resources apply to every step.
+	WithResources(&engine.Resources{
+		Limits: &engine.ResourceObject{Memory: 536870912},
+	})(e)
+	quota = toResourceQuota(spec, &e.options)
+	limit = quota.Spec.Hard[v1.ResourceLimitsMemory]
+	if got, want := limit.String(), "1536Mi"; got != want {
+		t.Errorf("Want memory limit quota %s, got %s", want, got)
+	}
+}
+
+func TestToLimitRange(t *testing.T) {
+	e := &kubeEngine{options: defaultOptions()}
+	WithResourceQuota()(e)
+	if toLimitRange(&engine.Spec{}, &e.options) != nil {
+		t.Errorf("Want no limit range without default resources")
+	}
+
+	WithResources(&engine.Resources{
+		Limits:   &engine.ResourceObject{CPU: 1000},
+		Requests: &engine.ResourceObject{Memory: 268435456},
+	})(e)
+	limits := toLimitRange(&engine.Spec{}, &e.options)
+	if limits == nil {
+		t.Errorf("Want limit range")
+		return
+	}
+	item := limits.Spec.Limits[0]
+	if got, want := item.Default.Cpu().String(), "1"; got != want {
+		t.Errorf("Want default cpu limit %s, got %s", want, got)
+	}
+	if got, want := item.DefaultRequest.Memory().String(), "256Mi"; got != want {
+		t.Errorf("Want default memory request %s, got %s", want, got)
+	}
+}
@@ -0,0 +1,197 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Drone Non-Commercial License
+// that can be found in the LICENSE file.
+
+package kube
+
+import (
+	"fmt"
+
+	"github.com/drone/drone-runtime/engine"
+
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+)
+
+// helper function returns the pod scheduling settings for
+// the pipeline. The pipeline settings take precedence over
+// the engine defaults. Tolerations and image pull secrets
+// are appended to the engine defaults.
+func toScheduling(spec *engine.Spec, opts *options) *engine.KubeConfig {
+	from := opts.scheduling
+	to := &engine.KubeConfig{
+		NodeSelector:     mergeMaps(from.NodeSelector, nil),
+		Tolerations:      append([]*engine.Toleration(nil), from.Tolerations...),
+		PriorityClass:    from.PriorityClass,
+		RuntimeClass:     from.RuntimeClass,
+		Annotations:      mergeMaps(from.Annotations, nil),
+		Labels:           mergeMaps(from.Labels, nil),
+		ImagePullSecrets: append([]string(nil), from.ImagePullSecrets...),
+	}
+	conf := spec.Kube
+	if conf == nil {
+		return to
+	}
+	to.NodeSelector = mergeMaps(to.NodeSelector, conf.NodeSelector)
+	to.Annotations = mergeMaps(to.Annotations, conf.Annotations)
+	to.Labels = mergeMaps(to.Labels, conf.Labels)
+	to.Tolerations = append(to.Tolerations, conf.Tolerations...)
+	to.ImagePullSecrets = appendUnique(to.ImagePullSecrets, conf.ImagePullSecrets...)
+	if conf.PriorityClass != "" {
+		to.PriorityClass = conf.PriorityClass
+	}
+	if conf.RuntimeClass != "" {
+		to.RuntimeClass = conf.RuntimeClass
+	}
+	return to
+}
+
+// helper function converts the engine tolerations to
+// kubernetes tolerations.
+func toTolerations(from []*engine.Toleration) []v1.Toleration {
+	var to []v1.Toleration
+	for _, t := range from {
+		to = append(to, v1.Toleration{
+			Key:               t.Key,
+			Operator:          v1.TolerationOperator(t.Operator),
+			Value:             t.Value,
+			Effect:            v1.TaintEffect(t.Effect),
+			TolerationSeconds: t.TolerationSeconds,
+		})
+	}
+	return to
+}
+
+// helper function returns the image pull secrets for the
+// pipeline, including the registry credentials secret.
+func toPullSecrets(spec *engine.Spec, conf *engine.KubeConfig) []v1.LocalObjectReference {
+	var to []v1.LocalObjectReference
+	if spec.Docker != nil && len(spec.Docker.Auths) > 0 {
+		to = append(to, v1.LocalObjectReference{
+			Name: "docker-auth-config", // TODO move name to a const
+		})
+	}
+	for _, name := range conf.ImagePullSecrets {
+		to = append(to, v1.LocalObjectReference{Name: name})
+	}
+	return to
+}
+
+// helper function merges the maps, where the values in
+// the second map take precedence. A new map is returned,
+// or nil if both maps are empty.
+func mergeMaps(a, b map[string]string) map[string]string {
+	if len(a) == 0 && len(b) == 0 {
+		return nil
+	}
+	to := map[string]string{}
+	for k, v := range a {
+		to[k] = v
+	}
+	for k, v := range b {
+		to[k] = v
+	}
+	return to
+}
+
+// helper function returns an error if the pipeline uses an
+// image pull secret that is not allowed by the engine. The
+// secrets are copied from the source namespace, and the
+// pipeline must not use registry credentials it was not
+// granted.
+func checkPullSecrets(spec *engine.Spec, opts *options) error {
+	if spec.Kube == nil {
+		return nil
+	}
+	allowed := map[string]bool{}
+	for _, name := range opts.scheduling.ImagePullSecrets {
+		allowed[name] = true
+	}
+	for _, name := range opts.allowedPullSecrets {
+		allowed[name] = true
+	}
+	for _, name := range spec.Kube.ImagePullSecrets {
+		if !allowed[name] {
+			return fmt.Errorf("kubernetes: image pull secret %q is not allowed", name)
+		}
+	}
+	return nil
+}
+
+// helper function copies the service account and the image
+// pull secrets from the source namespace to the pipeline
+// namespace, since pods can only reference objects in their
+// own namespace. The pipeline image pull secrets must be
+// checked with checkPullSecrets before they are copied.
+func copySchedulingObjects(client kubernetes.Interface, spec *engine.Spec, opts *options, namespace string) error {
+	conf := toScheduling(spec, opts)
+
+	var account *v1.ServiceAccount
+	if name := opts.serviceAccount; name != "" {
+		var err error
+		account, err = client.CoreV1().ServiceAccounts(opts.sourceNamespace).Get(name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+	}
+	var secrets []*v1.Secret
+	for _, name := range conf.ImagePullSecrets {
+		secret, err := client.CoreV1().Secrets(opts.sourceNamespace).Get(name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		secrets = append(secrets, secret)
+	}
+
+	objects, err := toSchedulingObjects(namespace, account, secrets)
+	if err != nil {
+		return err
+	}
+	for _, obj := range objects {
+		err := createObject(client, namespace, obj)
+		// the default service account is created by the
+		// cluster when the namespace is created.
+		if _, ok := obj.(*v1.ServiceAccount); ok && errors.IsAlreadyExists(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// helper function returns the copies of the service account
+// and the image pull secrets created in the named pipeline
+// namespace, in creation order. The service account may be
+// nil. Only docker registry secrets are copied.
+func toSchedulingObjects(namespace string, account *v1.ServiceAccount, secrets []*v1.Secret) ([]runtime.Object, error) {
+	var objects []runtime.Object
+	if account != nil {
+		objects = append(objects, &v1.ServiceAccount{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      account.Name,
+				Namespace: namespace,
+				Labels:    account.Labels,
+			},
+		})
+	}
+	for _, from := range secrets {
+		if from.Type != v1.SecretTypeDockerConfigJson && from.Type != v1.SecretTypeDockercfg {
+			return nil, fmt.Errorf("kubernetes: image pull secret %q is not a docker registry secret", from.Name)
+		}
+		objects = append(objects, &v1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      from.Name,
+				Namespace: namespace,
+				Labels:    from.Labels,
+			},
+			Type: from.Type,
+			Data: from.Data,
+		})
+	}
+	return objects, nil
+}
@@ -0,0 +1,254 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Drone Non-Commercial License
+// that can be found in the LICENSE file.
+
+package kube
+
+import (
+	"context"
+	"testing"
+
+	"github.com/drone/drone-runtime/engine"
+
+	"github.com/google/go-cmp/cmp"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestToScheduling(t *testing.T) {
+	e := &kubeEngine{options: defaultOptions()}
+	WithNodeSelector(map[string]string{"pool": "default", "os": "linux"})(e)
+	WithTolerations(&engine.Toleration{Key: "dedicated", Operator: "Exists"})(e)
+	WithServiceAccount("drone")(e)
+	WithRuntimeClass("gvisor")(e)
+	WithImagePullSecrets("registry")(e)
+
+	spec := &engine.Spec{
+		Kube: &engine.KubeConfig{
+			NodeSelector:     map[string]string{"pool": "builders"},
+			Tolerations:      []*engine.Toleration{{Key: "builders", Operator: "Equal", Value: "true", Effect: "NoSchedule"}},
+			PriorityClass:    "high",
+			ImagePullSecrets: []string{"mirror"},
+		},
+	}
+
+	want := &engine.KubeConfig{
+		NodeSelector: map[string]string{"pool": "builders", "os": "linux"},
+		Tolerations: []*engine.Toleration{
+			{Key: "dedicated", Operator: "Exists"},
+			{Key: "builders", Operator: "Equal", Value: "true", Effect: "NoSchedule"},
+		},
+		PriorityClass:    "high",
+		RuntimeClass:     "gvisor",
+		ImagePullSecrets: []string{"registry", "mirror"},
+	}
+	got := toScheduling(spec, &e.options)
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Unexpected scheduling settings")
+		t.Log(diff)
+	}
+
+	// the engine defaults must not be modified when
+	// merged with the pipeline settings.
+	if got, want := len(e.scheduling.Tolerations), 1; got != want {
+		t.Errorf("Want engine tolerations unchanged")
+	}
+	if got, want := e.scheduling.NodeSelector["pool"], "default"; got != want {
+		t.Errorf("Want engine node selector unchanged")
+	}
+}
+
+func TestToPodScheduling(t *testing.T) {
+	opts := defaultOptions()
+	opts.serviceAccount = "drone"
+	spec := &engine.Spec{
+		Docker: &engine.DockerConfig{},
+		Kube: &engine.KubeConfig{
+			NodeSelector:     map[string]string{"pool": "builders"},
+			Tolerations:      []*engine.Toleration{{Key: "builders", Operator: "Exists", Effect: "NoSchedule"}},
+			PriorityClass:    "high",
+			RuntimeClass:     "gvisor",
+			Annotations:      map[string]string{"team": "platform"},
+			Labels:           map[string]string{"app": "drone"},
+			ImagePullSecrets: []string{"registry"},
+		},
+	}
+	step := &engine.Step{
+		Metadata: engine.Metadata{
+			UID:    "uid-step",
+			Labels: map[string]string{"io.drone.step.name": "build"},
+		},
+		Docker: &engine.DockerStep{Image: "golang"},
+	}
+
+	pod := toPod(spec, step, &opts)
+	if diff := cmp.Diff(spec.Kube.NodeSelector, pod.Spec.NodeSelector); diff != "" {
+		t.Errorf("Unexpected node selector")
+		t.Log(diff)
+	}
+	tolerations := []v1.Toleration{{Key: "builders", Operator: v1.TolerationOpExists, Effect: v1.TaintEffectNoSchedule}}
+	if diff := cmp.Diff(tolerations, pod.Spec.Tolerations); diff != "" {
+		t.Errorf("Unexpected tolerations")
+		t.Log(diff)
+	}
+	if got, want := pod.Spec.ServiceAccountName, "drone"; got != want {
+		t.Errorf("Want service account %q, got %q", want, got)
+	}
+	if *pod.Spec.AutomountServiceAccountToken {
+		t.Errorf("Want service account token not mounted")
+	}
+	if got, want := pod.Spec.PriorityClassName, "high"; got != want {
+		t.Errorf("Want priority class %q, got %q", want, got)
+	}
+	if got, want := *pod.Spec.RuntimeClassName, "gvisor"; got != want {
+		t.Errorf("Want runtime class %q, got %q", want, got)
+	}
+	if got, want := pod.Annotations["team"], "platform"; got != want {
+		t.Errorf("Want pod annotation %q, got %q", want, got)
+	}
+	labels := map[string]string{"app": "drone", "io.drone.step.name": "build", "io.drone.step.uid": "uid-step"}
+	if diff := cmp.Diff(labels, pod.Labels); diff != "" {
+		t.Errorf("Unexpected pod labels")
+		t.Log(diff)
+	}
+	secrets := []v1.LocalObjectReference{{Name: "registry"}}
+	if diff := cmp.Diff(secrets, pod.Spec.ImagePullSecrets); diff != "" {
+		t.Errorf("Unexpected image pull secrets")
+		t.Log(diff)
+	}
+
+	// the service account token is only mounted when
+	// enabled by the engine.
+	opts.automountToken = true
+	pod = toPod(spec, step, &opts)
+	if !*pod.Spec.AutomountServiceAccountToken {
+		t.Errorf("Want service account token mounted")
+	}
+}
+
+func TestSetupSchedulingObjects(t *testing.T) {
+	client := newTestClient(
+		&v1.ServiceAccount{
+			ObjectMeta: metav1.ObjectMeta{Name: "drone", Namespace: "ci"},
+		},
+		&v1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "registry", Namespace: "ci"},
+			Type:       v1.SecretTypeDockerConfigJson,
+			Data:       map[string][]byte{v1.DockerConfigJsonKey: []byte("{}")},
+		},
+	)
+	e := New(client,
+		WithSourceNamespace("ci"),
+		WithServiceAccount("drone"),
+		WithImagePullSecrets("registry"),
+	).(*kubeEngine)
+
+	spec := &engine.Spec{
+		Metadata: engine.Metadata{UID: "uid-pipeline", Namespace: "ns-pipeline"},
+		Docker:   &engine.DockerConfig{},
+	}
+	if err := e.Setup(context.Background(), spec); err != nil {
+		t.Fatal(err)
+	}
+	defer e.Destroy(context.Background(), spec)
+
+	sa, err := client.CoreV1().ServiceAccounts("ns-pipeline").Get("drone", metav1.GetOptions{})
+	if err != nil {
+		t.Errorf("Want service account copied to the pipeline namespace, got %s", err)
+	} else if sa.AutomountServiceAccountToken != nil {
+		t.Errorf("Want service account token settings not copied")
+	}
+	secret, err := client.CoreV1().Secrets("ns-pipeline").Get("registry", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Want pull secret copied to the pipeline namespace, got %s", err)
+	}
+	if got, want := secret.Type, v1.SecretTypeDockerConfigJson; got != want {
+		t.Errorf("Want secret type %q, got %q", want, got)
+	}
+	if got, want := string(secret.Data[v1.DockerConfigJsonKey]), "{}"; got != want {
+		t.Errorf("Want secret data %q, got %q", want, got)
+	}
+}
+
+func TestSetupPullSecretType(t *testing.T) {
+	client := newTestClient(
+		&v1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "token", Namespace: "default"},
+			Type:       v1.SecretTypeOpaque,
+		},
+	)
+	e := New(client, WithImagePullSecrets("token")).(*kubeEngine)
+
+	spec := &engine.Spec{
+		Metadata: engine.Metadata{UID: "uid-pipeline", Namespace: "ns-pipeline"},
+		Docker:   &engine.DockerConfig{},
+	}
+	err := e.Setup(context.Background(), spec)
+	defer e.Destroy(context.Background(), spec)
+	if err == nil {
+		t.Errorf("Want error copying a secret that is not a registry secret")
+	}
+	if _, err := client.CoreV1().Secrets("ns-pipeline").Get("token", metav1.GetOptions{}); err == nil {
+		t.Errorf("Want opaque secret not copied")
+	}
+}
+
+func TestSetupPullSecretNotAllowed(t *testing.T) {
+	client := newTestClient(
+		&v1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "production", Namespace: "default"},
+			Type:       v1.SecretTypeDockerConfigJson,
+		},
+	)
+	e := New(client, WithImagePullSecrets("registry")).(*kubeEngine)
+
+	spec := &engine.Spec{
+		Metadata: engine.Metadata{UID: "uid-pipeline", Namespace: "ns-pipeline"},
+		Docker:   &engine.DockerConfig{},
+		Kube:     &engine.KubeConfig{ImagePullSecrets: []string{"production"}},
+	}
+	if err := e.Setup(context.Background(), spec); err == nil {
+		t.Errorf("Want error using a pull secret that is not allowed")
+	}
+	if _, err := client.CoreV1().Secrets("ns-pipeline").Get("production", metav1.GetOptions{}); err == nil {
+		t.Errorf("Want pull secret named by the pipeline not copied")
+	}
+	if _, err := client.CoreV1().Namespaces().Get("ns-pipeline", metav1.GetOptions{}); err == nil {
+		t.Errorf("Want namespace not created")
+	}
+}
+
+func TestSetupPullSecretAllowed(t *testing.T) {
+	client := newTestClient(
+		&v1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "registry", Namespace: "default"},
+			Type:       v1.SecretTypeDockerConfigJson,
+		},
+		&v1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "mirror", Namespace: "default"},
+			Type:       v1.SecretTypeDockerConfigJson,
+		},
+	)
+	e := New(client,
+		WithImagePullSecrets("registry"),
+		WithAllowedPullSecrets("mirror"),
+	).(*kubeEngine)
+
+	// the engine secret is named by the pipeline, and is
+	// only copied once.
+	spec := &engine.Spec{
+		Metadata: engine.Metadata{UID: "uid-pipeline", Namespace: "ns-pipeline"},
+		Docker:   &engine.DockerConfig{},
+		Kube:     &engine.KubeConfig{ImagePullSecrets: []string{"mirror", "registry"}},
+	}
+	if err := e.Setup(context.Background(), spec); err != nil {
+		t.Fatal(err)
+	}
+	defer e.Destroy(context.Background(), spec)
+
+	for _, name := range []string{"registry", "mirror"} {
+		if _, err := client.CoreV1().Secrets("ns-pipeline").Get(name, metav1.GetOptions{}); err != nil {
+			t.Errorf("Want pull secret %q copied to the pipeline namespace, got %s", name, err)
+		}
+	}
+}
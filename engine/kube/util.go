@@ -5,12 +5,15 @@
 package kube
 
 import (
-	"path"
-	"path/filepath"
-	"strings"
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/drone/drone-runtime/engine"
+	"github.com/drone/drone-runtime/engine/docker/auth"
 
 	"k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
@@ -18,16 +21,22 @@ import (
 	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
-// TODO(bradrydzewski) enable container resource limits.
-
 // helper function converts environment variable
 // string data to kubernetes variables.
 func toEnv(spec *engine.Spec, step *engine.Step) []v1.EnvVar {
+	// sort the variables by name to ensure the pod
+	// specification is deterministic.
+	var keys []string
+	for k := range step.Envs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
 	var to []v1.EnvVar
-	for k, v := range step.Envs {
+	for _, k := range keys {
 		to = append(to, v1.EnvVar{
 			Name:  k,
-			Value: v,
+			Value: step.Envs[k],
 		})
 	}
 	to = append(to, v1.EnvVar{
@@ -77,10 +86,12 @@ func toPullPolicy(from engine.PullPolicy) v1.PullPolicy {
 
 // helper function converts the engine secret object
 // to the kubernetes secret object.
-func toSecret(spec *engine.Spec, from *engine.Secret) *v1.Secret {
+func toSecret(spec *engine.Spec, from *engine.Secret, opts *options) *v1.Secret {
 	return &v1.Secret{
 		ObjectMeta: metav1.ObjectMeta{
-			Name: from.Metadata.UID,
+			Name:      from.Metadata.UID,
+			Namespace: toNamespaceName(spec, opts),
+			Labels:    opts.labels,
 		},
 		Type: "Opaque",
 		StringData: map[string]string{
@@ -89,52 +100,27 @@ func toSecret(spec *engine.Spec, from *engine.Secret) *v1.Secret {
 	}
 }
 
-func toConfigVolumes(spec *engine.Spec, step *engine.Step) []v1.Volume {
-	var to []v1.Volume
-	for _, mount := range step.Files {
-		file, ok := engine.LookupFile(spec, mount.Name)
-		if !ok {
-			continue
-		}
-		mode := int32(mount.Mode)
-		volume := v1.Volume{Name: file.Metadata.UID}
-
-		optional := false
-		volume.ConfigMap = &v1.ConfigMapVolumeSource{
-			LocalObjectReference: v1.LocalObjectReference{
-				Name: file.Metadata.UID,
-			},
-			Optional: &optional,
-			Items: []v1.KeyToPath{
-				{
-					Key:  file.Metadata.UID,
-					Path: path.Base(mount.Path), // use the base path. document this.
-					Mode: &mode,
-				},
-			},
-		}
-		to = append(to, volume)
+// helper function returns the kubernetes secret used to
+// store the registry credentials.
+func toAuthSecret(spec *engine.Spec, opts *options) (*v1.Secret, error) {
+	out, err := auth.Marshal(spec.Docker.Auths)
+	if err != nil {
+		return nil, err
 	}
-	return to
-}
-
-func toConfigMounts(spec *engine.Spec, step *engine.Step) []v1.VolumeMount {
-	var to []v1.VolumeMount
-	for _, mount := range step.Files {
-		file, ok := engine.LookupFile(spec, mount.Name)
-		if !ok {
-			continue
-		}
-		volume := v1.VolumeMount{
-			Name:      file.Metadata.UID,
-			MountPath: path.Dir(mount.Path), // mount the config map here, using the base path
-		}
-		to = append(to, volume)
-	}
-	return to
+	return &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "docker-auth-config",
+			Namespace: toNamespaceName(spec, opts),
+			Labels:    opts.labels,
+		},
+		Type: "kubernetes.io/dockerconfigjson",
+		StringData: map[string]string{
+			".dockerconfigjson": string(out),
+		},
+	}, nil
 }
 
-func toVolumes(spec *engine.Spec, step *engine.Step) []v1.Volume {
+func toVolumes(spec *engine.Spec, step *engine.Step, opts *options) []v1.Volume {
 	var to []v1.Volume
 	for _, mount := range step.Volumes {
 		vol, ok := engine.LookupVolume(spec, mount.Name)
@@ -150,17 +136,7 @@ func toVolumes(spec *engine.Spec, step *engine.Step) []v1.Volume {
 			}
 		}
 		if vol.EmptyDir != nil {
-			// volume.EmptyDir = &v1.EmptyDirVolumeSource{}
-
-			// NOTE the empty_dir cannot be shared across multiple
-			// pods so we emulate its behavior, and mount a temp
-			// directory on the host machine that can be shared
-			// between pods. This means we are responsible for deleting
-			// these directories.
-			volume.HostPath = &v1.HostPathVolumeSource{
-				Path: filepath.Join("/tmp", "drone", spec.Metadata.Namespace, vol.Metadata.UID),
-				Type: &source,
-			}
+			volume.VolumeSource = toEmptyDirSource(spec, vol, opts)
 		}
 		to = append(to, volume)
 	}
@@ -195,71 +171,219 @@ func toPorts(step *engine.Step) []v1.ContainerPort {
 	return ports
 }
 
+// helper function returns the kubernetes namespace name
+// for the given specification.
+func toNamespaceName(spec *engine.Spec, opts *options) string {
+	return opts.namespacePrefix + spec.Metadata.Namespace
+}
+
 // helper function returns a kubernetes namespace
 // for the given specification.
-func toNamespace(spec *engine.Spec) *v1.Namespace {
+func toNamespace(spec *engine.Spec, opts *options) *v1.Namespace {
 	return &v1.Namespace{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:   spec.Metadata.Namespace,
-			Labels: spec.Metadata.Labels,
+			Name:   toNamespaceName(spec, opts),
+			Labels: mergeMaps(opts.labels, spec.Metadata.Labels),
 		},
 	}
 }
 
-func toResources(step *engine.Step) v1.ResourceRequirements {
-	var resources v1.ResourceRequirements
-	if step.Resources != nil && step.Resources.Limits != nil {
-		resources.Limits = v1.ResourceList{}
-		if step.Resources.Limits.Memory > int64(0) {
-			resources.Limits[v1.ResourceMemory] = *resource.NewQuantity(
-				step.Resources.Limits.Memory, resource.BinarySI)
+// helper function returns the container resource
+// requirements for the step. The engine default resources
+// are used when the step does not define the resource.
+func toResources(step *engine.Step, opts *options) v1.ResourceRequirements {
+	var limits, requests, defaultLimits, defaultRequests *engine.ResourceObject
+	if step.Resources != nil {
+		limits, requests = step.Resources.Limits, step.Resources.Requests
+	}
+	if opts.resources != nil {
+		defaultLimits, defaultRequests = opts.resources.Limits, opts.resources.Requests
+	}
+	return v1.ResourceRequirements{
+		Limits:   toResourceList(limits, defaultLimits),
+		Requests: toResourceList(requests, defaultRequests),
+	}
+}
+
+// helper function converts the engine resource object to
+// a kubernetes resource list, falling back to the default
+// for undefined resources.
+func toResourceList(from, defaults *engine.ResourceObject) v1.ResourceList {
+	var cpu, memory int64
+	if from != nil {
+		cpu, memory = from.CPU, from.Memory
+	}
+	if defaults != nil {
+		if cpu == 0 {
+			cpu = defaults.CPU
 		}
-		if step.Resources.Limits.CPU > int64(0) {
-			resources.Limits[v1.ResourceCPU] = *resource.NewMilliQuantity(
-				step.Resources.Limits.CPU, resource.DecimalSI)
+		if memory == 0 {
+			memory = defaults.Memory
 		}
 	}
-	if step.Resources != nil && step.Resources.Requests != nil {
-		resources.Requests = v1.ResourceList{}
-		if step.Resources.Requests.Memory > int64(0) {
-			resources.Requests[v1.ResourceMemory] = *resource.NewQuantity(
-				step.Resources.Requests.Memory, resource.BinarySI)
+	if from == nil && cpu == 0 && memory == 0 {
+		return nil
+	}
+	to := v1.ResourceList{}
+	if memory > int64(0) {
+		to[v1.ResourceMemory] = *resource.NewQuantity(
+			memory, resource.BinarySI)
+	}
+	if cpu > int64(0) {
+		to[v1.ResourceCPU] = *resource.NewMilliQuantity(
+			cpu, resource.DecimalSI)
+	}
+	return to
+}
+
+// helper function returns the container security context
+// for the given step. Note that ulimits and the user
+// namespace mode are not supported by kubernetes and are
+// ignored.
+func toSecurityContext(step *engine.Step) *v1.SecurityContext {
+	to := &v1.SecurityContext{
+		Privileged: boolptr(step.Docker.Privileged),
+	}
+	if len(step.Docker.CapAdd) != 0 || len(step.Docker.CapDrop) != 0 {
+		to.Capabilities = &v1.Capabilities{}
+		for _, c := range step.Docker.CapAdd {
+			to.Capabilities.Add = append(to.Capabilities.Add, v1.Capability(c))
 		}
-		if step.Resources.Requests.CPU > int64(0) {
-			resources.Requests[v1.ResourceCPU] = *resource.NewMilliQuantity(
-				step.Resources.Requests.CPU, resource.DecimalSI)
+		for _, c := range step.Docker.CapDrop {
+			to.Capabilities.Drop = append(to.Capabilities.Drop, v1.Capability(c))
 		}
 	}
-	return resources
+	if step.Docker.ReadOnlyRootfs {
+		to.ReadOnlyRootFilesystem = boolptr(true)
+	}
+	// kubernetes rejects privileged containers that
+	// disallow privilege escalation.
+	if step.Docker.NoNewPrivileges && !step.Docker.Privileged {
+		to.AllowPrivilegeEscalation = boolptr(false)
+	}
+	return to
+}
+
+// helper function returns the pod security context for
+// the given step.
+func toPodSecurityContext(step *engine.Step) *v1.PodSecurityContext {
+	if len(step.Docker.Sysctls) == 0 {
+		return nil
+	}
+	var keys []string
+	for k := range step.Docker.Sysctls {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	to := &v1.PodSecurityContext{}
+	for _, k := range keys {
+		to.Sysctls = append(to.Sysctls, v1.Sysctl{
+			Name:  k,
+			Value: step.Docker.Sysctls[k],
+		})
+	}
+	return to
+}
+
+// helper function returns the pod annotations used to
+// configure the seccomp and apparmor profiles. Kubernetes
+// configures these profiles using annotations.
+func toSecurityAnnotations(step *engine.Step) map[string]string {
+	to := map[string]string{}
+	if p := step.Docker.SeccompProfile; p != "" {
+		to["container.seccomp.security.alpha.kubernetes.io/"+step.Metadata.UID] = toSecurityProfile(p)
+	}
+	if p := step.Docker.ApparmorProfile; p != "" {
+		to["container.apparmor.security.beta.kubernetes.io/"+step.Metadata.UID] = toSecurityProfile(p)
+	}
+	if len(to) == 0 {
+		return nil
+	}
+	return to
+}
+
+// helper function returns the kubernetes security profile
+// annotation value. Docker references seccomp profiles by
+// file path and apparmor profiles by name, while kubernetes
+// expects profiles loaded on the node to be prefixed with
+// localhost, and resolves seccomp profile paths relative to
+// the kubelet seccomp profile root, including absolute paths.
+func toSecurityProfile(p string) string {
+	switch {
+	case p == "runtime/default", p == "unconfined":
+		return p
+	case strings.HasPrefix(p, "localhost/"):
+		return p
+	default:
+		return "localhost/" + strings.TrimPrefix(p, "/")
+	}
+}
+
+// helper function returns the node affinity used to pin
+// the pod to the named node.
+func toAffinity(node string) *v1.Affinity {
+	if node == "" {
+		return nil
+	}
+	return &v1.Affinity{
+		NodeAffinity: &v1.NodeAffinity{
+			RequiredDuringSchedulingIgnoredDuringExecution: &v1.NodeSelector{
+				NodeSelectorTerms: []v1.NodeSelectorTerm{{
+					MatchExpressions: []v1.NodeSelectorRequirement{{
+						Key:      "kubernetes.io/hostname",
+						Operator: v1.NodeSelectorOpIn,
+						Values:   []string{node},
+					}},
+				}},
+			},
+		},
+	}
 }
 
 // helper function returns a kubernetes pod for the
 // given step and specification.
-func toPod(spec *engine.Spec, step *engine.Step) *v1.Pod {
+func toPod(spec *engine.Spec, step *engine.Step, opts *options) *v1.Pod {
 	var volumes []v1.Volume
-	volumes = append(volumes, toVolumes(spec, step)...)
-	volumes = append(volumes, toConfigVolumes(spec, step)...)
+	volumes = append(volumes, toVolumes(spec, step, opts)...)
+	volumes = append(volumes, toFileVolumes(spec, step)...)
 
 	var mounts []v1.VolumeMount
 	mounts = append(mounts, toVolumeMounts(spec, step)...)
-	mounts = append(mounts, toConfigMounts(spec, step)...)
+	mounts = append(mounts, toFileMounts(spec, step)...)
+
+	conf := toScheduling(spec, opts)
 
-	var pullSecrets []v1.LocalObjectReference
-	if len(spec.Docker.Auths) > 0 {
-		pullSecrets = []v1.LocalObjectReference{{
-			Name: "docker-auth-config", // TODO move name to a const
-		}}
+	var runtimeClass *string
+	if conf.RuntimeClass != "" {
+		runtimeClass = stringptr(conf.RuntimeClass)
+	}
+
+	var initContainers []v1.Container
+	if c := toFileInitContainer(spec, step, opts); c != nil {
+		initContainers = append(initContainers, *c)
 	}
 
 	return &v1.Pod{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      step.Metadata.UID,
-			Namespace: step.Metadata.Namespace,
-			Labels:    step.Metadata.Labels,
+			Name:        step.Metadata.UID,
+			Namespace:   toNamespaceName(spec, opts),
+			Labels:      toPodLabels(step, conf, opts),
+			Annotations: mergeMaps(conf.Annotations, toSecurityAnnotations(step)),
 		},
 		Spec: v1.PodSpec{
-			AutomountServiceAccountToken: boolptr(false),
+			AutomountServiceAccountToken: boolptr(opts.automountToken),
+			ServiceAccountName:           opts.serviceAccount,
 			RestartPolicy:                v1.RestartPolicyNever,
+			SecurityContext:              toPodSecurityContext(step),
+			Affinity:                     toAffinity(opts.node),
+			HostAliases:                  toHostAliases(step),
+			DNSConfig:                    toDNSConfig(step),
+			NodeSelector:                 conf.NodeSelector,
+			Tolerations:                  toTolerations(conf.Tolerations),
+			PriorityClassName:            conf.PriorityClass,
+			RuntimeClassName:             runtimeClass,
+			InitContainers:               initContainers,
 			Containers: []v1.Container{{
 				Name:            step.Metadata.UID,
 				Image:           step.Docker.Image,
@@ -267,23 +391,36 @@ func toPod(spec *engine.Spec, step *engine.Step) *v1.Pod {
 				Command:         step.Docker.Command,
 				Args:            step.Docker.Args,
 				WorkingDir:      step.WorkingDir,
-				SecurityContext: &v1.SecurityContext{
-					Privileged: &step.Docker.Privileged,
-				},
-				Env:          toEnv(spec, step),
-				VolumeMounts: mounts,
-				Ports:        toPorts(step),
-				Resources:    toResources(step),
+				SecurityContext: toSecurityContext(step),
+				Env:             toEnv(spec, step),
+				VolumeMounts:    mounts,
+				Ports:           toPorts(step),
+				Resources:       toResources(step, opts),
 			}},
-			ImagePullSecrets: pullSecrets,
+			ImagePullSecrets: toPullSecrets(spec, conf),
 			Volumes:          volumes,
 		},
 	}
 }
 
+// stepLabel defines the pod label used to select the step
+// pod by its unique identifier.
+const stepLabel = "io.drone.step.uid"
+
+// helper function returns the pod labels. The step labels
+// take precedence over the engine and pipeline labels.
+func toPodLabels(step *engine.Step, conf *engine.KubeConfig, opts *options) map[string]string {
+	labels := mergeMaps(mergeMaps(opts.labels, conf.Labels), step.Metadata.Labels)
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	labels[stepLabel] = step.Metadata.UID
+	return labels
+}
+
 // helper function returns a kubernetes service for the
 // given step and specification.
-func toService(spec *engine.Spec, step *engine.Step) *v1.Service {
+func toService(spec *engine.Spec, step *engine.Step, opts *options) *v1.Service {
 	var ports []v1.ServicePort
 	for _, p := range step.Docker.Ports {
 		source := p.Port
@@ -299,23 +436,223 @@ func toService(spec *engine.Spec, step *engine.Step) *v1.Service {
 			},
 		})
 	}
-	return &v1.Service{
+	service := &v1.Service{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      toDNS(step.Metadata.Name),
-			Namespace: step.Metadata.Namespace,
+			Name:      toServiceName(spec, step),
+			Namespace: toNamespaceName(spec, opts),
+			Labels:    opts.labels,
 		},
 		Spec: v1.ServiceSpec{
 			Type: v1.ServiceTypeClusterIP,
 			Selector: map[string]string{
-				"io.drone.step.name": step.Metadata.Name,
+				stepLabel: step.Metadata.UID,
 			},
 			Ports: ports,
 		},
 	}
+	// steps without ports are exposed with a headless
+	// service, which resolves the step name to the pod
+	// address, matching the docker network alias.
+	if len(ports) == 0 {
+		service.Spec.ClusterIP = v1.ClusterIPNone
+	}
+	return service
+}
+
+// helper function returns true if a service must be
+// created for the step. Steps are reachable by name if
+// they are detached or expose ports.
+func hasService(step *engine.Step) bool {
+	return step.Detach || len(step.Docker.Ports) != 0
+}
+
+// helper function converts the docker extra hosts, in
+// host:ip format, to kubernetes host aliases.
+func toHostAliases(step *engine.Step) []v1.HostAlias {
+	var to []v1.HostAlias
+	index := map[string]int{}
+	for _, host := range step.Docker.ExtraHosts {
+		parts := strings.SplitN(host, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		hostname, ip := parts[0], parts[1]
+		if i, ok := index[ip]; ok {
+			to[i].Hostnames = append(to[i].Hostnames, hostname)
+			continue
+		}
+		index[ip] = len(to)
+		to = append(to, v1.HostAlias{
+			IP:        ip,
+			Hostnames: []string{hostname},
+		})
+	}
+	return to
+}
+
+// helper function returns the pod dns configuration. The
+// nameservers and search domains are added to the cluster
+// dns configuration.
+func toDNSConfig(step *engine.Step) *v1.PodDNSConfig {
+	if len(step.Docker.DNS) == 0 && len(step.Docker.DNSSearch) == 0 {
+		return nil
+	}
+	return &v1.PodDNSConfig{
+		Nameservers: step.Docker.DNS,
+		Searches:    step.Docker.DNSSearch,
+	}
+}
+
+// waitingReasons defines the container waiting reasons
+// that indicate the container cannot be started.
+var waitingReasons = map[string]bool{
+	"ErrImagePull":               true,
+	"ImagePullBackOff":           true,
+	"InvalidImageName":           true,
+	"CreateContainerConfigError": true,
+	"CreateContainerError":       true,
+}
+
+// defaultScheduleTimeout defines how long a pod may remain
+// unschedulable before the step fails.
+const defaultScheduleTimeout = 5 * time.Minute
+
+// defaultSourceNamespace is the namespace from which the
+// service account and image pull secrets are copied.
+const defaultSourceNamespace = "default"
+
+// helper function returns an error if the pod cannot be
+// started, or was terminated by the system. A pod that
+// cannot be scheduled only fails once it has been
+// unschedulable for longer than the timeout, since the
+// condition clears when nodes are added to the cluster.
+func toPodError(step *engine.Step, pod *v1.Pod, timeout time.Duration) error {
+	if pod.Status.Reason == "Evicted" {
+		return &PodError{
+			Name:    step.Metadata.Name,
+			Reason:  pod.Status.Reason,
+			Message: pod.Status.Message,
+		}
+	}
+	for _, cond := range pod.Status.Conditions {
+		if cond.Type == v1.PodScheduled &&
+			cond.Status == v1.ConditionFalse &&
+			cond.Reason == v1.PodReasonUnschedulable &&
+			time.Since(cond.LastTransitionTime.Time) > timeout {
+			return &PodError{
+				Name:    step.Metadata.Name,
+				Reason:  cond.Reason,
+				Message: cond.Message,
+			}
+		}
+	}
+	if status, ok := lookupStatus(step, pod); ok {
+		waiting := status.State.Waiting
+		if waiting != nil && waitingReasons[waiting.Reason] {
+			return &PodError{
+				Name:    step.Metadata.Name,
+				Reason:  waiting.Reason,
+				Message: waiting.Message,
+			}
+		}
+	}
+	return nil
+}
+
+// helper function returns the container state for a
+// completed pod.
+func toState(step *engine.Step, pod *v1.Pod) (*engine.State, error) {
+	if status, ok := lookupStatus(step, pod); ok && status.State.Terminated != nil {
+		terminated := status.State.Terminated
+		return &engine.State{
+			ExitCode:  int(terminated.ExitCode),
+			Exited:    true,
+			OOMKilled: terminated.Reason == "OOMKilled",
+			Finished:  terminated.FinishedAt.Unix(),
+			Error:     terminated.Message,
+			Digest:    toDigest(status.ImageID),
+		}, nil
+	}
+	// the pod completed without a terminated container,
+	// for example, if the node was lost.
+	return nil, &PodError{
+		Name:    step.Metadata.Name,
+		Reason:  string(pod.Status.Phase),
+		Message: pod.Status.Message,
+	}
+}
+
+// helper function returns the status of the step
+// container.
+func lookupStatus(step *engine.Step, pod *v1.Pod) (v1.ContainerStatus, bool) {
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.Name == step.Metadata.UID {
+			return status, true
+		}
+	}
+	return v1.ContainerStatus{}, false
 }
 
+// helper function extracts the image digest from the
+// container image identifier (e.g. docker-pullable://
+// golang@sha256:...)
+func toDigest(imageID string) string {
+	if i := strings.LastIndex(imageID, "@"); i != -1 {
+		return imageID[i+1:]
+	}
+	return strings.TrimPrefix(imageID, "docker://")
+}
+
+// helper function converts the name to a valid dns label,
+// which is used to name kubernetes services. The name is
+// converted to lowercase, invalid characters are replaced
+// with dashes, and names that do not start with a letter
+// are prefixed. Names longer than 63 characters are
+// truncated, and suffixed with a hash of the name to keep
+// them unique.
 func toDNS(i string) string {
-	return strings.Replace(i, "_", "-", -1)
+	b := []byte(strings.ToLower(i))
+	for j, c := range b {
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') {
+			b[j] = '-'
+		}
+	}
+	s := strings.Trim(string(b), "-")
+	if s == "" || s[0] < 'a' {
+		s = "s-" + s
+	}
+	if len(s) > 63 {
+		s = withHash(s, i)
+	}
+	return s
+}
+
+// helper function returns the service name of the step. If
+// a preceding step has the same service name, the name is
+// suffixed with a hash of the step name to keep it unique.
+func toServiceName(spec *engine.Spec, step *engine.Step) string {
+	name := toDNS(step.Metadata.Name)
+	for _, other := range spec.Steps {
+		if other == step || other.Metadata.Name == step.Metadata.Name {
+			break
+		}
+		if toDNS(other.Metadata.Name) == name {
+			return withHash(name, step.Metadata.Name)
+		}
+	}
+	return name
+}
+
+// helper function suffixes the dns label with a short hash
+// of the source string, truncating the label to ensure the
+// result does not exceed 63 characters.
+func withHash(label, source string) string {
+	sum := sha256.Sum256([]byte(source))
+	suffix := hex.EncodeToString(sum[:])[:8]
+	if len(label) > 63-len(suffix)-1 {
+		label = strings.TrimRight(label[:63-len(suffix)-1], "-")
+	}
+	return label + "-" + suffix
 }
 
 func boolptr(v bool) *bool {
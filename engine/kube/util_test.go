@@ -0,0 +1,208 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Drone Non-Commercial License
+// that can be found in the LICENSE file.
+
+package kube
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/drone/drone-runtime/engine"
+
+	"github.com/google/go-cmp/cmp"
+	"k8s.io/api/core/v1"
+)
+
+func TestToResources(t *testing.T) {
+	opts := defaultOptions()
+	step := &engine.Step{
+		Resources: &engine.Resources{
+			Limits: &engine.ResourceObject{Memory: 1073741824},
+		},
+	}
+
+	res := toResources(step, &opts)
+	if res.Requests != nil {
+		t.Errorf("Want no resource requests")
+	}
+	if got, want := res.Limits.Memory().String(), "1Gi"; got != want {
+		t.Errorf("Want memory limit %s, got %s", want, got)
+	}
+	if _, ok := res.Limits[v1.ResourceCPU]; ok {
+		t.Errorf("Want no cpu limit")
+	}
+
+	// the engine defaults are used when the resource
+	// is not defined by the step.
+	e := &kubeEngine{options: opts}
+	WithResources(&engine.Resources{
+		Limits:   &engine.ResourceObject{CPU: 2000, Memory: 536870912},
+		Requests: &engine.ResourceObject{CPU: 500},
+	})(e)
+	res = toResources(step, &e.options)
+	if got, want := res.Limits.Memory().String(), "1Gi"; got != want {
+		t.Errorf("Want step memory limit %s, got %s", want, got)
+	}
+	if got, want := res.Limits.Cpu().String(), "2"; got != want {
+		t.Errorf("Want default cpu limit %s, got %s", want, got)
+	}
+	if got, want := res.Requests.Cpu().String(), "500m"; got != want {
+		t.Errorf("Want default cpu request %s, got %s", want, got)
+	}
+}
+
+func TestToService(t *testing.T) {
+	opts := defaultOptions()
+	spec := &engine.Spec{
+		Metadata: engine.Metadata{Namespace: "ns-pipeline"},
+	}
+	step := &engine.Step{
+		Metadata: engine.Metadata{UID: "uid-step", Name: "Redis_Server"},
+		Detach:   true,
+		Docker:   &engine.DockerStep{},
+	}
+	if !hasService(step) {
+		t.Errorf("Want service for detached step")
+	}
+
+	service := toService(spec, step, &opts)
+	if got, want := service.Name, "redis-server"; got != want {
+		t.Errorf("Want service name %q, got %q", want, got)
+	}
+	if got, want := service.Spec.ClusterIP, v1.ClusterIPNone; got != want {
+		t.Errorf("Want headless service for step without ports")
+	}
+	if got, want := service.Spec.Selector[stepLabel], "uid-step"; got != want {
+		t.Errorf("Want service selects the step pod")
+	}
+
+	step.Docker.Ports = []*engine.Port{{Port: 6379}}
+	service = toService(spec, step, &opts)
+	if service.Spec.ClusterIP != "" {
+		t.Errorf("Want cluster ip for step with ports")
+	}
+
+	step.Detach = false
+	step.Docker.Ports = nil
+	if hasService(step) {
+		t.Errorf("Want no service for step without ports")
+	}
+}
+
+func TestToHostAliases(t *testing.T) {
+	step := &engine.Step{
+		Docker: &engine.DockerStep{
+			ExtraHosts: []string{
+				"somehost:162.242.195.82",
+				"otherhost:50.31.209.229",
+				"alias:162.242.195.82",
+				"invalid",
+			},
+		},
+	}
+	want := []v1.HostAlias{
+		{IP: "162.242.195.82", Hostnames: []string{"somehost", "alias"}},
+		{IP: "50.31.209.229", Hostnames: []string{"otherhost"}},
+	}
+	if diff := cmp.Diff(want, toHostAliases(step)); diff != "" {
+		t.Errorf("Unexpected host aliases")
+		t.Log(diff)
+	}
+}
+
+func TestToSecurityAnnotations(t *testing.T) {
+	tests := []struct {
+		profile string
+		want    string
+	}{
+		{"runtime/default", "runtime/default"},
+		{"unconfined", "unconfined"},
+		{"localhost/profile", "localhost/profile"},
+		{"profile", "localhost/profile"},
+		{"profiles/seccomp.json", "localhost/profiles/seccomp.json"},
+		{"/etc/docker/seccomp.json", "localhost/etc/docker/seccomp.json"},
+	}
+	for _, test := range tests {
+		step := &engine.Step{
+			Metadata: engine.Metadata{UID: "uid-step"},
+			Docker: &engine.DockerStep{
+				SeccompProfile:  test.profile,
+				ApparmorProfile: test.profile,
+			},
+		}
+		want := map[string]string{
+			"container.seccomp.security.alpha.kubernetes.io/uid-step": test.want,
+			"container.apparmor.security.beta.kubernetes.io/uid-step": test.want,
+		}
+		if diff := cmp.Diff(want, toSecurityAnnotations(step)); diff != "" {
+			t.Errorf("Unexpected security annotations for profile %q", test.profile)
+			t.Log(diff)
+		}
+	}
+
+	step := &engine.Step{Docker: &engine.DockerStep{}}
+	if toSecurityAnnotations(step) != nil {
+		t.Errorf("Want no security annotations by default")
+	}
+}
+
+func TestToDNSConfig(t *testing.T) {
+	step := &engine.Step{Docker: &engine.DockerStep{}}
+	if toDNSConfig(step) != nil {
+		t.Errorf("Want no dns config by default")
+	}
+	step.Docker.DNS = []string{"8.8.8.8"}
+	step.Docker.DNSSearch = []string{"example.com"}
+	want := &v1.PodDNSConfig{
+		Nameservers: []string{"8.8.8.8"},
+		Searches:    []string{"example.com"},
+	}
+	if diff := cmp.Diff(want, toDNSConfig(step)); diff != "" {
+		t.Errorf("Unexpected dns config")
+		t.Log(diff)
+	}
+}
+
+func TestToDNS(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"redis", "redis"},
+		{"redis_server", "redis-server"},
+		{"Redis Server", "redis-server"},
+		{"_redis.", "redis"},
+		{"1password", "s-1password"},
+		{"___", "s-"},
+		{strings.Repeat("a", 70), strings.Repeat("a", 54) + "-" + "6bd5e503"},
+	}
+	for _, test := range tests {
+		if got := toDNS(test.name); got != test.want {
+			t.Errorf("Want dns name %q, got %q", test.want, got)
+		}
+	}
+
+	// names that only differ after the first 63
+	// characters must not be truncated to the same name.
+	a := toDNS(strings.Repeat("a", 63) + "1")
+	b := toDNS(strings.Repeat("a", 63) + "2")
+	if a == b {
+		t.Errorf("Want unique dns names when truncated")
+	}
+	if len(a) > 63 {
+		t.Errorf("Want dns name truncated to 63 characters, got %d", len(a))
+	}
+}
+
+func TestToServiceName(t *testing.T) {
+	a := &engine.Step{Metadata: engine.Metadata{Name: "redis_server"}}
+	b := &engine.Step{Metadata: engine.Metadata{Name: "redis-server"}}
+	spec := &engine.Spec{Steps: []*engine.Step{a, b}}
+	if got, want := toServiceName(spec, a), "redis-server"; got != want {
+		t.Errorf("Want service name %q, got %q", want, got)
+	}
+	if got := toServiceName(spec, b); got == "redis-server" || !strings.HasPrefix(got, "redis-server-") {
+		t.Errorf("Want colliding service name suffixed with a hash, got %q", got)
+	}
+}
@@ -5,62 +5,180 @@
 package kube
 
 import (
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/drone/drone-runtime/engine"
+
 	"k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
+const (
+	defaultHostPath = "/tmp/drone"
+
+	// cleanupName defines the name of the pod that removes
+	// the host machine directories backing the volumes.
+	cleanupName = "drone-cleanup"
+
+	// cleanupPath defines the path at which the host
+	// machine directory is mounted in the cleanup pod.
+	cleanupPath = "/drone/volumes"
+)
+
 var defaultVolumeSize = resource.MustParse("5Gi")
 
-func toPersistentVolume(node, namespace, name, path string) *v1.PersistentVolume {
-	return &v1.PersistentVolume{
+// cleanupTimeout defines the maximum time to wait for the
+// cleanup pod to remove the host machine directories.
+var cleanupTimeout = 5 * time.Minute
+
+// helper function returns the persistent volume claims
+// used to back the empty_dir volumes in the specification.
+func toPersistentVolumeClaims(spec *engine.Spec, opts *options) []*v1.PersistentVolumeClaim {
+	if !opts.claim || opts.singlePod || spec.Docker == nil {
+		return nil
+	}
+	var to []*v1.PersistentVolumeClaim
+	for _, vol := range spec.Docker.Volumes {
+		if vol.EmptyDir != nil {
+			to = append(to, toPersistentVolumeClaim(spec, vol, opts))
+		}
+	}
+	return to
+}
+
+// helper function returns a persistent volume claim for
+// the empty_dir volume.
+func toPersistentVolumeClaim(spec *engine.Spec, vol *engine.Volume, opts *options) *v1.PersistentVolumeClaim {
+	size := opts.volumeSize
+	if limit := vol.EmptyDir.SizeLimit; limit > 0 {
+		size = *resource.NewQuantity(limit, resource.BinarySI)
+	}
+
+	// the volume is shared by step pods that can be
+	// scheduled to different nodes, unless all pods are
+	// pinned to a single node.
+	mode := v1.ReadWriteMany
+	if opts.node != "" {
+		mode = v1.ReadWriteOnce
+	}
+
+	claim := &v1.PersistentVolumeClaim{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      name,
-			Namespace: namespace,
+			Name:      vol.Metadata.UID,
+			Namespace: toNamespaceName(spec, opts),
+			Labels:    mergeMaps(opts.labels, vol.Metadata.Labels),
 		},
-		Spec: v1.PersistentVolumeSpec{
-			Capacity: v1.ResourceList{
-				v1.ResourceStorage: defaultVolumeSize,
-			},
-			AccessModes:                   []v1.PersistentVolumeAccessMode{v1.ReadWriteMany},
-			PersistentVolumeReclaimPolicy: v1.PersistentVolumeReclaimRetain,
-			StorageClassName:              "local-storage",
-			PersistentVolumeSource: v1.PersistentVolumeSource{
-				Local: &v1.LocalVolumeSource{
-					Path: path,
-				},
-			},
-			NodeAffinity: &v1.VolumeNodeAffinity{
-				Required: &v1.NodeSelector{
-					NodeSelectorTerms: []v1.NodeSelectorTerm{{
-						MatchExpressions: []v1.NodeSelectorRequirement{{
-							Key:      "kubernetes.io/hostname",
-							Operator: v1.NodeSelectorOpIn,
-							Values:   []string{node},
-						}},
-					}},
+		Spec: v1.PersistentVolumeClaimSpec{
+			AccessModes: []v1.PersistentVolumeAccessMode{mode},
+			Resources: v1.ResourceRequirements{
+				Requests: v1.ResourceList{
+					v1.ResourceStorage: size,
 				},
 			},
 		},
 	}
+	if opts.storageClass != "" {
+		claim.Spec.StorageClassName = stringptr(opts.storageClass)
+	}
+	return claim
 }
 
-func toPersistentVolumeClaim(namespace, name string) *v1.PersistentVolumeClaim {
-	localStorageClass := "local-storage"
+// helper function returns the kubernetes volume source for
+// the empty_dir volume. The kubernetes empty_dir cannot be
+// shared across multiple pods so we emulate its behavior,
+// using either a persistent volume claim, or a temporary
+// directory on the host machine. When all steps execute in
+// a single pod, the kubernetes empty_dir is used.
+func toEmptyDirSource(spec *engine.Spec, vol *engine.Volume, opts *options) v1.VolumeSource {
+	if opts.singlePod {
+		source := &v1.EmptyDirVolumeSource{}
+		if vol.EmptyDir.Medium == "memory" {
+			source.Medium = v1.StorageMediumMemory
+		}
+		if limit := vol.EmptyDir.SizeLimit; limit > 0 {
+			source.SizeLimit = resource.NewQuantity(limit, resource.BinarySI)
+		}
+		return v1.VolumeSource{EmptyDir: source}
+	}
+	if opts.claim {
+		return v1.VolumeSource{
+			PersistentVolumeClaim: &v1.PersistentVolumeClaimVolumeSource{
+				ClaimName: vol.Metadata.UID,
+			},
+		}
+	}
+	source := v1.HostPathDirectoryOrCreate
+	return v1.VolumeSource{
+		HostPath: &v1.HostPathVolumeSource{
+			Path: filepath.Join(opts.hostPath, toNamespaceName(spec, opts), vol.Metadata.UID),
+			Type: &source,
+		},
+	}
+}
 
-	return &v1.PersistentVolumeClaim{
+// helper function returns the pod used to remove the host
+// machine directory that backs the pipeline empty_dir
+// volumes, or nil if the volumes are not backed by host
+// machine directories. The directory is removed by a pod
+// pinned to the pipeline node, since the engine does not
+// necessarily run on that node.
+func toCleanupPod(spec *engine.Spec, opts *options) *v1.Pod {
+	if opts.claim || opts.singlePod || !hasEmptyDirVolumes(spec) {
+		return nil
+	}
+	namespace := toNamespaceName(spec, opts)
+	conf := toScheduling(spec, opts)
+	source := v1.HostPathDirectoryOrCreate
+	return &v1.Pod{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      name,
+			Name:      cleanupName,
 			Namespace: namespace,
+			Labels:    opts.labels,
 		},
-		Spec: v1.PersistentVolumeClaimSpec{
-			AccessModes:      []v1.PersistentVolumeAccessMode{v1.ReadWriteMany},
-			StorageClassName: &localStorageClass,
-			Resources: v1.ResourceRequirements{
-				Requests: v1.ResourceList{
-					v1.ResourceStorage: defaultVolumeSize,
+		Spec: v1.PodSpec{
+			AutomountServiceAccountToken: boolptr(false),
+			RestartPolicy:                v1.RestartPolicyNever,
+			Affinity:                     toAffinity(opts.node),
+			NodeSelector:                 conf.NodeSelector,
+			Tolerations:                  toTolerations(conf.Tolerations),
+			Containers: []v1.Container{{
+				Name:            cleanupName,
+				Image:           opts.initImage,
+				ImagePullPolicy: v1.PullIfNotPresent,
+				Command:         []string{"/bin/sh", "-c"},
+				Args:            []string{"rm -rf " + path.Join(cleanupPath, namespace)},
+				VolumeMounts: []v1.VolumeMount{{
+					Name:      cleanupName,
+					MountPath: cleanupPath,
+				}},
+			}},
+			ImagePullSecrets: toPullSecrets(spec, conf),
+			Volumes: []v1.Volume{{
+				Name: cleanupName,
+				VolumeSource: v1.VolumeSource{
+					HostPath: &v1.HostPathVolumeSource{
+						Path: opts.hostPath,
+						Type: &source,
+					},
 				},
-			},
+			}},
 		},
 	}
 }
+
+// helper function returns true if the specification
+// defines empty_dir volumes.
+func hasEmptyDirVolumes(spec *engine.Spec) bool {
+	if spec.Docker == nil {
+		return false
+	}
+	for _, vol := range spec.Docker.Volumes {
+		if vol.EmptyDir != nil {
+			return true
+		}
+	}
+	return false
+}
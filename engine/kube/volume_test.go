@@ -0,0 +1,140 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Drone Non-Commercial License
+// that can be found in the LICENSE file.
+
+package kube
+
+import (
+	"testing"
+
+	"github.com/drone/drone-runtime/engine"
+
+	"k8s.io/api/core/v1"
+)
+
+func TestToPersistentVolumeClaims(t *testing.T) {
+	spec := &engine.Spec{
+		Metadata: engine.Metadata{Namespace: "ns-pipeline"},
+		Docker: &engine.DockerConfig{
+			Volumes: []*engine.Volume{
+				{
+					Metadata: engine.Metadata{UID: "uid-1"},
+					EmptyDir: &engine.VolumeEmptyDir{},
+				},
+				{
+					Metadata: engine.Metadata{UID: "uid-2"},
+					EmptyDir: &engine.VolumeEmptyDir{SizeLimit: 1073741824},
+				},
+				{
+					Metadata: engine.Metadata{UID: "uid-3"},
+					HostPath: &engine.VolumeHostPath{Path: "/var/run/docker.sock"},
+				},
+			},
+		},
+	}
+
+	opts := defaultOptions()
+	if claims := toPersistentVolumeClaims(spec, &opts); len(claims) != 0 {
+		t.Errorf("Want no volume claims when using host path storage")
+	}
+
+	opts.claim = true
+	claims := toPersistentVolumeClaims(spec, &opts)
+	if got, want := len(claims), 2; got != want {
+		t.Errorf("Want %d volume claims, got %d", want, got)
+		return
+	}
+	if claims[0].Spec.StorageClassName != nil {
+		t.Errorf("Want default storage class")
+	}
+	if got, want := claims[0].Spec.AccessModes[0], v1.ReadWriteMany; got != want {
+		t.Errorf("Want access mode %s, got %s", want, got)
+	}
+	size := claims[0].Spec.Resources.Requests[v1.ResourceStorage]
+	if got, want := size.String(), "5Gi"; got != want {
+		t.Errorf("Want default volume size %s, got %s", want, got)
+	}
+	size = claims[1].Spec.Resources.Requests[v1.ResourceStorage]
+	if got, want := size.String(), "1Gi"; got != want {
+		t.Errorf("Want volume size limit %s, got %s", want, got)
+	}
+
+	// pods pinned to a single node can use volumes that
+	// only support a single node.
+	opts.node = "node-1"
+	claims = toPersistentVolumeClaims(spec, &opts)
+	if got, want := claims[0].Spec.AccessModes[0], v1.ReadWriteOnce; got != want {
+		t.Errorf("Want access mode %s, got %s", want, got)
+	}
+}
+
+func TestToEmptyDirSource(t *testing.T) {
+	spec := &engine.Spec{
+		Metadata: engine.Metadata{Namespace: "ns-pipeline"},
+	}
+	vol := &engine.Volume{
+		Metadata: engine.Metadata{UID: "uid-1"},
+		EmptyDir: &engine.VolumeEmptyDir{},
+	}
+
+	opts := defaultOptions()
+	source := toEmptyDirSource(spec, vol, &opts)
+	if source.HostPath == nil {
+		t.Errorf("Want host path volume source")
+	} else if got, want := source.HostPath.Path, "/tmp/drone/ns-pipeline/uid-1"; got != want {
+		t.Errorf("Want host path %q, got %q", want, got)
+	}
+
+	opts.claim = true
+	source = toEmptyDirSource(spec, vol, &opts)
+	if source.PersistentVolumeClaim == nil {
+		t.Errorf("Want persistent volume claim source")
+	} else if got, want := source.PersistentVolumeClaim.ClaimName, "uid-1"; got != want {
+		t.Errorf("Want claim name %q, got %q", want, got)
+	}
+}
+
+func TestToCleanupPod(t *testing.T) {
+	opts := defaultOptions()
+	opts.node = "node-1"
+	pod := toCleanupPod(testSpec, &opts)
+	if pod == nil {
+		t.Errorf("Want cleanup pod for host path volumes")
+		return
+	}
+	if got, want := pod.Namespace, "ns-pipeline"; got != want {
+		t.Errorf("Want namespace %q, got %q", want, got)
+	}
+	// the cleanup pod must run on the node to which the
+	// pipeline pods are pinned.
+	affinity := pod.Spec.Affinity
+	if affinity == nil {
+		t.Errorf("Want cleanup pod pinned to the pipeline node")
+	} else if got, want := affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms[0].MatchExpressions[0].Values[0], "node-1"; got != want {
+		t.Errorf("Want cleanup pod pinned to node %q, got %q", want, got)
+	}
+	if got, want := pod.Spec.Volumes[0].HostPath.Path, "/tmp/drone"; got != want {
+		t.Errorf("Want host path %q, got %q", want, got)
+	}
+	container := pod.Spec.Containers[0]
+	if got, want := container.Image, defaultInitImage; got != want {
+		t.Errorf("Want image %q, got %q", want, got)
+	}
+	if got, want := container.Args[0], "rm -rf /drone/volumes/ns-pipeline"; got != want {
+		t.Errorf("Want cleanup script %q, got %q", want, got)
+	}
+
+	opts.claim = true
+	if toCleanupPod(testSpec, &opts) != nil {
+		t.Errorf("Want no cleanup pod for persistent volume claims")
+	}
+	opts.claim = false
+	opts.singlePod = true
+	if toCleanupPod(testSpec, &opts) != nil {
+		t.Errorf("Want no cleanup pod in single pod mode")
+	}
+	opts.singlePod = false
+	if toCleanupPod(&engine.Spec{}, &opts) != nil {
+		t.Errorf("Want no cleanup pod without empty_dir volumes")
+	}
+}
@@ -0,0 +1,184 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Drone Non-Commercial License
+// that can be found in the LICENSE file.
+
+package kube
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/api/core/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// errWatcherStopped is returned when waiting on a pod
+// after the pipeline has been destroyed.
+var errWatcherStopped = errors.New("kube: pipeline watcher stopped")
+
+// resync defines the informer resync period. Waiters are
+// notified on resync which ensures the pod conditions are
+// periodically re-evaluated.
+var resync = 30 * time.Second
+
+// podWatcher watches the pods in a single pipeline
+// namespace, using a namespace-scoped shared informer,
+// and notifies waiters when a pod changes.
+type podWatcher struct {
+	sync.Mutex
+
+	namespace string
+	lister    listers.PodLister
+	stop      chan struct{}
+	once      sync.Once
+	subs      map[string]map[chan struct{}]struct{}
+	deleted   map[string]bool
+}
+
+// newWatcher creates and starts a pod watcher for the
+// named namespace.
+func newWatcher(client kubernetes.Interface, namespace string) *podWatcher {
+	factory := informers.NewSharedInformerFactoryWithOptions(
+		client, resync, informers.WithNamespace(namespace))
+	informer := factory.Core().V1().Pods()
+
+	w := &podWatcher{
+		namespace: namespace,
+		lister:    informer.Lister(),
+		stop:      make(chan struct{}),
+		subs:      map[string]map[chan struct{}]struct{}{},
+		deleted:   map[string]bool{},
+	}
+	informer.Informer().AddEventHandler(
+		cache.ResourceEventHandlerFuncs{
+			AddFunc: w.notify,
+			UpdateFunc: func(_, obj interface{}) {
+				w.notify(obj)
+			},
+			DeleteFunc: w.delete,
+		},
+	)
+	factory.Start(w.stop)
+	return w
+}
+
+// wait blocks until the condition function returns true
+// for the named pod, the condition function returns an
+// error, or the context is cancelled.
+func (w *podWatcher) wait(ctx context.Context, name string, cond func(*v1.Pod) (bool, error)) (*v1.Pod, error) {
+	sub := w.subscribe(name)
+	defer w.unsubscribe(name, sub)
+
+	for {
+		// the pod may not exist in the informer cache
+		// until the informer receives the pod creation
+		// event, in which case we continue to wait.
+		if w.isDeleted(name) {
+			return nil, &PodError{
+				Name:    name,
+				Reason:  "Deleted",
+				Message: "the pod was deleted before the step completed",
+			}
+		}
+		pod, err := w.lister.Pods(w.namespace).Get(name)
+		if err == nil {
+			if ok, err := cond(pod); ok || err != nil {
+				return pod, err
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-w.stop:
+			return nil, errWatcherStopped
+		case <-sub:
+		}
+	}
+}
+
+// close stops the informer and releases all waiters.
+func (w *podWatcher) close() {
+	w.once.Do(func() {
+		close(w.stop)
+	})
+}
+
+func (w *podWatcher) notify(obj interface{}) {
+	pod, ok := obj.(*v1.Pod)
+	if !ok {
+		return
+	}
+	w.Lock()
+	delete(w.deleted, pod.Name)
+	w.broadcast(pod.Name)
+	w.Unlock()
+}
+
+// delete marks the pod as deleted and notifies waiters,
+// which fail since the pod cannot complete. If the informer
+// missed the delete event the object is a tombstone, which
+// includes the pod key.
+func (w *podWatcher) delete(obj interface{}) {
+	var name string
+	switch obj := obj.(type) {
+	case *v1.Pod:
+		name = obj.Name
+	case cache.DeletedFinalStateUnknown:
+		name = obj.Key
+		if i := strings.LastIndex(name, "/"); i != -1 {
+			name = name[i+1:]
+		}
+	default:
+		return
+	}
+	w.Lock()
+	w.deleted[name] = true
+	w.broadcast(name)
+	w.Unlock()
+}
+
+func (w *podWatcher) isDeleted(name string) bool {
+	w.Lock()
+	defer w.Unlock()
+	return w.deleted[name]
+}
+
+// broadcast notifies the waiters of the named pod. The
+// caller must hold the lock.
+func (w *podWatcher) broadcast(name string) {
+	for sub := range w.subs[name] {
+		// the subscription channel is buffered. If the
+		// buffer is full the waiter is already pending
+		// notification and can be skipped.
+		select {
+		case sub <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (w *podWatcher) subscribe(name string) chan struct{} {
+	sub := make(chan struct{}, 1)
+	w.Lock()
+	if w.subs[name] == nil {
+		w.subs[name] = map[chan struct{}]struct{}{}
+	}
+	w.subs[name][sub] = struct{}{}
+	w.Unlock()
+	return sub
+}
+
+func (w *podWatcher) unsubscribe(name string, sub chan struct{}) {
+	w.Lock()
+	delete(w.subs[name], sub)
+	if len(w.subs[name]) == 0 {
+		delete(w.subs, name)
+	}
+	w.Unlock()
+}
@@ -0,0 +1,100 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Drone Non-Commercial License
+// that can be found in the LICENSE file.
+
+package kube
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+)
+
+func newTestPod(name string) *v1.Pod {
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "ns_1",
+		},
+	}
+}
+
+func TestWatcherNotify(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	w := newWatcher(client, "ns_1")
+	defer w.close()
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		pod := newTestPod("pod_1")
+		pod.Status.Phase = v1.PodRunning
+		client.CoreV1().Pods("ns_1").Create(pod)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	pod, err := w.wait(ctx, "pod_1", func(pod *v1.Pod) (bool, error) {
+		return pod.Status.Phase == v1.PodRunning, nil
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if pod.Name != "pod_1" {
+		t.Errorf("Want pod_1, got %s", pod.Name)
+	}
+}
+
+func TestWatcherDelete(t *testing.T) {
+	client := fake.NewSimpleClientset(newTestPod("pod_1"))
+	w := newWatcher(client, "ns_1")
+	defer w.close()
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		client.CoreV1().Pods("ns_1").Delete("pod_1", &metav1.DeleteOptions{})
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := w.wait(ctx, "pod_1", func(*v1.Pod) (bool, error) {
+		return false, nil
+	})
+	perr, ok := err.(*PodError)
+	if !ok {
+		t.Errorf("Want PodError when the pod is deleted, got %v", err)
+		return
+	}
+	if got, want := perr.Reason, "Deleted"; got != want {
+		t.Errorf("Want reason %q, got %q", want, got)
+	}
+}
+
+func TestWatcherDeleteTombstone(t *testing.T) {
+	w := &podWatcher{
+		subs:    map[string]map[chan struct{}]struct{}{},
+		deleted: map[string]bool{},
+	}
+	sub := w.subscribe("pod_1")
+	w.delete(cache.DeletedFinalStateUnknown{Key: "ns_1/pod_1"})
+	select {
+	case <-sub:
+	default:
+		t.Errorf("Want waiters notified when the pod is deleted")
+	}
+	if !w.isDeleted("pod_1") {
+		t.Errorf("Want pod marked as deleted from tombstone key")
+	}
+
+	// the deleted flag is cleared if the pod is
+	// re-created.
+	w.notify(newTestPod("pod_1"))
+	if w.isDeleted("pod_1") {
+		t.Errorf("Want deleted flag cleared when the pod is re-created")
+	}
+}
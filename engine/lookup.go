@@ -23,6 +23,20 @@ func LookupVolume(spec *Spec, name string) (*Volume, bool) {
 	return nil, false
 }
 
+// LookupNetwork is a helper function that will lookup the
+// named network.
+func LookupNetwork(spec *Spec, name string) (*Network, bool) {
+	if spec.Docker == nil {
+		return nil, false
+	}
+	for _, net := range spec.Docker.Networks {
+		if net.Metadata.Name == name {
+			return net, true
+		}
+	}
+	return nil, false
+}
+
 // LookupSecret is a helper function that will lookup the
 // named secret.
 func LookupSecret(spec *Spec, secret *SecretVar) (*Secret, bool) {
@@ -45,6 +59,17 @@ func LookupFile(spec *Spec, name string) (*File, bool) {
 	return nil, false
 }
 
+// LookupStep is a helper function that will lookup the
+// named step.
+func LookupStep(spec *Spec, name string) (*Step, bool) {
+	for _, step := range spec.Steps {
+		if step.Metadata.Name == name {
+			return step, true
+		}
+	}
+	return nil, false
+}
+
 // LookupAuth is a helper function that will lookup the
 // docker credentials by hostname.
 func LookupAuth(spec *Spec, domain string) (*DockerAuth, bool) {
@@ -38,6 +38,38 @@ func TestLookupFile_NotFound(t *testing.T) {
 	}
 }
 
+//
+// Step Lookup Tests
+//
+
+func TestLookupStep(t *testing.T) {
+	want := &Step{Metadata: Metadata{Name: "foo"}}
+	spec := &Spec{
+		Steps: []*Step{want},
+	}
+	got, ok := LookupStep(spec, "foo")
+	if !ok {
+		t.Errorf("Expect step found")
+	}
+	if got != want {
+		t.Errorf("Expect step returned")
+	}
+}
+
+func TestLookupStep_NotFound(t *testing.T) {
+	want := &Step{Metadata: Metadata{Name: "foo"}}
+	spec := &Spec{
+		Steps: []*Step{want},
+	}
+	got, ok := LookupStep(spec, "bar")
+	if ok {
+		t.Errorf("Expect step not found")
+	}
+	if got != nil {
+		t.Errorf("Expect step not returned")
+	}
+}
+
 //
 // Secret Lookup Tests
 //
@@ -113,6 +145,49 @@ func TestLookupVolume_NotDocker(t *testing.T) {
 	}
 }
 
+//
+// Network Lookup Tests
+//
+
+func TestLookupNetwork(t *testing.T) {
+	want := &Network{Metadata: Metadata{Name: "foo"}}
+	spec := &Spec{
+		Docker: &DockerConfig{
+			Networks: []*Network{want},
+		},
+	}
+	got, ok := LookupNetwork(spec, "foo")
+	if !ok {
+		t.Errorf("Expect network found")
+	}
+	if got != want {
+		t.Errorf("Expect network returned")
+	}
+}
+
+func TestLookupNetwork_NotFound(t *testing.T) {
+	want := &Network{Metadata: Metadata{Name: "foo"}}
+	spec := &Spec{
+		Docker: &DockerConfig{
+			Networks: []*Network{want},
+		},
+	}
+	got, ok := LookupNetwork(spec, "bar")
+	if ok {
+		t.Errorf("Expect network not found")
+	}
+	if got != nil {
+		t.Errorf("Expect network not returned")
+	}
+}
+
+func TestLookupNetwork_NotDocker(t *testing.T) {
+	_, ok := LookupNetwork(&Spec{}, "foo")
+	if ok {
+		t.Fail()
+	}
+}
+
 //
 // Auth Lookup Tests
 //
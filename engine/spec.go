@@ -35,6 +35,10 @@ type (
 		// VMWare Fusion settings. These settings are only
 		// used by the VMWare runtime driver.
 		Fusion *FusionConfig `json:"fusion,omitempty"`
+
+		// Kubernetes-specific settings. These settings are
+		// only used by the Kubernetes runtime driver.
+		Kube *KubeConfig `json:"kube,omitempty"`
 	}
 
 	// Step defines a pipeline step.
@@ -48,6 +52,7 @@ type (
 		IgnoreErr    bool              `json:"ignore_err,omitempty"`
 		IgnoreStdout bool              `json:"ignore_stderr,omitempty"`
 		IgnoreStderr bool              `json:"ignore_stdout,omitempty"`
+		Inputs       []string          `json:"inputs,omitempty"`
 		Resources    *Resources        `json:"resources,omitempty"`
 		RunPolicy    RunPolicy         `json:"run_policy,omitempty"`
 		Secrets      []*SecretVar      `json:"secrets,omitempty"`
@@ -69,24 +74,50 @@ type (
 
 	// DockerConfig configures a Docker-based pipeline.
 	DockerConfig struct {
-		Auths   []*DockerAuth `json:"auths,omitempty"`
-		Volumes []*Volume     `json:"volumes,omitempty"`
+		Auths    []*DockerAuth `json:"auths,omitempty"`
+		Volumes  []*Volume     `json:"volumes,omitempty"`
+		Networks []*Network    `json:"networks,omitempty"`
 	}
 
 	// DockerStep configures a docker step.
 	DockerStep struct {
-		Args       []string   `json:"args,omitempty"`
-		Command    []string   `json:"command,omitempty"`
-		DNS        []string   `json:"dns,omitempty"`
-		DNSSearch  []string   `json:"dns_search,omitempty"`
-		ExtraHosts []string   `json:"extra_hosts,omitempty"`
-		Image      string     `json:"image,omitempty"`
-		Network    string     `json:"network,omitempty"`
-		Networks   []string   `json:"networks,omitempty"`
-		Ports      []*Port    `json:"ports,omitempty"`
-		Privileged bool       `json:"privileged,omitempty"`
-		PullPolicy PullPolicy `json:"pull_policy,omitempty"`
-		User       string     `json:"user"`
+		Args       []string    `json:"args,omitempty"`
+		Command    []string    `json:"command,omitempty"`
+		DNS        []string    `json:"dns,omitempty"`
+		DNSSearch  []string    `json:"dns_search,omitempty"`
+		ExtraHosts []string    `json:"extra_hosts,omitempty"`
+		Image      string      `json:"image,omitempty"`
+		Digest     string      `json:"digest,omitempty"`
+		Network    string      `json:"network,omitempty"`
+		Networks   []string    `json:"networks,omitempty"`
+		Endpoints  []*Endpoint `json:"endpoints,omitempty"`
+		Ports      []*Port     `json:"ports,omitempty"`
+		Privileged bool        `json:"privileged,omitempty"`
+		PullPolicy PullPolicy  `json:"pull_policy,omitempty"`
+		User       string      `json:"user"`
+
+		// Security settings. These settings can be used
+		// to run untrusted steps with least privilege as
+		// an alternative to privileged mode.
+		CapAdd          []string          `json:"cap_add,omitempty"`
+		CapDrop         []string          `json:"cap_drop,omitempty"`
+		ReadOnlyRootfs  bool              `json:"read_only_rootfs,omitempty"`
+		NoNewPrivileges bool              `json:"no_new_privileges,omitempty"`
+		SeccompProfile  string            `json:"seccomp_profile,omitempty"`
+		ApparmorProfile string            `json:"apparmor_profile,omitempty"`
+		Ulimits         []*Ulimit         `json:"ulimits,omitempty"`
+		Sysctls         map[string]string `json:"sysctls,omitempty"`
+		UsernsMode      string            `json:"userns_mode,omitempty"`
+	}
+
+	// Endpoint configures the attachment of a step to a
+	// named network, with optional network aliases and
+	// static ip addresses.
+	Endpoint struct {
+		Network     string   `json:"network,omitempty"`
+		Aliases     []string `json:"aliases,omitempty"`
+		IPv4Address string   `json:"ipv4_address,omitempty"`
+		IPv6Address string   `json:"ipv6_address,omitempty"`
 	}
 
 	// File defines a file that should be uploaded or
@@ -95,6 +126,11 @@ type (
 	File struct {
 		Metadata Metadata `json:"metadata,omitempty"`
 		Data     []byte   `json:"data,omitempty"`
+
+		// Secret indicates the file contains sensitive
+		// data, which the Kubernetes runtime driver
+		// stores as a secret.
+		Secret bool `json:"secret,omitempty"`
 	}
 
 	// FileMount defines how a file resource should be
@@ -112,6 +148,29 @@ type (
 		Image string `json:"image,omitempty"`
 	}
 
+	// KubeConfig configures the scheduling of pipeline
+	// pods in a Kubernetes-based pipeline.
+	KubeConfig struct {
+		NodeSelector     map[string]string `json:"node_selector,omitempty"`
+		Tolerations      []*Toleration     `json:"tolerations,omitempty"`
+		PriorityClass    string            `json:"priority_class,omitempty"`
+		RuntimeClass     string            `json:"runtime_class,omitempty"`
+		Annotations      map[string]string `json:"annotations,omitempty"`
+		Labels           map[string]string `json:"labels,omitempty"`
+		ImagePullSecrets []string          `json:"image_pull_secrets,omitempty"`
+	}
+
+	// Network defines a user-defined network that is
+	// created for the pipeline. Steps are attached to the
+	// network by name.
+	Network struct {
+		Metadata Metadata `json:"metadata,omitempty"`
+		Driver   string   `json:"driver,omitempty"`
+		Internal bool     `json:"internal,omitempty"`
+		Subnet   string   `json:"subnet,omitempty"`
+		Gateway  string   `json:"gateway,omitempty"`
+	}
+
 	// Platform defines the target platform.
 	Platform struct {
 		OS      string `json:"os,omitempty"`
@@ -166,9 +225,29 @@ type (
 
 	// State represents the container state.
 	State struct {
-		ExitCode  int  // Container exit code
-		Exited    bool // Container exited
-		OOMKilled bool // Container is oom killed
+		ExitCode  int    // Container exit code
+		Exited    bool   // Container exited
+		OOMKilled bool   // Container is oom killed
+		Finished  int64  // Container finished time (unix)
+		Error     string // Container error message
+		Digest    string // Container image digest
+	}
+
+	// Toleration allows pipeline pods to be scheduled
+	// to nodes with matching taints.
+	Toleration struct {
+		Key               string `json:"key,omitempty"`
+		Operator          string `json:"operator,omitempty"`
+		Value             string `json:"value,omitempty"`
+		Effect            string `json:"effect,omitempty"`
+		TolerationSeconds *int64 `json:"toleration_seconds,omitempty"`
+	}
+
+	// Ulimit defines a process resource limit.
+	Ulimit struct {
+		Name string `json:"name,omitempty"`
+		Soft int64  `json:"soft,omitempty"`
+		Hard int64  `json:"hard,omitempty"`
 	}
 
 	// Volume that can be mounted by containers.
@@ -0,0 +1,133 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Drone Non-Commercial License
+// that can be found in the LICENSE file.
+
+package engine
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ValidationError reports the problems found in a
+// pipeline specification.
+type ValidationError struct {
+	Problems []string
+}
+
+// Error returns the error message in string format.
+func (e *ValidationError) Error() string {
+	return strings.Join(e.Problems, "; ")
+}
+
+// Validate returns an error if the pipeline specification
+// is invalid, for example, if a step depends on an unknown
+// step, references an unknown volume, file or secret, or
+// if the step dependency graph contains a cycle.
+func Validate(spec *Spec) error {
+	var problems []string
+	report := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	names := map[string]*Step{}
+	for i, step := range spec.Steps {
+		name := step.Metadata.Name
+		switch {
+		case name == "":
+			report("step %d : missing name", i)
+			continue
+		case names[name] != nil:
+			report("%s : duplicate step name", name)
+		}
+		names[name] = step
+	}
+
+	for _, step := range spec.Steps {
+		name := step.Metadata.Name
+		if name == "" {
+			continue
+		}
+		if step.Docker != nil && step.Docker.Image == "" {
+			report("%s : missing image", name)
+		}
+		for _, dep := range step.DependsOn {
+			if names[dep] == nil {
+				report("%s : depends on unknown step %s", name, dep)
+			}
+		}
+		for _, mount := range step.Volumes {
+			if _, ok := LookupVolume(spec, mount.Name); !ok {
+				report("%s : unknown volume %s", name, mount.Name)
+			}
+		}
+		for _, mount := range step.Files {
+			if _, ok := LookupFile(spec, mount.Name); !ok {
+				report("%s : unknown file %s", name, mount.Name)
+			}
+		}
+		for _, secret := range step.Secrets {
+			if _, ok := LookupSecret(spec, secret); !ok {
+				report("%s : unknown secret %s", name, secret.Name)
+			}
+		}
+	}
+
+	if cycle := findCycle(spec, names); len(cycle) != 0 {
+		report("dependency cycle %s", strings.Join(cycle, " -> "))
+	}
+
+	if len(problems) != 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// helper function returns the steps that form a cycle in
+// the dependency graph, or nil if the graph is acyclic.
+func findCycle(spec *Spec, names map[string]*Step) []string {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	marks := map[string]int{}
+	var path []string
+	var visit func(name string) []string
+	visit = func(name string) []string {
+		switch marks[name] {
+		case visited:
+			return nil
+		case visiting:
+			// the cycle starts at the first occurrence
+			// of the step in the current path.
+			for i, n := range path {
+				if n == name {
+					return append(append([]string{}, path[i:]...), name)
+				}
+			}
+		}
+		marks[name] = visiting
+		path = append(path, name)
+		for _, dep := range names[name].DependsOn {
+			if names[dep] == nil {
+				continue
+			}
+			if cycle := visit(dep); cycle != nil {
+				return cycle
+			}
+		}
+		path = path[:len(path)-1]
+		marks[name] = visited
+		return nil
+	}
+	for _, step := range spec.Steps {
+		if names[step.Metadata.Name] == nil {
+			continue
+		}
+		if cycle := visit(step.Metadata.Name); cycle != nil {
+			return cycle
+		}
+	}
+	return nil
+}
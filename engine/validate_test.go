@@ -0,0 +1,102 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Drone Non-Commercial License
+// that can be found in the LICENSE file.
+
+package engine
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestValidate(t *testing.T) {
+	spec := &Spec{
+		Docker: &DockerConfig{
+			Volumes: []*Volume{
+				{Metadata: Metadata{Name: "workspace"}},
+			},
+		},
+		Secrets: []*Secret{
+			{Metadata: Metadata{Name: "password"}},
+		},
+		Steps: []*Step{
+			{
+				Metadata: Metadata{Name: "clone"},
+				Docker:   &DockerStep{Image: "drone/git"},
+				Volumes:  []*VolumeMount{{Name: "workspace"}},
+			},
+			{
+				Metadata:  Metadata{Name: "build"},
+				DependsOn: []string{"clone"},
+				Docker:    &DockerStep{Image: "golang"},
+				Secrets:   []*SecretVar{{Name: "password"}},
+			},
+		},
+	}
+	if err := Validate(spec); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestValidateProblems(t *testing.T) {
+	spec := &Spec{
+		Steps: []*Step{
+			{
+				Metadata: Metadata{Name: "clone"},
+				Docker:   &DockerStep{},
+			},
+			{
+				Metadata:  Metadata{Name: "build"},
+				DependsOn: []string{"clone", "lint"},
+				Volumes:   []*VolumeMount{{Name: "cache"}},
+				Files:     []*FileMount{{Name: "netrc"}},
+				Secrets:   []*SecretVar{{Name: "password"}},
+			},
+			{
+				Metadata: Metadata{Name: "build"},
+			},
+			{},
+		},
+	}
+	err := Validate(spec)
+	verr, ok := err.(*ValidationError)
+	if !ok {
+		t.Errorf("Want ValidationError, got %v", err)
+		return
+	}
+	want := []string{
+		"build : duplicate step name",
+		"step 3 : missing name",
+		"clone : missing image",
+		"build : depends on unknown step lint",
+		"build : unknown volume cache",
+		"build : unknown file netrc",
+		"build : unknown secret password",
+	}
+	if diff := cmp.Diff(want, verr.Problems); diff != "" {
+		t.Errorf("Unexpected validation problems")
+		t.Log(diff)
+	}
+}
+
+func TestValidateCycle(t *testing.T) {
+	spec := &Spec{
+		Steps: []*Step{
+			{Metadata: Metadata{Name: "a"}, DependsOn: []string{"c"}},
+			{Metadata: Metadata{Name: "b"}, DependsOn: []string{"a"}},
+			{Metadata: Metadata{Name: "c"}, DependsOn: []string{"b"}},
+		},
+	}
+	err := Validate(spec)
+	verr, ok := err.(*ValidationError)
+	if !ok {
+		t.Errorf("Want ValidationError, got %v", err)
+		return
+	}
+	want := []string{"dependency cycle a -> c -> b -> a"}
+	if diff := cmp.Diff(want, verr.Problems); diff != "" {
+		t.Errorf("Unexpected validation problems")
+		t.Log(diff)
+	}
+}
@@ -0,0 +1,342 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Drone Non-Commercial License
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/drone/drone-runtime/engine"
+	"github.com/drone/drone-runtime/engine/docker/auth"
+	"github.com/drone/drone-runtime/engine/kube"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// helper function creates a flag set for the named command
+// that writes the usage text to stdout when help is requested.
+func newFlagSet(name, text string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	fs.Usage = func() {
+		fmt.Println(text)
+	}
+	return fs
+}
+
+// helper function parses the command line flags. If parsing
+// fails, or help is requested, the exit code is returned
+// and ok is false.
+func parseFlags(fs *flag.FlagSet, args []string) (code int, ok bool) {
+	switch err := fs.Parse(args); err {
+	case nil:
+		return exitOK, true
+	case flag.ErrHelp:
+		return exitOK, false
+	default:
+		return exitUsage, false
+	}
+}
+
+// configFlag registers the docker config.json flag.
+type configFlag struct {
+	path string
+}
+
+func (c *configFlag) register(fs *flag.FlagSet) {
+	fs.StringVar(&c.path, "config", "", "")
+}
+
+// apply appends the docker credentials to the spec.
+func (c *configFlag) apply(spec *engine.Spec) error {
+	if c.path == "" {
+		return nil
+	}
+	auths, err := auth.ParseFile(c.path)
+	if err != nil {
+		return err
+	}
+	if spec.Docker == nil {
+		spec.Docker = &engine.DockerConfig{}
+	}
+	spec.Docker.Auths = append(spec.Docker.Auths, auths...)
+	return nil
+}
+
+const configUsage = `
+      --config      loads a docker config.json file`
+
+// kubeFlags registers the kubernetes engine flags shared
+// by the run and render commands.
+type kubeFlags struct {
+	node            string
+	namespacePrefix string
+	volumeClaim     bool
+	storageClass    string
+	volumeSize      string
+	serviceAccount  string
+	serviceToken    bool
+	sourceNamespace string
+	priorityClass   string
+	runtimeClass    string
+	networkPolicy   bool
+	resourceQuota   bool
+	initImage       string
+	singlePod       bool
+	placeholder     string
+	scheduleTimeout time.Duration
+
+	selectors   stringSlice
+	tolerations stringSlice
+	annotations stringSlice
+	labels      stringSlice
+	pullSecrets stringSlice
+	allowed     stringSlice
+	egress      stringSlice
+}
+
+func (k *kubeFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&k.node, "kube-node", "", "")
+	fs.StringVar(&k.namespacePrefix, "kube-namespace-prefix", "", "")
+	fs.BoolVar(&k.volumeClaim, "kube-volume-claim", false, "")
+	fs.StringVar(&k.storageClass, "kube-storage-class", "", "")
+	fs.StringVar(&k.volumeSize, "kube-volume-size", "", "")
+	fs.StringVar(&k.serviceAccount, "kube-service-account", "", "")
+	fs.BoolVar(&k.serviceToken, "kube-service-account-token", false, "")
+	fs.StringVar(&k.sourceNamespace, "kube-source-namespace", "", "")
+	fs.StringVar(&k.priorityClass, "kube-priority-class", "", "")
+	fs.StringVar(&k.runtimeClass, "kube-runtime-class", "", "")
+	fs.BoolVar(&k.networkPolicy, "kube-network-policy", false, "")
+	fs.BoolVar(&k.resourceQuota, "kube-resource-quota", false, "")
+	fs.StringVar(&k.initImage, "kube-init-image", "", "")
+	fs.BoolVar(&k.singlePod, "kube-single-pod", false, "")
+	fs.StringVar(&k.placeholder, "kube-placeholder-image", "", "")
+	fs.DurationVar(&k.scheduleTimeout, "kube-schedule-timeout", 0, "")
+	fs.Var(&k.selectors, "kube-node-selector", "")
+	fs.Var(&k.tolerations, "kube-toleration", "")
+	fs.Var(&k.annotations, "kube-annotation", "")
+	fs.Var(&k.labels, "kube-label", "")
+	fs.Var(&k.pullSecrets, "kube-pull-secret", "")
+	fs.Var(&k.allowed, "kube-allowed-pull-secret", "")
+	fs.Var(&k.egress, "kube-egress", "")
+}
+
+// options returns the kubernetes engine options.
+func (k *kubeFlags) options() ([]kube.Option, error) {
+	var opts []kube.Option
+	if k.volumeClaim {
+		var size resource.Quantity
+		if k.volumeSize != "" {
+			var err error
+			size, err = resource.ParseQuantity(k.volumeSize)
+			if err != nil {
+				return nil, err
+			}
+		}
+		opts = append(opts, kube.WithVolumeClaim(k.storageClass, size))
+	}
+	opts = append(opts,
+		kube.WithNode(k.node),
+		kube.WithNamespacePrefix(k.namespacePrefix),
+		kube.WithInitImage(k.initImage),
+		kube.WithNodeSelector(k.selectors.Map()),
+		kube.WithPodAnnotations(k.annotations.Map()),
+		kube.WithPodLabels(k.labels.Map()),
+		kube.WithImagePullSecrets(k.pullSecrets...),
+		kube.WithAllowedPullSecrets(k.allowed...),
+		kube.WithServiceAccount(k.serviceAccount),
+		kube.WithSourceNamespace(k.sourceNamespace),
+		kube.WithPriorityClass(k.priorityClass),
+		kube.WithRuntimeClass(k.runtimeClass),
+		kube.WithScheduleTimeout(k.scheduleTimeout),
+	)
+	var tolerate []*engine.Toleration
+	for _, s := range k.tolerations {
+		tolerate = append(tolerate, parseToleration(s))
+	}
+	opts = append(opts, kube.WithTolerations(tolerate...))
+	if k.serviceToken {
+		opts = append(opts, kube.WithServiceAccountToken())
+	}
+	if k.networkPolicy {
+		var rules []*kube.Egress
+		for _, s := range k.egress {
+			rule, err := parseEgress(s)
+			if err != nil {
+				return nil, err
+			}
+			rules = append(rules, rule)
+		}
+		opts = append(opts, kube.WithNetworkPolicy(rules...))
+	}
+	if k.resourceQuota {
+		opts = append(opts, kube.WithResourceQuota())
+	}
+	if k.singlePod {
+		opts = append(opts,
+			kube.WithSinglePod(),
+			kube.WithPlaceholderImage(k.placeholder),
+		)
+	}
+	return opts, nil
+}
+
+const kubeUsage = `
+Kubernetes options:
+      --kube-node   pins all pods to the kubernetes node
+      --kube-namespace-prefix
+                    adds the prefix to pipeline namespaces
+      --kube-volume-claim
+                    backs temporary volumes with persistent
+                    volume claims
+      --kube-storage-class
+                    sets the persistent volume claim storage
+                    class (default cluster default)
+      --kube-volume-size
+                    sets the persistent volume claim size
+                    (default 5Gi)
+      --kube-node-selector
+                    schedules pods to nodes with the label
+                    in key=value format (repeatable)
+      --kube-toleration
+                    tolerates the node taint in
+                    key[=value][:effect] format (repeatable)
+      --kube-service-account
+                    runs pods with the service account
+      --kube-service-account-token
+                    mounts the service account token in pods
+      --kube-source-namespace
+                    copies the service account and pull
+                    secrets from the namespace (default
+                    default)
+      --kube-priority-class
+                    sets the pod priority class
+      --kube-runtime-class
+                    sets the pod runtime class
+      --kube-annotation
+                    adds the pod annotation in key=value
+                    format (repeatable)
+      --kube-label  adds the pod label in key=value format
+                    (repeatable)
+      --kube-pull-secret
+                    pulls images using the named secret
+                    (repeatable)
+      --kube-allowed-pull-secret
+                    allows pipelines to pull images using
+                    the named secret (repeatable)
+      --kube-network-policy
+                    isolates the pipeline namespace, allowing
+                    only dns and intra-namespace traffic
+      --kube-egress allows traffic to the destination in
+                    cidr[:port[/udp][,port[/udp]]] format,
+                    where ports are tcp unless suffixed
+                    with /udp (repeatable)
+      --kube-resource-quota
+                    limits the pipeline namespace to the sum
+                    of the step resources
+      --kube-init-image
+                    sets the image used to write files to
+                    the pod (default busybox:1)
+      --kube-single-pod
+                    executes all steps in a single pod
+      --kube-placeholder-image
+                    sets the image used for steps that have
+                    not started (default drone/placeholder:1)
+      --kube-schedule-timeout
+                    fails steps that cannot be scheduled for
+                    longer than the duration (default 5m)`
+
+// stringSlice implements a repeatable string flag.
+type stringSlice []string
+
+func (s *stringSlice) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringSlice) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+// Map returns the key=value flag values as a map.
+func (s stringSlice) Map() map[string]string {
+	if len(s) == 0 {
+		return nil
+	}
+	m := map[string]string{}
+	for _, v := range s {
+		parts := strings.SplitN(v, "=", 2)
+		if len(parts) == 2 {
+			m[parts[0]] = parts[1]
+		} else {
+			m[parts[0]] = ""
+		}
+	}
+	return m
+}
+
+// helper function parses a toleration in key[=value][:effect]
+// format. If the value is omitted, the toleration matches
+// all taints with the key.
+func parseToleration(s string) *engine.Toleration {
+	t := new(engine.Toleration)
+	if i := strings.LastIndex(s, ":"); i != -1 {
+		s, t.Effect = s[:i], s[i+1:]
+	}
+	if i := strings.Index(s, "="); i != -1 {
+		t.Key, t.Value, t.Operator = s[:i], s[i+1:], "Equal"
+	} else {
+		t.Key, t.Operator = s, "Exists"
+	}
+	return t
+}
+
+// helper function parses an egress destination in
+// cidr[:port[/protocol][,port[/protocol]]...] format. The
+// ports are separated from the cidr by the first colon
+// after the prefix length, since ipv6 addresses contain
+// colons.
+func parseEgress(s string) (*kube.Egress, error) {
+	e := new(kube.Egress)
+	e.CIDR = s
+	slash := strings.Index(s, "/")
+	if slash == -1 {
+		return nil, fmt.Errorf("invalid egress cidr %q", s)
+	}
+	var ports string
+	if i := strings.Index(s[slash:], ":"); i != -1 {
+		e.CIDR, ports = s[:slash+i], s[slash+i+1:]
+	}
+	if _, _, err := net.ParseCIDR(e.CIDR); err != nil {
+		return nil, fmt.Errorf("invalid egress cidr %q", e.CIDR)
+	}
+	if ports == "" {
+		return e, nil
+	}
+	for _, p := range strings.Split(ports, ",") {
+		protocol := "tcp"
+		if i := strings.Index(p, "/"); i != -1 {
+			p, protocol = p[:i], strings.ToLower(p[i+1:])
+		}
+		port, err := strconv.Atoi(p)
+		if err != nil || port < 1 || port > 65535 {
+			return nil, fmt.Errorf("invalid egress port %q", p)
+		}
+		switch protocol {
+		case "tcp":
+			e.Ports = append(e.Ports, port)
+		case "udp":
+			e.UDPPorts = append(e.UDPPorts, port)
+		default:
+			return nil, fmt.Errorf("invalid egress protocol %q", protocol)
+		}
+	}
+	return e, nil
+}
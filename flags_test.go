@@ -0,0 +1,72 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Drone Non-Commercial License
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/drone/drone-runtime/engine/kube"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseEgress(t *testing.T) {
+	tests := []struct {
+		text string
+		want *kube.Egress
+	}{
+		{
+			text: "10.0.0.0/8",
+			want: &kube.Egress{CIDR: "10.0.0.0/8"},
+		},
+		{
+			text: "10.0.0.0/8:443,8443",
+			want: &kube.Egress{CIDR: "10.0.0.0/8", Ports: []int{443, 8443}},
+		},
+		{
+			text: "10.0.0.0/8:443,53/udp,53/tcp",
+			want: &kube.Egress{CIDR: "10.0.0.0/8", Ports: []int{443, 53}, UDPPorts: []int{53}},
+		},
+		{
+			text: "fd00::/8",
+			want: &kube.Egress{CIDR: "fd00::/8"},
+		},
+		{
+			text: "fd00::/8:443",
+			want: &kube.Egress{CIDR: "fd00::/8", Ports: []int{443}},
+		},
+		{
+			text: "2001:db8::/32:443,123/udp",
+			want: &kube.Egress{CIDR: "2001:db8::/32", Ports: []int{443}, UDPPorts: []int{123}},
+		},
+	}
+	for _, test := range tests {
+		got, err := parseEgress(test.text)
+		if err != nil {
+			t.Errorf("Want egress %q parsed, got error %s", test.text, err)
+			continue
+		}
+		if diff := cmp.Diff(test.want, got); diff != "" {
+			t.Errorf("Unexpected egress for %q", test.text)
+			t.Log(diff)
+		}
+	}
+}
+
+func TestParseEgressError(t *testing.T) {
+	tests := []string{
+		"10.0.0.1",
+		"fd00::1",
+		"10.0.0.0/8:https",
+		"10.0.0.0/8:0",
+		"10.0.0.0/8:443/sctp",
+		"fd00::/8:443:80",
+	}
+	for _, text := range tests {
+		if _, err := parseEgress(text); err == nil {
+			t.Errorf("Want error parsing egress %q", text)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Drone Non-Commercial License
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/drone/drone-runtime/engine"
+	"github.com/drone/drone-runtime/runtime/logsink"
+)
+
+const graphUsage = `Usage: drone-runtime graph [OPTION]... [SOURCE]
+
+Writes the pipeline step graph to stdout, in graphviz dot
+or mermaid format.
+
+Options:
+      --format      sets the output format, dot or mermaid
+                    (default dot)
+      --log-dir     colors the steps by the status written
+                    to the log directory by the run command
+  -h, --help        display this help and exit`
+
+func graphCmd(args []string) int {
+	fs := newFlagSet("graph", graphUsage)
+
+	var (
+		opts   engine.GraphOptions
+		logDir string
+	)
+	fs.StringVar(&opts.Format, "format", engine.GraphDOT, "")
+	fs.StringVar(&logDir, "log-dir", "", "")
+
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+
+	spec, code, err := readSpec(fs.Args())
+	if err != nil {
+		return failWith(err, code)
+	}
+	if logDir != "" {
+		opts.Status, err = readStatus(logDir)
+		if err != nil {
+			return fail(err)
+		}
+	}
+	if err := engine.WriteGraph(os.Stdout, spec, opts); err != nil {
+		return failWith(err, exitUsage)
+	}
+	return exitOK
+}
+
+// helper function reads the step status from the index
+// file in the log directory.
+func readStatus(dir string) (map[string]string, error) {
+	data, err := ioutil.ReadFile(filepath.Join(dir, logsink.IndexFile))
+	if err != nil {
+		return nil, err
+	}
+	index := new(logsink.Index)
+	if err := json.Unmarshal(data, index); err != nil {
+		return nil, err
+	}
+	status := map[string]string{}
+	for _, step := range index.Steps {
+		status[step.Name] = step.Status
+	}
+	return status, nil
+}
@@ -0,0 +1,75 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Drone Non-Commercial License
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/drone/drone-runtime/engine"
+	"github.com/drone/drone-runtime/runtime"
+)
+
+const inspectUsage = `Usage: drone-runtime inspect [OPTION]... [SOURCE]
+
+Summarizes the pipeline steps, their dependencies, and
+the order in which the steps are executed. Steps in the
+same stage are executed in parallel.
+
+Options:
+  -h, --help        display this help and exit`
+
+func inspectCmd(args []string) int {
+	fs := newFlagSet("inspect", inspectUsage)
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+
+	spec, code, err := readSpec(fs.Args())
+	if err != nil {
+		return failWith(err, code)
+	}
+	if err := engine.Validate(spec); err != nil {
+		return failWith(err, exitInvalid)
+	}
+
+	plan := runtime.NewPlan(spec)
+	stages := map[string]int{}
+	for i, wave := range plan.Waves {
+		for _, step := range wave {
+			stages[step.Name] = i + 1
+		}
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "STAGE\tSTEP\tIMAGE\tDEPENDS ON\tRUN\tDETACH")
+	for _, step := range spec.Steps {
+		var image string
+		if step.Docker != nil {
+			image = step.Docker.Image
+		}
+		depends := strings.Join(step.DependsOn, ",")
+		if depends == "" {
+			depends = "-"
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%v\n",
+			stages[step.Metadata.Name],
+			step.Metadata.Name,
+			image,
+			depends,
+			step.RunPolicy,
+			step.Detach,
+		)
+	}
+	w.Flush()
+
+	mode := "graph"
+	if plan.Serial {
+		mode = "serial"
+	}
+	fmt.Printf("\n%d steps, %d stages, %s execution\n", len(spec.Steps), len(plan.Waves), mode)
+	return exitOK
+}
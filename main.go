@@ -5,109 +5,129 @@
 package main
 
 import (
-	"context"
-	"flag"
 	"fmt"
-	"log"
+	"io"
 	"os"
-	"time"
 
 	"github.com/mattn/go-isatty"
 
 	"github.com/drone/drone-runtime/engine"
-	"github.com/drone/drone-runtime/engine/docker"
-	"github.com/drone/drone-runtime/engine/docker/auth"
-	"github.com/drone/drone-runtime/engine/kube"
-	"github.com/drone/drone-runtime/runtime"
-	"github.com/drone/drone-runtime/runtime/term"
-	"github.com/drone/signal"
 )
 
 var tty = isatty.IsTerminal(os.Stdout.Fd())
 
+// exit codes returned by the command line utility.
+const (
+	exitOK        = 0   // command completed successfully
+	exitFailure   = 1   // command failed, or a pipeline step failed
+	exitUsage     = 2   // invalid command line usage
+	exitInvalid   = 3   // invalid pipeline specification
+	exitEngine    = 4   // engine error, for example, a connection failure
+	exitTimeout   = 5   // pipeline execution timed out
+	exitCancel    = 130 // pipeline execution cancelled
+	exitOOMKilled = 137 // pipeline step received an oom kill
+)
+
+// command defines a command line sub-command.
+type command struct {
+	name  string
+	short string
+	run   func(args []string) int
+}
+
+var commands = []*command{
+	{"run", "executes the pipeline", runCmd},
+	{"validate", "validates the pipeline specification", validateCmd},
+	{"render", "writes the pipeline kubernetes or docker manifest", renderCmd},
+	{"prune", "removes leftover docker resources", pruneCmd},
+	{"inspect", "summarizes the pipeline steps and dependencies", inspectCmd},
+	{"graph", "writes the pipeline step graph in dot or mermaid format", graphCmd},
+}
+
 func main() {
-	c := flag.String("config", "", "")
-	k := flag.String("kube-config", "", "")
-	u := flag.String("kube-url", "", "")
-	n := flag.String("kube-node", "", "")
-	d := flag.Bool("kube-debug", false, "")
-	t := flag.Duration("timeout", time.Hour, "")
-	h := flag.Bool("help", false, "")
-
-	flag.BoolVar(h, "h", false, "")
-	flag.Usage = usage
-	flag.Parse()
-
-	if *h {
-		flag.Usage()
-		os.Exit(0)
-	}
+	os.Exit(dispatch(os.Args[1:]))
+}
 
-	var source string
-	if flag.NArg() > 0 {
-		source = flag.Args()[0]
+// helper function invokes the named sub-command. If the
+// first argument is not a known command, the arguments
+// are passed to the run command.
+func dispatch(args []string) int {
+	if len(args) == 0 {
+		return runCmd(args)
 	}
-
-	config, err := engine.ParseFile(source)
-	if err != nil {
-		log.Fatalln(err)
+	switch args[0] {
+	case "-h", "-help", "--help", "help":
+		usage()
+		return exitOK
 	}
-
-	if *c != "" {
-		auths, err := auth.ParseFile(*c)
-		if err != nil {
-			log.Fatalln(err)
+	for _, cmd := range commands {
+		if cmd.name == args[0] {
+			return cmd.run(args[1:])
 		}
-		config.Docker.Auths = append(config.Docker.Auths, auths...)
 	}
+	return runCmd(args)
+}
 
-	if *d == true {
-		println(kube.Print(config))
-		return
+// helper function parses the pipeline specification from
+// the source file. If the source is empty or -, the
+// specification is read from stdin. The exit code
+// distinguishes usage and read errors from an invalid
+// specification.
+func readSpec(args []string) (*engine.Spec, int, error) {
+	if len(args) > 1 {
+		return nil, exitUsage, fmt.Errorf("too many arguments: %v", args[1:])
 	}
-
-	var engine engine.Engine
-	if *k == "" {
-		engine, err = docker.NewEnv()
-		if err != nil {
-			log.Fatalln(err)
-		}
-	} else {
-		engine, err = kube.NewFile(*u, *k, *n)
+	r := io.Reader(os.Stdin)
+	if len(args) == 1 && args[0] != "-" {
+		f, err := os.Open(args[0])
 		if err != nil {
-			log.Fatalln(err)
+			return nil, exitFailure, err
 		}
+		defer f.Close()
+		r = f
 	}
-
-	hooks := &runtime.Hook{}
-	hooks.GotLine = term.WriteLine(os.Stdout)
-	if tty {
-		hooks.GotLine = term.WriteLinePretty(os.Stdout)
+	spec, err := engine.Parse(r)
+	if err != nil {
+		return nil, exitInvalid, err
 	}
+	return spec, exitOK, nil
+}
 
-	r := runtime.New(
-		runtime.WithEngine(engine),
-		runtime.WithConfig(config),
-		runtime.WithHooks(hooks),
-	)
-
-	ctx, cancel := context.WithTimeout(context.Background(), *t)
-	ctx = signal.WithContext(ctx)
-	defer cancel()
+// helper function writes the error to stderr and returns
+// the failure exit code.
+func fail(err error) int {
+	return failWith(err, exitFailure)
+}
 
-	err = r.Run(ctx)
-	if err != nil {
-		log.Fatalln(err)
-	}
+// helper function writes the error to stderr and returns
+// the exit code.
+func failWith(err error, code int) int {
+	fmt.Fprintln(os.Stderr, err)
+	return code
 }
 
 func usage() {
-	fmt.Println(`Usage: drone-runtime [OPTION]... [SOURCE]
-      --config      loads a docker config.json file
-      --plugin      loads a runtime engine from a .so file
-      --kube-config loads a kubernetes config file
-      --kube-url    sets a kubernetes endpoint
-      --kube-debug  writes a kubernetes configuration to stdout
-      --timeout     sets an execution timeout
-  -h, --help        display this help and exit`)
+	fmt.Println(`Usage: drone-runtime COMMAND [OPTION]... [SOURCE]
+
+Commands:`)
+	for _, cmd := range commands {
+		fmt.Printf("  %-10s  %s\n", cmd.name, cmd.short)
+	}
+	fmt.Println(`
+If the command is omitted the pipeline is executed. If the
+source is omitted, or is -, the pipeline specification is
+read from stdin.
+
+Exit status:
+  0    if the command succeeds
+  1    if the command or a pipeline step fails
+  2    if the command line usage is invalid
+  3    if the pipeline specification is invalid
+  4    if the engine returns an error
+  5    if the pipeline times out
+  130  if the pipeline is cancelled
+  137  if a pipeline step receives an oom kill
+
+Use "drone-runtime COMMAND --help" for more information
+about a command.`)
 }
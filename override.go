@@ -0,0 +1,268 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Drone Non-Commercial License
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/drone/drone-runtime/engine"
+)
+
+// overrideFlags registers the flags that patch the pipeline
+// environment, secrets and files before execution.
+type overrideFlags struct {
+	envs        stringSlice
+	envFiles    stringSlice
+	secrets     stringSlice
+	secretFiles stringSlice
+	files       stringSlice
+	steps       stringSlice
+}
+
+func (o *overrideFlags) register(fs *flag.FlagSet) {
+	fs.Var(&o.envs, "env", "")
+	fs.Var(&o.envFiles, "env-file", "")
+	fs.Var(&o.secrets, "secret", "")
+	fs.Var(&o.secretFiles, "secret-file", "")
+	fs.Var(&o.files, "file", "")
+	fs.Var(&o.steps, "apply-to", "")
+}
+
+// apply patches the pipeline specification. Environment
+// variables, secrets and files are applied to the selected
+// steps, or to all steps if no steps are selected.
+func (o *overrideFlags) apply(spec *engine.Spec) error {
+	steps, err := o.selectSteps(spec)
+	if err != nil {
+		return err
+	}
+
+	envs, err := readPairs(o.envs, o.envFiles)
+	if err != nil {
+		return err
+	}
+	secrets, err := readPairs(o.secrets, o.secretFiles)
+	if err != nil {
+		return err
+	}
+	// an empty secret value cannot be masked in the logs.
+	for _, pair := range secrets {
+		if pair[1] == "" {
+			return fmt.Errorf("secret %s has an empty value", pair[0])
+		}
+	}
+
+	for _, step := range steps {
+		if len(envs) != 0 && step.Envs == nil {
+			step.Envs = map[string]string{}
+		}
+		for _, pair := range envs {
+			step.Envs[pair[0]] = pair[1]
+		}
+		for _, pair := range secrets {
+			step.Secrets = appendSecretVar(step.Secrets, pair[0])
+		}
+	}
+
+	// secrets are added to the specification, instead of
+	// the step environment, to ensure secret values are
+	// masked in the logs.
+	for _, pair := range secrets {
+		secret, ok := engine.LookupSecret(spec, &engine.SecretVar{Name: pair[0]})
+		if !ok {
+			secret = &engine.Secret{Metadata: engine.Metadata{Name: pair[0]}}
+			spec.Secrets = append(spec.Secrets, secret)
+		}
+		secret.Data = pair[1]
+	}
+
+	for _, s := range o.files {
+		name, data, err := readFileFlag(s)
+		if err != nil {
+			return err
+		}
+		file, ok := engine.LookupFile(spec, name)
+		switch {
+		case !ok:
+			spec.Files = append(spec.Files, &engine.File{
+				Metadata: engine.Metadata{Name: name},
+				Data:     data,
+			})
+		case !isMountedExcept(spec, steps, name):
+			file.Data = data
+		default:
+			// the file is also mounted by steps that are not
+			// selected, so the selected steps mount a copy.
+			clone := &engine.File{Metadata: file.Metadata, Data: data}
+			clone.Metadata.Name = name + "-override"
+			if clone.Metadata.UID != "" {
+				clone.Metadata.UID += "-override"
+			}
+			spec.Files = append(spec.Files, clone)
+			for _, step := range steps {
+				for _, mount := range step.Files {
+					if mount.Name == name {
+						mount.Name = clone.Metadata.Name
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// helper function returns true if the named file is
+// mounted by a step that is not in the list of steps.
+func isMountedExcept(spec *engine.Spec, steps []*engine.Step, name string) bool {
+	for _, step := range spec.Steps {
+		if containsStep(steps, step) {
+			continue
+		}
+		for _, mount := range step.Files {
+			if mount.Name == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// helper function returns true if the list contains the
+// step.
+func containsStep(steps []*engine.Step, step *engine.Step) bool {
+	for _, s := range steps {
+		if s == step {
+			return true
+		}
+	}
+	return false
+}
+
+// helper function returns the steps selected by name, or
+// all steps if no steps are selected.
+func (o *overrideFlags) selectSteps(spec *engine.Spec) ([]*engine.Step, error) {
+	if len(o.steps) == 0 {
+		return spec.Steps, nil
+	}
+	var steps []*engine.Step
+	for _, name := range o.steps {
+		step, ok := engine.LookupStep(spec, name)
+		if !ok {
+			return nil, fmt.Errorf("unknown step %s", name)
+		}
+		steps = append(steps, step)
+	}
+	return steps, nil
+}
+
+const overrideUsage = `
+Override options:
+      --env         sets the environment variable in
+                    KEY=VALUE format (repeatable)
+      --env-file    loads environment variables from a
+                    file in KEY=VALUE format (repeatable)
+      --secret      sets the secret in NAME=VALUE format,
+                    exposed as environment variable NAME
+                    and masked in the logs (repeatable)
+      --secret-file loads secrets from a file in NAME=VALUE
+                    format (repeatable)
+      --file        sets the file contents in NAME=@PATH
+                    or NAME=VALUE format (repeatable)
+      --apply-to    applies environment variables, secrets
+                    and files to the named step only
+                    (repeatable)`
+
+// helper function appends the secret variable to the list,
+// unless the secret is already exposed to the step.
+func appendSecretVar(vars []*engine.SecretVar, name string) []*engine.SecretVar {
+	for _, v := range vars {
+		if v.Name == name {
+			return vars
+		}
+	}
+	return append(vars, &engine.SecretVar{Name: name, Env: name})
+}
+
+// helper function returns the KEY=VALUE pairs from the flag
+// values and files, in order. Files are loaded first, so
+// that flag values take precedence.
+func readPairs(values, paths []string) ([][2]string, error) {
+	var pairs [][2]string
+	for _, path := range paths {
+		lines, err := readLines(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, line := range lines {
+			pair, err := parsePair(line)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s", path, err)
+			}
+			pairs = append(pairs, pair)
+		}
+	}
+	for _, value := range values {
+		pair, err := parsePair(value)
+		if err != nil {
+			return nil, err
+		}
+		pairs = append(pairs, pair)
+	}
+	return pairs, nil
+}
+
+// helper function returns the non-empty lines in the file,
+// ignoring comments.
+func readLines(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		lines = append(lines, strings.TrimPrefix(line, "export "))
+	}
+	return lines, scanner.Err()
+}
+
+// helper function parses a KEY=VALUE pair. Quotes around
+// the value are removed.
+func parsePair(s string) ([2]string, error) {
+	parts := strings.SplitN(s, "=", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return [2]string{}, fmt.Errorf("invalid value %q, want KEY=VALUE", s)
+	}
+	value := parts[1]
+	if len(value) > 1 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+		value = value[1 : len(value)-1]
+	}
+	return [2]string{parts[0], value}, nil
+}
+
+// helper function parses a file in NAME=@PATH or NAME=VALUE
+// format, and returns the file name and contents.
+func readFileFlag(s string) (string, []byte, error) {
+	parts := strings.SplitN(s, "=", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return "", nil, fmt.Errorf("invalid file %q, want NAME=@PATH", s)
+	}
+	if !strings.HasPrefix(parts[1], "@") {
+		return parts[0], []byte(parts[1]), nil
+	}
+	data, err := ioutil.ReadFile(parts[1][1:])
+	return parts[0], data, err
+}
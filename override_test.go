@@ -0,0 +1,272 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Drone Non-Commercial License
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/drone/drone-runtime/engine"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParsePair(t *testing.T) {
+	tests := []struct {
+		text string
+		want [2]string
+		err  bool
+	}{
+		{text: "FOO=bar", want: [2]string{"FOO", "bar"}},
+		{text: "FOO=bar=baz", want: [2]string{"FOO", "bar=baz"}},
+		{text: "FOO=", want: [2]string{"FOO", ""}},
+		{text: `FOO="bar baz"`, want: [2]string{"FOO", "bar baz"}},
+		{text: "FOO='bar'", want: [2]string{"FOO", "bar"}},
+		{text: `FOO="bar'`, want: [2]string{"FOO", `"bar'`}},
+		{text: `FOO="`, want: [2]string{"FOO", `"`}},
+		{text: "FOO", err: true},
+		{text: "=bar", err: true},
+	}
+	for _, test := range tests {
+		got, err := parsePair(test.text)
+		if test.err != (err != nil) {
+			t.Errorf("Want error %v parsing %q, got %v", test.err, test.text, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("Want %q parsing %q, got %q", test.want, test.text, got)
+		}
+	}
+}
+
+func TestReadPairs(t *testing.T) {
+	path := writeTempFile(t, "# comment\n\nFOO=file\nexport BAR=\"bar\"\n")
+	defer os.RemoveAll(filepath.Dir(path))
+
+	// files are loaded before the flag values, so that the
+	// flag values take precedence.
+	got, err := readPairs([]string{"FOO=flag"}, []string{path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][2]string{{"FOO", "file"}, {"BAR", "bar"}, {"FOO", "flag"}}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Unexpected pairs")
+		t.Log(diff)
+	}
+
+	if _, err := readPairs(nil, []string{path + ".missing"}); err == nil {
+		t.Errorf("Want error reading a missing file")
+	}
+	if _, err := readPairs([]string{"FOO"}, nil); err == nil {
+		t.Errorf("Want error parsing an invalid pair")
+	}
+}
+
+func TestReadFileFlag(t *testing.T) {
+	path := writeTempFile(t, "echo hello")
+	defer os.RemoveAll(filepath.Dir(path))
+
+	tests := []struct {
+		text string
+		name string
+		data string
+		err  bool
+	}{
+		{text: "script=echo hi", name: "script", data: "echo hi"},
+		{text: "script=@" + path, name: "script", data: "echo hello"},
+		{text: "script=@" + path + ".missing", err: true},
+		{text: "script", err: true},
+		{text: "=value", err: true},
+	}
+	for _, test := range tests {
+		name, data, err := readFileFlag(test.text)
+		if test.err != (err != nil) {
+			t.Errorf("Want error %v parsing %q, got %v", test.err, test.text, err)
+			continue
+		}
+		if test.err {
+			continue
+		}
+		if name != test.name || string(data) != test.data {
+			t.Errorf("Want file %q with %q, got %q with %q", test.name, test.data, name, data)
+		}
+	}
+}
+
+func TestSelectSteps(t *testing.T) {
+	spec := testOverrideSpec()
+	tests := []struct {
+		steps []string
+		want  []string
+		err   bool
+	}{
+		{want: []string{"build", "test"}},
+		{steps: []string{"test"}, want: []string{"test"}},
+		{steps: []string{"test", "build"}, want: []string{"test", "build"}},
+		{steps: []string{"deploy"}, err: true},
+	}
+	for _, test := range tests {
+		o := &overrideFlags{steps: test.steps}
+		steps, err := o.selectSteps(spec)
+		if test.err != (err != nil) {
+			t.Errorf("Want error %v selecting %v, got %v", test.err, test.steps, err)
+			continue
+		}
+		var got []string
+		for _, step := range steps {
+			got = append(got, step.Metadata.Name)
+		}
+		if diff := cmp.Diff(test.want, got); diff != "" {
+			t.Errorf("Unexpected steps selecting %v", test.steps)
+			t.Log(diff)
+		}
+	}
+}
+
+func TestApply(t *testing.T) {
+	spec := testOverrideSpec()
+	o := &overrideFlags{
+		envs:    []string{"GOOS=linux", "CGO_ENABLED=1"},
+		secrets: []string{"TOKEN=flag", "PASSWORD=secret"},
+		files:   []string{"netrc=machine example.com", "script=echo hi"},
+		steps:   []string{"test"},
+	}
+	if err := o.apply(spec); err != nil {
+		t.Fatal(err)
+	}
+	build, test := spec.Steps[0], spec.Steps[1]
+
+	// environment variables are only applied to the
+	// selected steps, and override the step values.
+	if got, want := test.Envs["CGO_ENABLED"], "1"; got != want {
+		t.Errorf("Want env %q, got %q", want, got)
+	}
+	if got, want := test.Envs["GOOS"], "linux"; got != want {
+		t.Errorf("Want env %q, got %q", want, got)
+	}
+	if got, want := build.Envs["CGO_ENABLED"], "0"; got != want {
+		t.Errorf("Want env unchanged in unselected step, got %q", got)
+	}
+	if _, ok := build.Envs["GOOS"]; ok {
+		t.Errorf("Want env not applied to unselected step")
+	}
+
+	// secrets are added to the specification, replacing
+	// existing secret values, and exposed to the selected
+	// steps only.
+	if secret, _ := engine.LookupSecret(spec, &engine.SecretVar{Name: "TOKEN"}); secret.Data != "flag" {
+		t.Errorf("Want secret value replaced, got %q", secret.Data)
+	}
+	if secret, ok := engine.LookupSecret(spec, &engine.SecretVar{Name: "PASSWORD"}); !ok || secret.Data != "secret" {
+		t.Errorf("Want secret added to the specification")
+	}
+	if got, want := len(test.Secrets), 2; got != want {
+		t.Errorf("Want %d step secrets, got %d", want, got)
+	}
+	if got, want := len(build.Secrets), 0; got != want {
+		t.Errorf("Want secrets not applied to unselected step")
+	}
+
+	// files mounted by unselected steps are copied, and
+	// the selected steps mount the copy.
+	if file, _ := engine.LookupFile(spec, "netrc"); string(file.Data) != "machine localhost" {
+		t.Errorf("Want file unchanged for unselected step, got %q", file.Data)
+	}
+	if got, want := build.Files[0].Name, "netrc"; got != want {
+		t.Errorf("Want unselected step file mount %q, got %q", want, got)
+	}
+	if got, want := test.Files[0].Name, "netrc-override"; got != want {
+		t.Errorf("Want selected step file mount %q, got %q", want, got)
+	}
+	if file, ok := engine.LookupFile(spec, "netrc-override"); !ok || string(file.Data) != "machine example.com" {
+		t.Errorf("Want file copy for selected step")
+	} else if got, want := file.Metadata.UID, "uid-netrc-override"; got != want {
+		t.Errorf("Want file copy uid %q, got %q", want, got)
+	}
+
+	// files only mounted by selected steps are replaced.
+	if file, _ := engine.LookupFile(spec, "script"); string(file.Data) != "echo hi" {
+		t.Errorf("Want file replaced, got %q", file.Data)
+	}
+}
+
+func TestApplyAllSteps(t *testing.T) {
+	spec := testOverrideSpec()
+	o := &overrideFlags{
+		envs:  []string{"GOOS=linux"},
+		files: []string{"netrc=machine example.com", "config=debug"},
+	}
+	if err := o.apply(spec); err != nil {
+		t.Fatal(err)
+	}
+	for _, step := range spec.Steps {
+		if got, want := step.Envs["GOOS"], "linux"; got != want {
+			t.Errorf("Want env %q in step %s, got %q", want, step.Metadata.Name, got)
+		}
+		if got, want := step.Files[0].Name, "netrc"; got != want {
+			t.Errorf("Want file mount %q in step %s, got %q", want, step.Metadata.Name, got)
+		}
+	}
+	if file, _ := engine.LookupFile(spec, "netrc"); string(file.Data) != "machine example.com" {
+		t.Errorf("Want file replaced, got %q", file.Data)
+	}
+	if _, ok := engine.LookupFile(spec, "config"); !ok {
+		t.Errorf("Want unknown file added")
+	}
+}
+
+func TestApplyEmptySecret(t *testing.T) {
+	spec := testOverrideSpec()
+	o := &overrideFlags{secrets: []string{"TOKEN="}}
+	if err := o.apply(spec); err == nil {
+		t.Errorf("Want error applying an empty secret")
+	}
+}
+
+// helper function returns a specification used to test
+// overrides.
+func testOverrideSpec() *engine.Spec {
+	return &engine.Spec{
+		Secrets: []*engine.Secret{
+			{Metadata: engine.Metadata{Name: "TOKEN"}, Data: "spec"},
+		},
+		Files: []*engine.File{
+			{Metadata: engine.Metadata{UID: "uid-netrc", Name: "netrc"}, Data: []byte("machine localhost")},
+			{Metadata: engine.Metadata{UID: "uid-script", Name: "script"}, Data: []byte("echo hello")},
+		},
+		Steps: []*engine.Step{
+			{
+				Metadata: engine.Metadata{Name: "build"},
+				Envs:     map[string]string{"CGO_ENABLED": "0"},
+				Files:    []*engine.FileMount{{Name: "netrc", Path: "/root/.netrc"}},
+			},
+			{
+				Metadata: engine.Metadata{Name: "test"},
+				Envs:     map[string]string{"CGO_ENABLED": "0"},
+				Files: []*engine.FileMount{
+					{Name: "netrc", Path: "/root/.netrc"},
+					{Name: "script", Path: "/bin/test.sh"},
+				},
+			},
+		},
+	}
+}
+
+// helper function writes the data to a temporary file, and
+// returns the file path.
+func writeTempFile(t *testing.T, data string) string {
+	dir, err := ioutil.TempDir("", "drone-runtime")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "file")
+	if err := ioutil.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
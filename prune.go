@@ -0,0 +1,59 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Drone Non-Commercial License
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/drone/drone-runtime/engine"
+	"github.com/drone/drone-runtime/engine/docker"
+)
+
+const pruneUsage = `Usage: drone-runtime prune [OPTION]... [SOURCE]
+
+Removes leftover docker containers, volumes and networks
+that match the pipeline labels.
+
+Options:
+      --age         removes leftover resources older than the
+                    specified duration (default 1h)
+  -h, --help        display this help and exit`
+
+func pruneCmd(args []string) int {
+	fs := newFlagSet("prune", pruneUsage)
+	age := fs.Duration("age", time.Hour, "")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+
+	spec, code, err := readSpec(fs.Args())
+	if err != nil {
+		return failWith(err, code)
+	}
+	return prune(spec, *age)
+}
+
+// helper function removes leftover docker resources that
+// match the pipeline labels, and are older than age.
+func prune(spec *engine.Spec, age time.Duration) int {
+	report, err := docker.Prune(context.Background(), spec.Metadata.Labels, age)
+	if report != nil {
+		for _, id := range report.Containers {
+			fmt.Printf("removed container %s\n", id)
+		}
+		for _, id := range report.Volumes {
+			fmt.Printf("removed volume %s\n", id)
+		}
+		for _, id := range report.Networks {
+			fmt.Printf("removed network %s\n", id)
+		}
+	}
+	if err != nil {
+		return fail(err)
+	}
+	return exitOK
+}
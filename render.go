@@ -0,0 +1,87 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Drone Non-Commercial License
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/drone/drone-runtime/engine"
+	"github.com/drone/drone-runtime/engine/docker"
+	"github.com/drone/drone-runtime/engine/kube"
+)
+
+const renderUsage = `Usage: drone-runtime render [OPTION]... [SOURCE]
+
+Writes the objects created for the pipeline to stdout,
+without executing the pipeline.
+
+Options:` + configUsage + `
+      --engine      sets the engine, kube or docker
+                    (default kube)
+      --format      sets the kubernetes output format, yaml
+                    or json (default yaml)
+      --step        writes the kubernetes objects for the
+                    named step
+  -h, --help        display this help and exit
+` + overrideUsage + "\n" + kubeUsage
+
+func renderCmd(args []string) int {
+	fs := newFlagSet("render", renderUsage)
+
+	var (
+		config    configFlag
+		overrides overrideFlags
+		kubeopts  kubeFlags
+		printopts kube.PrintOptions
+		name      string
+	)
+	config.register(fs)
+	kubeopts.register(fs)
+	overrides.register(fs)
+	fs.StringVar(&name, "engine", "kube", "")
+	fs.StringVar(&printopts.Format, "format", kube.FormatYAML, "")
+	fs.StringVar(&printopts.Step, "step", "", "")
+
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+
+	spec, code, err := readSpec(fs.Args())
+	if err != nil {
+		return failWith(err, code)
+	}
+	if err := config.apply(spec); err != nil {
+		return fail(err)
+	}
+	if err := overrides.apply(spec); err != nil {
+		return failWith(err, exitUsage)
+	}
+
+	return render(spec, name, printopts, &kubeopts)
+}
+
+// helper function writes the objects created for the
+// pipeline by the named engine to stdout.
+func render(spec *engine.Spec, name string, printopts kube.PrintOptions, kubeopts *kubeFlags) int {
+	var err error
+	switch name {
+	case "kube":
+		var opts []kube.Option
+		opts, err = kubeopts.options()
+		if err == nil {
+			err = kube.Print(os.Stdout, spec, printopts, opts...)
+		}
+	case "docker":
+		err = docker.Print(os.Stdout, spec)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown engine %q\n", name)
+		return exitUsage
+	}
+	if err != nil {
+		return fail(err)
+	}
+	return exitOK
+}
@@ -0,0 +1,348 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Drone Non-Commercial License
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/drone/drone-runtime/engine"
+	"github.com/drone/drone-runtime/engine/docker"
+	"github.com/drone/drone-runtime/engine/kube"
+	"github.com/drone/drone-runtime/runtime"
+	"github.com/drone/drone-runtime/runtime/logsink"
+	"github.com/drone/drone-runtime/runtime/term"
+	"github.com/drone/signal"
+)
+
+const runUsage = `Usage: drone-runtime [run] [OPTION]... [SOURCE]
+
+Executes the pipeline using the docker engine, or the
+kubernetes engine if a kubernetes configuration is provided.
+
+Options:` + configUsage + `
+      --timeout     sets an execution timeout (default 1h)
+      --exit-code   exits with the exit code of the failing
+                    step, instead of exit code 1. Step exit
+                    codes reserved by the command exit with
+                    code 1
+      --timestamps  prefixes log lines with the elapsed or
+                    absolute time, none, elapsed or absolute
+                    (default none)
+      --strip-ansi  removes ansi escape codes from log lines
+      --wrap        wraps log lines longer than the width
+      --log-dir     writes the logs of each step, the
+                    combined logs, and an index of the steps
+                    to the directory
+      --debug       pauses the pipeline when a step fails, to
+                    open a shell in a copy of the step
+                    container, or re-run the step. The
+                    timeout includes the time spent debugging
+      --debug-shell sets the shell used in debug mode
+                    (default /bin/sh)
+      --dry-run     prints the execution plan, including the
+                    parallel waves, images, registry
+                    credentials, volumes and networks,
+                    without executing the pipeline
+      --watch       re-runs the pipeline when the pipeline
+                    specification, host volumes, or step
+                    inputs change
+      --watch-interval
+                    sets the interval at which changes are
+                    detected (default 1s)
+      --watch-exclude
+                    excludes the path from the watched paths,
+                    for example, paths written by the steps
+                    (repeatable)
+      --kube-config loads a kubernetes config file
+      --kube-url    sets a kubernetes endpoint
+      --kube-in-cluster
+                    uses the kubernetes service account of
+                    the pod in which the runtime is running
+  -h, --help        display this help and exit
+` + overrideUsage + "\n" + debugUsage + "\n" + kubeUsage
+
+func runCmd(args []string) int {
+	fs := newFlagSet("run", runUsage)
+
+	var (
+		config     configFlag
+		overrides  overrideFlags
+		kubeopts   kubeFlags
+		kubeConfig string
+		kubeURL    string
+		inCluster  bool
+		timeout    time.Duration
+		exitCode   bool
+		timestamps string
+		stripANSI  bool
+		wrap       int
+		logDir     string
+		debug      bool
+		debugShell string
+
+		watch         bool
+		watchInterval time.Duration
+		watchExclude  stringSlice
+		dryRun        bool
+
+		// deprecated flags, replaced by the render and
+		// prune commands.
+		kubeDebug bool
+		pruneOnly bool
+		pruneAge  time.Duration
+	)
+	config.register(fs)
+	kubeopts.register(fs)
+	overrides.register(fs)
+	fs.StringVar(&kubeConfig, "kube-config", "", "")
+	fs.StringVar(&kubeURL, "kube-url", "", "")
+	fs.BoolVar(&inCluster, "kube-in-cluster", false, "")
+	fs.DurationVar(&timeout, "timeout", time.Hour, "")
+	fs.BoolVar(&exitCode, "exit-code", false, "")
+	fs.StringVar(&timestamps, "timestamps", "none", "")
+	fs.BoolVar(&stripANSI, "strip-ansi", false, "")
+	fs.IntVar(&wrap, "wrap", 0, "")
+	fs.StringVar(&logDir, "log-dir", "", "")
+	fs.BoolVar(&debug, "debug", false, "")
+	fs.StringVar(&debugShell, "debug-shell", "/bin/sh", "")
+	fs.BoolVar(&dryRun, "dry-run", false, "")
+	fs.BoolVar(&watch, "watch", false, "")
+	fs.DurationVar(&watchInterval, "watch-interval", time.Second, "")
+	fs.Var(&watchExclude, "watch-exclude", "")
+	fs.BoolVar(&kubeDebug, "kube-debug", false, "")
+	fs.BoolVar(&pruneOnly, "prune", false, "")
+	fs.DurationVar(&pruneAge, "prune-age", time.Hour, "")
+
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	timestamp, err := term.ParseTimestamp(timestamps)
+	if err != nil {
+		return failWith(err, exitUsage)
+	}
+	lineopts := []term.Option{
+		term.WithTimestamp(timestamp),
+		term.WithWrap(wrap),
+	}
+	if stripANSI {
+		lineopts = append(lineopts, term.WithStripANSI())
+	}
+
+	if (debug || watch) && (fs.NArg() == 0 || fs.Arg(0) == "-") {
+		return failWith(errStdinSource, exitUsage)
+	}
+
+	// helper function loads and validates the pipeline
+	// specification.
+	load := func() (*engine.Spec, int, error) {
+		spec, code, err := readSpec(fs.Args())
+		if err != nil {
+			return nil, code, err
+		}
+		if err := config.apply(spec); err != nil {
+			return nil, exitFailure, err
+		}
+		if err := overrides.apply(spec); err != nil {
+			return nil, exitUsage, err
+		}
+		if err := engine.Validate(spec); err != nil {
+			return nil, exitInvalid, err
+		}
+		return spec, exitOK, nil
+	}
+
+	spec, code, err := load()
+	if err != nil {
+		return failWith(err, code)
+	}
+	if kubeDebug {
+		fmt.Fprintln(os.Stderr, "warning: --kube-debug is deprecated, use the render command")
+		return render(spec, "kube", kube.PrintOptions{Format: kube.FormatYAML}, &kubeopts)
+	}
+	if pruneOnly {
+		fmt.Fprintln(os.Stderr, "warning: --prune is deprecated, use the prune command")
+		return prune(spec, pruneAge)
+	}
+	opts, err := kubeopts.options()
+	if err != nil {
+		return failWith(err, exitUsage)
+	}
+
+	var eng engine.Engine
+	switch {
+	case inCluster:
+		eng, err = kube.NewInCluster(opts...)
+	case kubeConfig != "":
+		eng, err = kube.NewFile(kubeURL, kubeConfig, kubeopts.node, opts...)
+	default:
+		eng, err = docker.NewEnv()
+	}
+	if err != nil {
+		return failWith(err, exitEngine)
+	}
+
+	// the engine is not called in dry run mode, except to
+	// describe the engine resources in the execution plan.
+	if dryRun {
+		r := runtime.New(
+			runtime.WithEngine(eng),
+			runtime.WithConfig(spec),
+			runtime.WithDryRun(os.Stdout),
+		)
+		if err := r.Run(context.Background()); err != nil {
+			return fail(err)
+		}
+		return exitOK
+	}
+
+	r := &runner{
+		engine:   eng,
+		timeout:  timeout,
+		exitCode: exitCode,
+		lineopts: lineopts,
+		logDir:   logDir,
+	}
+	if debug {
+		r.debugger = &debugger{
+			engine:  eng,
+			shell:   debugShell,
+			console: newConsole(os.Stdin),
+			out:     os.Stderr,
+		}
+	}
+
+	ctx := signal.WithContext(context.Background())
+	if watch {
+		w := &watcher{
+			source:   fs.Arg(0),
+			interval: watchInterval,
+			exclude:  watchExclude,
+			load:     load,
+			runner:   r,
+		}
+		return w.watch(ctx, spec)
+	}
+	return r.run(ctx, spec)
+}
+
+// runner executes the pipeline.
+type runner struct {
+	engine   engine.Engine
+	timeout  time.Duration
+	exitCode bool
+	lineopts []term.Option
+	logDir   string
+	debugger *debugger
+}
+
+// run executes the pipeline, writes the pipeline summary,
+// and returns the exit code.
+func (r *runner) run(ctx context.Context, spec *engine.Spec) int {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	// the terminal renderer writes the step status and a
+	// summary to stdout, in place of the summary table.
+	var renderer *term.Renderer
+	steps := newSummary()
+	hooks := &runtime.Hook{}
+	hooks.BeforeEach = steps.beforeEach
+	hooks.AfterEach = steps.afterEach
+	hooks.GotLine = term.WriteLineFormat(os.Stdout, r.lineopts...)
+	if tty {
+		renderer = term.NewRenderer(os.Stdout, spec, r.lineopts...)
+		hooks = renderer.Hook()
+	}
+
+	var sink *logsink.Sink
+	if r.logDir != "" {
+		var err error
+		sink, err = logsink.New(r.logDir, spec)
+		if err != nil {
+			return fail(err)
+		}
+		hooks = runtime.MultiHook(hooks, sink.Hook())
+	}
+
+	// resources that could not be removed do not change
+	// the pipeline result, and are reported as a warning.
+	hooks = runtime.MultiHook(hooks, &runtime.Hook{
+		AfterDestroy: func(state *runtime.State, err error) {
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "warning: %s\n", err)
+			}
+		},
+	})
+
+	runopts := []runtime.Option{
+		runtime.WithEngine(r.engine),
+		runtime.WithConfig(spec),
+		runtime.WithHooks(hooks),
+	}
+	if r.debugger != nil {
+		r.debugger.spec = spec
+		r.debugger.cancel = cancel
+		runopts = append(runopts, runtime.WithDebug(r.debugger.debug))
+	}
+
+	err := runtime.New(runopts...).Run(ctx)
+	code := toExitCode(ctx, err, r.exitCode)
+	if code != exitOK {
+		fmt.Fprintln(os.Stderr, err)
+	}
+	if sink != nil {
+		if err := sink.Close(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+	}
+	if renderer != nil {
+		renderer.WriteSummary()
+	} else {
+		fmt.Fprintln(os.Stderr)
+		steps.write(os.Stderr, spec)
+	}
+	return code
+}
+
+// reservedCodes defines the exit codes that the command
+// line utility reserves for errors other than step
+// failures.
+var reservedCodes = map[int]bool{
+	exitUsage:     true,
+	exitInvalid:   true,
+	exitEngine:    true,
+	exitTimeout:   true,
+	exitCancel:    true,
+	exitOOMKilled: true,
+}
+
+// helper function returns the exit code for the pipeline
+// error. If propagate is true, the exit code of the failing
+// step is returned instead of the generic failure code,
+// unless the exit code is reserved.
+func toExitCode(ctx context.Context, err error, propagate bool) int {
+	switch {
+	case err == nil, err == runtime.ErrInterrupt:
+		return exitOK
+	case ctx.Err() == context.DeadlineExceeded:
+		return exitTimeout
+	case ctx.Err() != nil, err == runtime.ErrCancel:
+		return exitCancel
+	}
+	switch err := err.(type) {
+	case *runtime.ExitError:
+		if propagate && err.Code > 0 && err.Code < 256 && !reservedCodes[err.Code] {
+			return err.Code
+		}
+		return exitFailure
+	case *runtime.OomError:
+		return exitOOMKilled
+	default:
+		return exitEngine
+	}
+}
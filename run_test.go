@@ -0,0 +1,71 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Drone Non-Commercial License
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/drone/drone-runtime/runtime"
+)
+
+func TestToExitCode(t *testing.T) {
+	timeout, cancel := context.WithTimeout(context.Background(), 0)
+	defer cancel()
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		ctx       context.Context
+		err       error
+		propagate bool
+		want      int
+	}{
+		{context.Background(), nil, false, exitOK},
+		{context.Background(), runtime.ErrInterrupt, false, exitOK},
+		{timeout, errors.New("timeout"), false, exitTimeout},
+		{cancelled, errors.New("cancelled"), false, exitCancel},
+		{context.Background(), runtime.ErrCancel, false, exitCancel},
+		{context.Background(), &runtime.OomError{Code: 137}, true, exitOOMKilled},
+		{context.Background(), errors.New("connection refused"), true, exitEngine},
+		{context.Background(), &runtime.ExitError{Code: 42}, false, exitFailure},
+		{context.Background(), &runtime.ExitError{Code: 42}, true, 42},
+		{context.Background(), &runtime.ExitError{Code: 1}, true, 1},
+		{context.Background(), &runtime.ExitError{Code: 256}, true, exitFailure},
+		{context.Background(), &runtime.ExitError{Code: -1}, true, exitFailure},
+		// step exit codes that collide with the reserved
+		// exit codes are returned as failures.
+		{context.Background(), &runtime.ExitError{Code: 2}, true, exitFailure},
+		{context.Background(), &runtime.ExitError{Code: 3}, true, exitFailure},
+		{context.Background(), &runtime.ExitError{Code: 4}, true, exitFailure},
+		{context.Background(), &runtime.ExitError{Code: 5}, true, exitFailure},
+		{context.Background(), &runtime.ExitError{Code: 130}, true, exitFailure},
+		{context.Background(), &runtime.ExitError{Code: 137}, true, exitFailure},
+	}
+	for i, test := range tests {
+		if got := toExitCode(test.ctx, test.err, test.propagate); got != test.want {
+			t.Errorf("Test %d: want exit code %d, got %d", i, test.want, got)
+		}
+	}
+}
+
+func TestReadSpec(t *testing.T) {
+	tests := []struct {
+		args []string
+		want int
+	}{
+		{[]string{"samples/1_hello_world.json"}, exitOK},
+		{[]string{"samples/1_hello_world.json", "extra"}, exitUsage},
+		{[]string{"testdata/does_not_exist.json"}, exitFailure},
+		{[]string{"README.md"}, exitInvalid},
+	}
+	for _, test := range tests {
+		_, code, _ := readSpec(test.args)
+		if code != test.want {
+			t.Errorf("Want exit code %d reading %v, got %d", test.want, test.args, code)
+		}
+	}
+}
@@ -23,6 +23,12 @@ type Hook struct {
 	// BeforeEach is called before each step is executed.
 	BeforeEach func(*State) error
 
+	// AfterCreate is called after each step is created,
+	// which includes pulling the step image, and before
+	// the step is started. If the engine resolves image
+	// digests, the state includes the image digest.
+	AfterCreate func(*State) error
+
 	// After is called after all steps are executed.
 	After func(*State) error
 
@@ -34,4 +40,105 @@ type Hook struct {
 
 	// GotLogs is called when the logs are completed.
 	GotLogs func(*State, []*Line) error
+
+	// AfterDestroy is called after the pipeline environment
+	// is destroyed, with the error returned by the engine,
+	// if any. The error does not change the pipeline result.
+	AfterDestroy func(*State, error)
+}
+
+// MultiHook returns a Hook that calls the hooks in order.
+// If a hook returns an error, the remaining hooks are not
+// called and the error is returned.
+func MultiHook(hooks ...*Hook) *Hook {
+	var (
+		before      []func(*State) error
+		beforeEach  []func(*State) error
+		afterCreate []func(*State) error
+		after       []func(*State) error
+		afterEach   []func(*State) error
+		gotLine     []func(*State, *Line) error
+		gotLogs     []func(*State, []*Line) error
+		destroy     []func(*State, error)
+	)
+	for _, hook := range hooks {
+		if hook == nil {
+			continue
+		}
+		if hook.Before != nil {
+			before = append(before, hook.Before)
+		}
+		if hook.BeforeEach != nil {
+			beforeEach = append(beforeEach, hook.BeforeEach)
+		}
+		if hook.AfterCreate != nil {
+			afterCreate = append(afterCreate, hook.AfterCreate)
+		}
+		if hook.After != nil {
+			after = append(after, hook.After)
+		}
+		if hook.AfterEach != nil {
+			afterEach = append(afterEach, hook.AfterEach)
+		}
+		if hook.GotLine != nil {
+			gotLine = append(gotLine, hook.GotLine)
+		}
+		if hook.GotLogs != nil {
+			gotLogs = append(gotLogs, hook.GotLogs)
+		}
+		if hook.AfterDestroy != nil {
+			destroy = append(destroy, hook.AfterDestroy)
+		}
+	}
+	hook := &Hook{
+		Before:      chainState(before),
+		BeforeEach:  chainState(beforeEach),
+		AfterCreate: chainState(afterCreate),
+		After:       chainState(after),
+		AfterEach:   chainState(afterEach),
+	}
+	if len(gotLine) != 0 {
+		hook.GotLine = func(state *State, line *Line) error {
+			for _, fn := range gotLine {
+				if err := fn(state, line); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+	if len(destroy) != 0 {
+		hook.AfterDestroy = func(state *State, err error) {
+			for _, fn := range destroy {
+				fn(state, err)
+			}
+		}
+	}
+	if len(gotLogs) != 0 {
+		hook.GotLogs = func(state *State, lines []*Line) error {
+			for _, fn := range gotLogs {
+				if err := fn(state, lines); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+	return hook
+}
+
+// helper function returns a function that calls the
+// functions in order, or nil if the list is empty.
+func chainState(funcs []func(*State) error) func(*State) error {
+	if len(funcs) == 0 {
+		return nil
+	}
+	return func(state *State) error {
+		for _, fn := range funcs {
+			if err := fn(state); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
 }
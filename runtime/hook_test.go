@@ -0,0 +1,69 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Drone Non-Commercial License
+// that can be found in the LICENSE file.
+
+package runtime
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestMultiHook(t *testing.T) {
+	var calls []string
+	record := func(name string) func(*State) error {
+		return func(*State) error {
+			calls = append(calls, name)
+			return nil
+		}
+	}
+
+	hook := MultiHook(
+		&Hook{
+			BeforeEach: record("a.BeforeEach"),
+			GotLine: func(*State, *Line) error {
+				calls = append(calls, "a.GotLine")
+				return nil
+			},
+		},
+		nil,
+		&Hook{
+			BeforeEach: record("b.BeforeEach"),
+			AfterEach:  record("b.AfterEach"),
+			AfterDestroy: func(*State, error) {
+				calls = append(calls, "b.AfterDestroy")
+			},
+		},
+	)
+	if hook.Before != nil || hook.After != nil || hook.GotLogs != nil {
+		t.Errorf("Want nil hooks when no hooks are defined")
+	}
+
+	hook.BeforeEach(nil)
+	hook.GotLine(nil, nil)
+	hook.AfterEach(nil)
+	hook.AfterDestroy(nil, nil)
+
+	want := []string{"a.BeforeEach", "b.BeforeEach", "a.GotLine", "b.AfterEach", "b.AfterDestroy"}
+	if diff := cmp.Diff(want, calls); diff != "" {
+		t.Errorf("Unexpected hook calls")
+		t.Log(diff)
+	}
+}
+
+func TestMultiHookError(t *testing.T) {
+	failure := errors.New("hook failed")
+	called := false
+	hook := MultiHook(
+		&Hook{Before: func(*State) error { return failure }},
+		&Hook{Before: func(*State) error { called = true; return nil }},
+	)
+	if err := hook.Before(nil); err != failure {
+		t.Errorf("Want hook error returned, got %v", err)
+	}
+	if called {
+		t.Errorf("Want remaining hooks skipped after error")
+	}
+}
@@ -26,6 +26,14 @@ type Line struct {
 	Number    int    `json:"pos,omitempty"`
 	Message   string `json:"out,omitempty"`
 	Timestamp int64  `json:"time,omitempty"`
+
+	// Elapsed is the time elapsed since the step started
+	// writing logs, in milliseconds.
+	Elapsed int64 `json:"elapsed,omitempty"`
+
+	// Created is the time the line was written, in unix
+	// milliseconds.
+	Created int64 `json:"created,omitempty"`
 }
 
 type lineWriter struct {
@@ -73,11 +81,14 @@ func (w *lineWriter) Write(p []byte) (n int, err error) {
 		parts = strings.SplitAfter(out, "\n")
 	}
 
+	now := time.Now().UTC()
 	for _, part := range parts {
 		line := &Line{
 			Number:    w.num,
 			Message:   part,
-			Timestamp: int64(time.Since(w.now).Seconds()),
+			Timestamp: int64(now.Sub(w.now).Seconds()),
+			Elapsed:   int64(now.Sub(w.now) / time.Millisecond),
+			Created:   now.UnixNano() / int64(time.Millisecond),
 		}
 
 		if w.state.hook.GotLine != nil {
@@ -96,7 +107,9 @@ func (w *lineWriter) Write(p []byte) (n int, err error) {
 		w.lines = append(w.lines, &Line{
 			Number:    w.num,
 			Message:   "warning: maximum output exceeded",
-			Timestamp: int64(time.Since(w.now).Seconds()),
+			Timestamp: int64(now.Sub(w.now).Seconds()),
+			Elapsed:   int64(now.Sub(w.now) / time.Millisecond),
+			Created:   now.UnixNano() / int64(time.Millisecond),
 		})
 	}
 
@@ -106,6 +119,11 @@ func (w *lineWriter) Write(p []byte) (n int, err error) {
 func newReplacer(secrets []*engine.Secret) *strings.Replacer {
 	var oldnew []string
 	for _, secret := range secrets {
+		// an empty secret would match between every
+		// character of the line.
+		if secret.Data == "" {
+			continue
+		}
 		oldnew = append(oldnew, secret.Data)
 		oldnew = append(oldnew, "********")
 	}
@@ -6,6 +6,7 @@ package runtime
 
 import (
 	"testing"
+	"time"
 
 	"github.com/drone/drone-runtime/engine"
 )
@@ -93,6 +94,36 @@ func TestLineWriterMulti(t *testing.T) {
 	}
 }
 
+func TestLineWriterTimestamp(t *testing.T) {
+	line := &Line{}
+	hook := &Hook{}
+	state := &State{}
+
+	hook.GotLine = func(_ *State, l *Line) error {
+		line = l
+		return nil
+	}
+	state.hook = hook
+	state.Step = &engine.Step{}
+	state.config = &engine.Spec{}
+
+	before := time.Now()
+	lw := newWriter(state)
+	lw.now = lw.now.Add(-1500 * time.Millisecond)
+	lw.Write([]byte("foo\n"))
+	after := time.Now()
+
+	if got, want := line.Timestamp, int64(1); got != want {
+		t.Errorf("Got timestamp %d, want %d", got, want)
+	}
+	if line.Elapsed < 1500 || line.Elapsed > 1500+after.Sub(before).Nanoseconds()/1e6+1 {
+		t.Errorf("Got elapsed %dms, want 1500ms", line.Elapsed)
+	}
+	if line.Created < before.UnixNano()/1e6 || line.Created > after.UnixNano()/1e6 {
+		t.Errorf("Got created %d, want time the line was written", line.Created)
+	}
+}
+
 func TestLineReplacer(t *testing.T) {
 	secrets := []*engine.Secret{
 		{Metadata: engine.Metadata{Name: "foo"}, Data: "bar"},
@@ -113,4 +144,15 @@ func TestLineReplacer(t *testing.T) {
 	if replacer != nil {
 		t.Errorf("Expect nil replacer when no masked secrets")
 	}
+
+	// ensure empty secrets are ignored, since an empty
+	// string matches between every character.
+
+	secrets = []*engine.Secret{
+		{Metadata: engine.Metadata{Name: "foo"}, Data: ""},
+	}
+	replacer = newReplacer(secrets)
+	if replacer != nil {
+		t.Errorf("Expect nil replacer when secrets are empty")
+	}
 }
@@ -0,0 +1,274 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Drone Non-Commercial License
+// that can be found in the LICENSE file.
+
+// Package logsink writes pipeline logs to a directory.
+package logsink
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/drone/drone-runtime/engine"
+	"github.com/drone/drone-runtime/runtime"
+)
+
+const (
+	// CombinedFile is the name of the file that contains
+	// the logs of all steps.
+	CombinedFile = "pipeline.log"
+
+	// IndexFile is the name of the file that contains the
+	// step index in json format.
+	IndexFile = "index.json"
+)
+
+// Step status written to the index.
+const (
+	StatusSuccess    = engine.StatusSuccess
+	StatusFailure    = engine.StatusFailure
+	StatusSkipped    = engine.StatusSkipped
+	StatusDetached   = engine.StatusDetached
+	StatusIncomplete = engine.StatusIncomplete
+)
+
+// invalid matches characters that are not allowed in
+// log file names.
+var invalid = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+type (
+	// Index describes the pipeline steps and their logs.
+	Index struct {
+		Name  string       `json:"name,omitempty"`
+		Steps []*IndexStep `json:"steps"`
+	}
+
+	// IndexStep describes a pipeline step and its logs.
+	IndexStep struct {
+		Name      string   `json:"name"`
+		Status    string   `json:"status"`
+		ExitCode  int      `json:"exit_code"`
+		OOMKilled bool     `json:"oom_killed,omitempty"`
+		DependsOn []string `json:"depends_on,omitempty"`
+		Started   int64    `json:"started,omitempty"`
+		Finished  int64    `json:"finished,omitempty"`
+		Duration  int64    `json:"duration,omitempty"`
+		Log       string   `json:"log,omitempty"`
+	}
+)
+
+// stepLog tracks the log file of a pipeline step.
+type stepLog struct {
+	step     *engine.Step
+	file     string
+	w        *os.File
+	started  time.Time
+	finished time.Time
+	state    *engine.State
+}
+
+// Sink writes the logs of each pipeline step to a file in
+// the directory, named after the step, and the logs of all
+// steps to a combined log file. When the sink is closed, an
+// index of the steps, with the exit code and duration of
+// each step, is written to the directory.
+type Sink struct {
+	mu       sync.Mutex
+	dir      string
+	spec     *engine.Spec
+	steps    []*stepLog
+	combined *os.File
+	now      func() time.Time
+}
+
+// New returns a new Sink that writes the pipeline logs to
+// the directory. The directory is created if it does not
+// exist.
+func New(dir string, spec *engine.Spec) (*Sink, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	combined, err := os.Create(filepath.Join(dir, CombinedFile))
+	if err != nil {
+		return nil, err
+	}
+	s := &Sink{
+		dir:      dir,
+		spec:     spec,
+		combined: combined,
+		now:      time.Now,
+	}
+	used := map[string]bool{CombinedFile: true}
+	for _, step := range spec.Steps {
+		s.steps = append(s.steps, &stepLog{
+			step: step,
+			file: toFileName(step.Metadata.Name, used),
+		})
+	}
+	return s, nil
+}
+
+// Hook returns the runtime hooks that write the pipeline
+// logs.
+func (s *Sink) Hook() *runtime.Hook {
+	return &runtime.Hook{
+		BeforeEach: s.beforeEach,
+		AfterEach:  s.afterEach,
+		GotLine:    s.gotLine,
+	}
+}
+
+func (s *Sink) beforeEach(state *runtime.State) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	l := s.lookup(state.Step)
+	if l == nil {
+		return nil
+	}
+	w, err := os.Create(filepath.Join(s.dir, l.file))
+	if err != nil {
+		return err
+	}
+	l.w = w
+	l.started = s.now()
+	return nil
+}
+
+func (s *Sink) afterEach(state *runtime.State) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if l := s.lookup(state.Step); l != nil {
+		l.state = state.State
+		l.finished = s.now()
+	}
+	return nil
+}
+
+func (s *Sink) gotLine(state *runtime.State, line *runtime.Line) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	l := s.lookup(state.Step)
+	if l == nil || l.w == nil {
+		return nil
+	}
+	message := line.Message
+	if !strings.HasSuffix(message, "\n") {
+		message = message + "\n"
+	}
+	if _, err := l.w.WriteString(message); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(s.combined, "[%s:%d] %s", l.step.Metadata.Name, line.Number, message)
+	return err
+}
+
+// Close closes the log files and writes the index.
+func (s *Sink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var errs []string
+	for _, l := range s.steps {
+		if l.w != nil {
+			if err := l.w.Close(); err != nil {
+				errs = append(errs, err.Error())
+			}
+		}
+	}
+	if err := s.combined.Close(); err != nil {
+		errs = append(errs, err.Error())
+	}
+	data, err := json.MarshalIndent(s.index(), "", "  ")
+	if err == nil {
+		err = ioutil.WriteFile(filepath.Join(s.dir, IndexFile), data, 0644)
+	}
+	if err != nil {
+		errs = append(errs, err.Error())
+	}
+	if len(errs) != 0 {
+		return fmt.Errorf("log directory: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// helper function returns the step index.
+func (s *Sink) index() *Index {
+	index := &Index{
+		Name:  s.spec.Metadata.Name,
+		Steps: []*IndexStep{},
+	}
+	for _, l := range s.steps {
+		step := &IndexStep{
+			Name:      l.step.Metadata.Name,
+			Status:    toStatus(l),
+			DependsOn: l.step.DependsOn,
+		}
+		if !l.started.IsZero() {
+			step.Log = l.file
+			step.Started = toMillis(l.started)
+		}
+		if l.state != nil {
+			step.ExitCode = l.state.ExitCode
+			step.OOMKilled = l.state.OOMKilled
+			step.Finished = toMillis(l.finished)
+			step.Duration = int64(l.finished.Sub(l.started) / time.Millisecond)
+		}
+		index.Steps = append(index.Steps, step)
+	}
+	return index
+}
+
+// helper function returns the log of the step.
+func (s *Sink) lookup(step *engine.Step) *stepLog {
+	for _, l := range s.steps {
+		if l.step == step || l.step.Metadata.Name == step.Metadata.Name {
+			return l
+		}
+	}
+	return nil
+}
+
+// helper function returns the step status.
+func toStatus(l *stepLog) string {
+	switch {
+	case l.started.IsZero():
+		return StatusSkipped
+	case l.state == nil && l.step.Detach:
+		return StatusDetached
+	case l.state == nil:
+		return StatusIncomplete
+	case l.state.OOMKilled:
+		return StatusFailure
+	case l.state.ExitCode == 0, l.state.ExitCode == 78:
+		return StatusSuccess
+	default:
+		return StatusFailure
+	}
+}
+
+// helper function returns a unique log file name for the
+// step name.
+func toFileName(name string, used map[string]bool) string {
+	base := invalid.ReplaceAllString(name, "_")
+	if base == "" || base == "." || base == ".." {
+		base = "step"
+	}
+	file := base + ".log"
+	for i := 2; used[file]; i++ {
+		file = fmt.Sprintf("%s-%d.log", base, i)
+	}
+	used[file] = true
+	return file
+}
+
+// helper function returns the time in unix milliseconds.
+func toMillis(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
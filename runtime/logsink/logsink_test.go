@@ -0,0 +1,135 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Drone Non-Commercial License
+// that can be found in the LICENSE file.
+
+package logsink
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/drone/drone-runtime/engine"
+	"github.com/drone/drone-runtime/runtime"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logsink")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	build := &engine.Step{Metadata: engine.Metadata{Name: "build"}}
+	test := &engine.Step{
+		Metadata:  engine.Metadata{Name: "go test"},
+		DependsOn: []string{"build"},
+	}
+	deploy := &engine.Step{Metadata: engine.Metadata{Name: "deploy"}}
+	spec := &engine.Spec{
+		Metadata: engine.Metadata{Name: "default"},
+		Steps:    []*engine.Step{build, test, deploy},
+	}
+
+	sink, err := New(dir, spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock := time.Unix(1566302400, 0)
+	sink.now = func() time.Time {
+		clock = clock.Add(time.Second)
+		return clock
+	}
+
+	hook := sink.Hook()
+	hook.BeforeEach(&runtime.State{Step: build})
+	hook.GotLine(&runtime.State{Step: build}, &runtime.Line{Number: 0, Message: "go build\n"})
+	hook.BeforeEach(&runtime.State{Step: test})
+	hook.GotLine(&runtime.State{Step: test}, &runtime.Line{Number: 0, Message: "go test"})
+	hook.GotLine(&runtime.State{Step: build}, &runtime.Line{Number: 1, Message: "done\n"})
+	hook.AfterEach(&runtime.State{Step: build, State: &engine.State{Exited: true}})
+	hook.AfterEach(&runtime.State{Step: test, State: &engine.State{Exited: true, ExitCode: 1}})
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string]string{
+		"build.log":   "go build\ndone\n",
+		"go_test.log": "go test\n",
+		CombinedFile:  "[build:0] go build\n[go test:0] go test\n[build:1] done\n",
+	}
+	for name, want := range files {
+		got, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if diff := cmp.Diff(want, string(got)); diff != "" {
+			t.Errorf("Unexpected contents of %s", name)
+			t.Log(diff)
+		}
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, IndexFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := new(Index)
+	if err := json.Unmarshal(data, got); err != nil {
+		t.Fatal(err)
+	}
+	want := &Index{
+		Name: "default",
+		Steps: []*IndexStep{
+			{
+				Name:     "build",
+				Status:   StatusSuccess,
+				Started:  1566302401000,
+				Finished: 1566302403000,
+				Duration: 2000,
+				Log:      "build.log",
+			},
+			{
+				Name:      "go test",
+				Status:    StatusFailure,
+				ExitCode:  1,
+				DependsOn: []string{"build"},
+				Started:   1566302402000,
+				Finished:  1566302404000,
+				Duration:  2000,
+				Log:       "go_test.log",
+			},
+			{
+				Name:   "deploy",
+				Status: StatusSkipped,
+			},
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Unexpected index")
+		t.Log(diff)
+	}
+}
+
+func TestToFileName(t *testing.T) {
+	used := map[string]bool{CombinedFile: true}
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"build", "build.log"},
+		{"go test", "go_test.log"},
+		{"go/test", "go_test-2.log"},
+		{"pipeline", "pipeline-2.log"},
+		{"..", "step.log"},
+	}
+	for _, test := range tests {
+		if got := toFileName(test.name, used); got != test.want {
+			t.Errorf("Want file name %q for step %q, got %q", test.want, test.name, got)
+		}
+	}
+}
@@ -14,7 +14,11 @@
 
 package runtime
 
-import "github.com/drone/drone-runtime/engine"
+import (
+	"io"
+
+	"github.com/drone/drone-runtime/engine"
+)
 
 // Option configures a Runtime option.
 type Option func(*Runtime)
@@ -41,3 +45,19 @@ func WithHooks(h *Hook) Option {
 		}
 	}
 }
+
+// WithDebug sets the function called when a step fails,
+// before the failure is reported.
+func WithDebug(fn DebugFunc) Option {
+	return func(r *Runtime) {
+		r.debug = fn
+	}
+}
+
+// WithDryRun writes the execution plan to io.Writer w,
+// instead of executing the pipeline.
+func WithDryRun(w io.Writer) Option {
+	return func(r *Runtime) {
+		r.dryRun = w
+	}
+}
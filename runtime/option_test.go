@@ -5,6 +5,8 @@
 package runtime
 
 import (
+	"bytes"
+	"context"
 	"testing"
 
 	"github.com/drone/drone-runtime/engine"
@@ -25,3 +27,24 @@ func TestWithConfig(t *testing.T) {
 		t.Errorf("Option does not set runtime configuration")
 	}
 }
+
+func TestWithDebug(t *testing.T) {
+	called := false
+	fn := func(context.Context, *State) *engine.State {
+		called = true
+		return nil
+	}
+	r := New(WithDebug(fn))
+	r.debug(nil, nil)
+	if !called {
+		t.Errorf("Option does not set runtime debug function")
+	}
+}
+
+func TestWithDryRun(t *testing.T) {
+	var buf bytes.Buffer
+	r := New(WithDryRun(&buf))
+	if r.dryRun != &buf {
+		t.Errorf("Option does not set runtime dry run writer")
+	}
+}
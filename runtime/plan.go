@@ -0,0 +1,311 @@
+// Copyright 2019 Drone IO, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/drone/drone-runtime/engine"
+)
+
+// Pull decisions reported by the plan.
+const (
+	PullAlways  = "always"
+	PullMissing = "if-not-exists"
+	PullNever   = "never"
+)
+
+type (
+	// Plan describes how the runtime executes a pipeline,
+	// without executing the pipeline.
+	Plan struct {
+		Serial      bool
+		Waves       [][]*PlanStep
+		Volumes     []*PlanVolume
+		Networks    []string
+		Namespace   string
+		PullSecrets []string
+	}
+
+	// PlanStep describes how the runtime executes a
+	// pipeline step.
+	PlanStep struct {
+		Name      string
+		Image     string
+		Digest    string
+		Pull      string
+		Auth      string
+		RunPolicy engine.RunPolicy
+		Detach    bool
+		DependsOn []string
+	}
+
+	// PlanVolume describes a volume that is created or
+	// mounted by the runtime.
+	PlanVolume struct {
+		Name     string
+		HostPath string
+		Source   string
+	}
+)
+
+// NewPlan returns the execution plan for the pipeline. Steps
+// are grouped in waves, where the steps in a wave are
+// executed in parallel once the previous wave completes. If
+// the steps have no dependencies, steps are executed in
+// order, one step per wave.
+func NewPlan(spec *engine.Spec) *Plan {
+	plan := &Plan{
+		Serial: isSerial(spec),
+	}
+	waves := toWaves(spec)
+	for _, step := range spec.Steps {
+		i := waves[step.Metadata.Name]
+		for len(plan.Waves) < i {
+			plan.Waves = append(plan.Waves, nil)
+		}
+		plan.Waves[i-1] = append(plan.Waves[i-1], toPlanStep(spec, step))
+	}
+
+	// the default network is named after the pipeline
+	// unique identifier. The networks are replaced by the
+	// engine description, for engines that do not create
+	// docker networks.
+	plan.Networks = append(plan.Networks, spec.Metadata.UID)
+	if spec.Docker != nil {
+		for _, vol := range spec.Docker.Volumes {
+			v := &PlanVolume{Name: vol.Metadata.Name}
+			if vol.HostPath != nil {
+				v.HostPath = vol.HostPath.Path
+			}
+			plan.Volumes = append(plan.Volumes, v)
+		}
+		for _, net := range spec.Docker.Networks {
+			plan.Networks = append(plan.Networks, net.Metadata.Name)
+		}
+	}
+	return plan
+}
+
+// Describe adds the engine resources to the plan, for
+// example, the namespace and volume sources used by the
+// Kubernetes engine. The plan networks are replaced by the
+// networks created by the engine.
+func (p *Plan) Describe(d *engine.Description) {
+	if d == nil {
+		return
+	}
+	p.Namespace = d.Namespace
+	p.PullSecrets = d.PullSecrets
+	p.Networks = d.Networks
+	for _, vol := range p.Volumes {
+		if source, ok := d.Volumes[vol.Name]; ok {
+			vol.Source = source
+		}
+	}
+}
+
+// Write writes the plan to io.Writer w in a human-readable
+// format. Steps that are never executed are not assigned a
+// wave, and steps that are only executed when the pipeline
+// fails are marked with an asterisk.
+func (p *Plan) Write(w io.Writer) error {
+	mode := "graph"
+	if p.Serial {
+		mode = "serial"
+	}
+	var steps, never int
+	var onFailure bool
+	for _, wave := range p.Waves {
+		steps += len(wave)
+		for _, step := range wave {
+			switch step.RunPolicy {
+			case engine.RunNever:
+				never++
+			case engine.RunOnFailure:
+				onFailure = true
+			}
+		}
+	}
+	fmt.Fprintf(w, "%d steps in %d waves, %s execution", steps-never, len(p.Waves), mode)
+	if never != 0 {
+		fmt.Fprintf(w, ", %d steps never executed", never)
+	}
+	fmt.Fprint(w, "\n\n")
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "WAVE\tSTEP\tIMAGE\tPULL\tAUTH\tRUN\tDETACH")
+	for i, wave := range p.Waves {
+		for _, step := range wave {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%v\n",
+				toWaveLabel(i+1, step),
+				step.Name,
+				orDash(toImageLabel(step)),
+				orDash(step.Pull),
+				orDash(step.Auth),
+				step.RunPolicy,
+				step.Detach,
+			)
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if onFailure {
+		fmt.Fprintln(w, "\n* executed only if the pipeline fails")
+	}
+
+	if p.Namespace != "" {
+		fmt.Fprintf(w, "\nnamespace:\n  %s\n", p.Namespace)
+	}
+	if len(p.Volumes) != 0 {
+		fmt.Fprintln(w, "\nvolumes:")
+		for _, vol := range p.Volumes {
+			switch {
+			case vol.Source != "":
+				fmt.Fprintf(w, "  %s (%s)\n", vol.Name, vol.Source)
+			case vol.HostPath != "":
+				fmt.Fprintf(w, "  %s (host %s)\n", vol.Name, vol.HostPath)
+			default:
+				fmt.Fprintf(w, "  %s (temp)\n", vol.Name)
+			}
+		}
+	}
+	if len(p.Networks) != 0 {
+		fmt.Fprintln(w, "\nnetworks:")
+		for _, net := range p.Networks {
+			fmt.Fprintf(w, "  %s\n", net)
+		}
+	}
+	if len(p.PullSecrets) != 0 {
+		fmt.Fprintln(w, "\npull secrets:")
+		for _, name := range p.PullSecrets {
+			fmt.Fprintf(w, "  %s\n", name)
+		}
+	}
+	return nil
+}
+
+// helper function returns the wave label of the step.
+// Steps that are never executed are labeled with a dash,
+// and steps that are only executed when the pipeline fails
+// are marked with an asterisk.
+func toWaveLabel(wave int, step *PlanStep) string {
+	switch step.RunPolicy {
+	case engine.RunNever:
+		return "-"
+	case engine.RunOnFailure:
+		return fmt.Sprintf("%d*", wave)
+	default:
+		return fmt.Sprint(wave)
+	}
+}
+
+// helper function returns the image label of the step,
+// including the pinned image digest.
+func toImageLabel(step *PlanStep) string {
+	if step.Digest == "" || strings.HasSuffix(step.Image, "@"+step.Digest) {
+		return step.Image
+	}
+	return step.Image + "@" + step.Digest
+}
+
+// helper function returns the execution wave of each step,
+// by step name. Steps without dependencies are executed in
+// the first wave, and steps with dependencies are executed
+// in the wave after their last dependency.
+func toWaves(spec *engine.Spec) map[string]int {
+	waves := map[string]int{}
+	if isSerial(spec) {
+		for i, step := range spec.Steps {
+			waves[step.Metadata.Name] = i + 1
+		}
+		return waves
+	}
+	var visit func(step *engine.Step) int
+	visit = func(step *engine.Step) int {
+		if wave, ok := waves[step.Metadata.Name]; ok {
+			return wave
+		}
+		// the step is assigned a wave before its
+		// dependencies are visited to guard against
+		// dependency cycles.
+		waves[step.Metadata.Name] = 1
+		wave := 1
+		for _, name := range step.DependsOn {
+			if dep, ok := engine.LookupStep(spec, name); ok {
+				if w := visit(dep) + 1; w > wave {
+					wave = w
+				}
+			}
+		}
+		waves[step.Metadata.Name] = wave
+		return wave
+	}
+	for _, step := range spec.Steps {
+		visit(step)
+	}
+	return waves
+}
+
+// helper function returns the plan for the step, including
+// the image pull decision and the registry credentials. The
+// pull decision matches the docker engine, which pulls the
+// image before the step is created if engine.ShouldPull
+// returns true, and otherwise pulls the image if it does
+// not exist.
+func toPlanStep(spec *engine.Spec, step *engine.Step) *PlanStep {
+	s := &PlanStep{
+		Name:      step.Metadata.Name,
+		RunPolicy: step.RunPolicy,
+		Detach:    step.Detach,
+		DependsOn: step.DependsOn,
+	}
+	if step.Docker == nil {
+		return s
+	}
+	s.Image = step.Docker.Image
+
+	image, domain, _, err := engine.ParseImage(step.Docker.Image)
+	if err != nil {
+		return s
+	}
+	s.Image = image
+	s.Digest = engine.ImageDigest(step)
+	if auth, ok := engine.LookupAuth(spec, domain); ok {
+		s.Auth = auth.Address
+	}
+
+	switch {
+	case step.Docker.PullPolicy == engine.PullNever:
+		s.Pull = PullNever
+	case engine.ShouldPull(step):
+		s.Pull = PullAlways
+	default:
+		s.Pull = PullMissing
+	}
+	return s
+}
+
+// helper function returns a dash if the string is empty.
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
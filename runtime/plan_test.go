@@ -0,0 +1,220 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Drone Non-Commercial License
+// that can be found in the LICENSE file.
+
+package runtime
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/drone/drone-runtime/engine"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestNewPlan(t *testing.T) {
+	spec := &engine.Spec{
+		Metadata: engine.Metadata{UID: "uid_1"},
+		Docker: &engine.DockerConfig{
+			Auths: []*engine.DockerAuth{
+				{Address: "https://index.docker.io/v1/"},
+				{Address: "gcr.io"},
+			},
+			Volumes: []*engine.Volume{
+				{Metadata: engine.Metadata{Name: "cache"}, EmptyDir: &engine.VolumeEmptyDir{}},
+				{Metadata: engine.Metadata{Name: "docker"}, HostPath: &engine.VolumeHostPath{Path: "/var/run/docker.sock"}},
+			},
+			Networks: []*engine.Network{
+				{Metadata: engine.Metadata{Name: "backend"}},
+			},
+		},
+		Steps: []*engine.Step{
+			{
+				Metadata: engine.Metadata{Name: "redis"},
+				Docker:   &engine.DockerStep{Image: "redis"},
+				Detach:   true,
+			},
+			{
+				Metadata: engine.Metadata{Name: "build"},
+				Docker:   &engine.DockerStep{Image: "golang:1.12"},
+			},
+			{
+				Metadata:  engine.Metadata{Name: "test"},
+				Docker:    &engine.DockerStep{Image: "gcr.io/project/test:1", PullPolicy: engine.PullAlways},
+				DependsOn: []string{"build", "redis"},
+			},
+			{
+				Metadata:  engine.Metadata{Name: "notify"},
+				Docker:    &engine.DockerStep{Image: "plugins/slack", PullPolicy: engine.PullNever},
+				DependsOn: []string{"test"},
+				RunPolicy: engine.RunOnFailure,
+			},
+		},
+	}
+
+	want := &Plan{
+		Waves: [][]*PlanStep{
+			{
+				{Name: "redis", Image: "docker.io/library/redis:latest", Pull: PullAlways, Auth: "https://index.docker.io/v1/", Detach: true},
+				{Name: "build", Image: "docker.io/library/golang:1.12", Pull: PullMissing, Auth: "https://index.docker.io/v1/"},
+			},
+			{
+				{Name: "test", Image: "gcr.io/project/test:1", Pull: PullAlways, Auth: "gcr.io", DependsOn: []string{"build", "redis"}},
+			},
+			{
+				{Name: "notify", Image: "docker.io/plugins/slack:latest", Pull: PullNever, Auth: "https://index.docker.io/v1/", DependsOn: []string{"test"}, RunPolicy: engine.RunOnFailure},
+			},
+		},
+		Volumes: []*PlanVolume{
+			{Name: "cache"},
+			{Name: "docker", HostPath: "/var/run/docker.sock"},
+		},
+		Networks: []string{"uid_1", "backend"},
+	}
+	got := NewPlan(spec)
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Unexpected plan")
+		t.Log(diff)
+	}
+}
+
+func TestNewPlanSerial(t *testing.T) {
+	spec := &engine.Spec{
+		Steps: []*engine.Step{
+			{Metadata: engine.Metadata{Name: "build"}},
+			{Metadata: engine.Metadata{Name: "test"}},
+		},
+	}
+	plan := NewPlan(spec)
+	if !plan.Serial {
+		t.Errorf("Want serial execution")
+	}
+	if got, want := len(plan.Waves), 2; got != want {
+		t.Errorf("Want %d waves, got %d", want, got)
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	spec := &engine.Spec{
+		Metadata: engine.Metadata{UID: "uid_1"},
+		Steps: []*engine.Step{
+			{
+				Metadata: engine.Metadata{Name: "build"},
+				Docker:   &engine.DockerStep{Image: "golang:1.12"},
+			},
+		},
+	}
+
+	// the engine is nil, and the test panics if the
+	// runtime calls the engine in dry run mode.
+	var buf bytes.Buffer
+	r := New(WithConfig(spec), WithDryRun(&buf))
+	if err := r.Run(context.Background()); err != nil {
+		t.Error(err)
+	}
+	want := "1 steps in 1 waves, serial execution\n\n" +
+		"WAVE  STEP   IMAGE                          PULL           AUTH  RUN         DETACH\n" +
+		"1     build  docker.io/library/golang:1.12  if-not-exists  -     on-success  false\n" +
+		"\nnetworks:\n  uid_1\n"
+	if diff := cmp.Diff(want, buf.String()); diff != "" {
+		t.Errorf("Unexpected plan output")
+		t.Log(diff)
+	}
+	if strings.Contains(buf.String(), "volumes:") {
+		t.Errorf("Want volumes omitted when no volumes are defined")
+	}
+}
+
+func TestPlanDescribe(t *testing.T) {
+	plan := &Plan{
+		Volumes: []*PlanVolume{
+			{Name: "cache"},
+			{Name: "docker", HostPath: "/var/run/docker.sock"},
+		},
+		Networks: []string{"uid_1"},
+	}
+	plan.Describe(&engine.Description{
+		Namespace:   "ns_1",
+		PullSecrets: []string{"uid_1-pull"},
+		Volumes:     map[string]string{"cache": "empty_dir"},
+	})
+	want := &Plan{
+		Namespace:   "ns_1",
+		PullSecrets: []string{"uid_1-pull"},
+		Volumes: []*PlanVolume{
+			{Name: "cache", Source: "empty_dir"},
+			{Name: "docker", HostPath: "/var/run/docker.sock"},
+		},
+	}
+	if diff := cmp.Diff(want, plan); diff != "" {
+		t.Errorf("Unexpected plan")
+		t.Log(diff)
+	}
+
+	// a nil description is ignored.
+	plan.Describe(nil)
+	if diff := cmp.Diff(want, plan); diff != "" {
+		t.Errorf("Unexpected plan")
+		t.Log(diff)
+	}
+}
+
+func TestPlanWrite(t *testing.T) {
+	plan := &Plan{
+		Waves: [][]*PlanStep{
+			{
+				{Name: "build", Image: "docker.io/library/golang:1.12", Digest: "sha256:8f1f8a5a", Pull: PullMissing, RunPolicy: engine.RunOnSuccess},
+				{Name: "skip", Image: "docker.io/library/alpine:3.9", Pull: PullMissing, RunPolicy: engine.RunNever},
+			},
+			{
+				{Name: "notify", Image: "docker.io/plugins/slack@sha256:3c2a5b4e", Digest: "sha256:3c2a5b4e", Pull: PullNever, RunPolicy: engine.RunOnFailure},
+			},
+		},
+		Volumes: []*PlanVolume{
+			{Name: "cache", Source: "empty_dir"},
+		},
+		Networks:    []string{"uid_1"},
+		Namespace:   "ns_1",
+		PullSecrets: []string{"uid_1-pull"},
+	}
+	var buf bytes.Buffer
+	if err := plan.Write(&buf); err != nil {
+		t.Error(err)
+	}
+	want := "2 steps in 2 waves, graph execution, 1 steps never executed\n\n" +
+		"WAVE  STEP    IMAGE                                          PULL           AUTH  RUN         DETACH\n" +
+		"1     build   docker.io/library/golang:1.12@sha256:8f1f8a5a  if-not-exists  -     on-success  false\n" +
+		"-     skip    docker.io/library/alpine:3.9                   if-not-exists  -     never       false\n" +
+		"2*    notify  docker.io/plugins/slack@sha256:3c2a5b4e        never          -     on-failure  false\n" +
+		"\n* executed only if the pipeline fails\n" +
+		"\nnamespace:\n  ns_1\n" +
+		"\nvolumes:\n  cache (empty_dir)\n" +
+		"\nnetworks:\n  uid_1\n" +
+		"\npull secrets:\n  uid_1-pull\n"
+	if diff := cmp.Diff(want, buf.String()); diff != "" {
+		t.Errorf("Unexpected plan output")
+		t.Log(diff)
+	}
+}
+
+// TestPlanWriteNoNetworks verifies the networks are omitted
+// when the engine creates no networks.
+func TestPlanWriteNoNetworks(t *testing.T) {
+	plan := &Plan{
+		Waves: [][]*PlanStep{
+			{
+				{Name: "build", Image: "docker.io/library/golang:1.12", Pull: PullMissing, RunPolicy: engine.RunOnSuccess},
+			},
+		},
+		Namespace: "ns_1",
+	}
+	var buf bytes.Buffer
+	if err := plan.Write(&buf); err != nil {
+		t.Error(err)
+	}
+	if strings.Contains(buf.String(), "networks:") {
+		t.Errorf("Want networks omitted from the plan output")
+	}
+}
@@ -32,10 +32,19 @@ type Runtime struct {
 	engine engine.Engine
 	config *engine.Spec
 	hook   *Hook
+	debug  DebugFunc
+	dryRun io.Writer
 	start  int64
 	error  error
 }
 
+// DebugFunc is called when a step fails, before the step
+// failure is reported, and may be used to debug the failed
+// step. It returns the step state, which replaces the failed
+// state, for example, if the step is successfully re-run. If
+// it returns nil, the failed state is kept.
+type DebugFunc func(context.Context, *State) *engine.State
+
 // New returns a new runtime using the specified runtime
 // configuration and runtime engine.
 func New(opts ...Option) *Runtime {
@@ -55,11 +64,27 @@ func (r *Runtime) Run(ctx context.Context) error {
 // Resume starts the pipeline at the specified stage and
 // waits for it to complete.
 func (r *Runtime) Resume(ctx context.Context, start int) error {
+	// in dry run mode the execution plan is written and
+	// the engine is not called, except to describe the
+	// engine resources.
+	if r.dryRun != nil {
+		plan := NewPlan(r.config)
+		if describer, ok := r.engine.(engine.Describer); ok {
+			plan.Describe(describer.Describe(r.config))
+		}
+		return plan.Write(r.dryRun)
+	}
+
 	defer func() {
 		// note that we use a new context to destroy the
 		// environment to ensure it is not in a canceled
-		// state.
-		r.engine.Destroy(context.Background(), r.config)
+		// state. Resources that could not be removed are
+		// reported to the hook, and do not change the
+		// pipeline result.
+		derr := r.engine.Destroy(context.Background(), r.config)
+		if r.hook.AfterDestroy != nil {
+			r.hook.AfterDestroy(snapshot(r, nil, nil), derr)
+		}
 	}()
 
 	r.error = nil
@@ -85,7 +110,7 @@ func (r *Runtime) Resume(ctx context.Context, start int) error {
 			select {
 			case <-ctx.Done():
 				return ErrCancel
-			case err := <-r.execAll(steps):
+			case err := <-r.execAll(ctx, steps):
 				if err != nil {
 					r.error = err
 				}
@@ -123,7 +148,7 @@ func (r *Runtime) execGraph(ctx context.Context) error {
 			if skip {
 				return nil
 			}
-			err := r.exec(step)
+			err := r.exec(ctx, step)
 			if err != nil {
 				r.mu.Lock()
 				r.error = err
@@ -140,7 +165,7 @@ func (r *Runtime) execGraph(ctx context.Context) error {
 	return d.Run()
 }
 
-func (r *Runtime) execAll(group []*engine.Step) <-chan error {
+func (r *Runtime) execAll(ctx context.Context, group []*engine.Step) <-chan error {
 	var g errgroup.Group
 	done := make(chan error)
 
@@ -155,7 +180,7 @@ func (r *Runtime) execAll(group []*engine.Step) <-chan error {
 	for _, step := range group {
 		step := step
 		g.Go(func() error {
-			return r.exec(step)
+			return r.exec(ctx, step)
 		})
 	}
 
@@ -166,9 +191,7 @@ func (r *Runtime) execAll(group []*engine.Step) <-chan error {
 	return done
 }
 
-func (r *Runtime) exec(step *engine.Step) error {
-	ctx := context.Background()
-
+func (r *Runtime) exec(ctx context.Context, step *engine.Step) error {
 	switch {
 	case step.RunPolicy == engine.RunNever:
 		return nil
@@ -199,6 +222,21 @@ func (r *Runtime) exec(step *engine.Step) error {
 		return err
 	}
 
+	if r.hook.AfterCreate != nil {
+		// the image digest is reported when the container is
+		// created, since detached steps are not waited on.
+		var created *engine.State
+		if digester, ok := r.engine.(engine.Digester); ok {
+			if digest, err := digester.Digest(ctx, r.config, step); err == nil {
+				created = &engine.State{Digest: digest}
+			}
+		}
+		state := snapshot(r, step, created)
+		if err := r.hook.AfterCreate(state); err != nil {
+			return err
+		}
+	}
+
 	if err := r.engine.Start(ctx, r.config, step); err != nil {
 		// TODO(bradrydzewski) refactor duplicate code
 		if r.hook.AfterEach != nil {
@@ -246,6 +284,12 @@ func (r *Runtime) exec(step *engine.Step) error {
 
 	err = g.Wait() // wait for background tasks to complete.
 
+	if r.debug != nil && !step.IgnoreErr && isFailure(wait) {
+		if result := r.debug(ctx, snapshot(r, step, wait)); result != nil {
+			wait = result
+		}
+	}
+
 	if wait.OOMKilled {
 		err = &OomError{
 			Name: step.Metadata.Name,
@@ -273,6 +317,13 @@ func (r *Runtime) exec(step *engine.Step) error {
 	return err
 }
 
+// helper function returns true if the step state is a
+// failure. Exit code 78 interrupts the pipeline and is not
+// considered a failure.
+func isFailure(state *engine.State) bool {
+	return state.OOMKilled || (state.ExitCode != 0 && state.ExitCode != 78)
+}
+
 // helper function exports a single file or folder.
 func stream(state *State, rc io.ReadCloser) error {
 	defer rc.Close()
@@ -4,6 +4,109 @@
 
 package runtime
 
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"testing"
+
+	"github.com/drone/drone-runtime/engine"
+	"github.com/drone/drone-runtime/engine/mocks"
+	"github.com/golang/mock/gomock"
+)
+
+// TestRunDestroyError verifies the runtime reports the
+// error from destroying the pipeline environment to the
+// hook, and does not change the pipeline result.
+func TestRunDestroyError(t *testing.T) {
+	c := gomock.NewController(t)
+	defer c.Finish()
+
+	conf := &engine.Spec{}
+	err := errors.New("unable to remove network")
+
+	mock := mock_engine.NewMockEngine(c)
+	mock.EXPECT().Setup(gomock.Any(), conf)
+	mock.EXPECT().Destroy(gomock.Any(), conf).Return(err)
+
+	var destroyErr error
+	run := New(
+		WithEngine(mock),
+		WithConfig(conf),
+		WithHooks(&Hook{
+			AfterDestroy: func(state *State, err error) {
+				destroyErr = err
+			},
+		}),
+	)
+	if err := run.Run(context.Background()); err != nil {
+		t.Errorf("Want nil error returned from runtime, got %v", err)
+	}
+	if got, want := destroyErr, err; got != want {
+		t.Errorf("Want Destroy error reported to the hook, got %v", got)
+	}
+}
+
+// TestRunDestroyErrorFailure verifies the runtime returns
+// the pipeline error, and not the error from destroying the
+// pipeline environment, when the pipeline fails.
+func TestRunDestroyErrorFailure(t *testing.T) {
+	c := gomock.NewController(t)
+	defer c.Finish()
+
+	conf := &engine.Spec{}
+	err := errors.New("unable to create network")
+
+	mock := mock_engine.NewMockEngine(c)
+	mock.EXPECT().Setup(gomock.Any(), conf).Return(err)
+	mock.EXPECT().Destroy(gomock.Any(), conf).Return(errors.New("unable to remove network"))
+
+	run := New(
+		WithEngine(mock),
+		WithConfig(conf),
+	)
+	if got, want := run.Run(context.Background()), err; got != want {
+		t.Errorf("Want Setup error returned from runtime, got %v", got)
+	}
+}
+
+// TestRunDebugNil verifies the runtime keeps the failed
+// step state when the debug function returns nil.
+func TestRunDebugNil(t *testing.T) {
+	c := gomock.NewController(t)
+	defer c.Finish()
+
+	step := &engine.Step{Metadata: engine.Metadata{Name: "build"}}
+	conf := &engine.Spec{Steps: []*engine.Step{step}}
+	state := &engine.State{Exited: true, ExitCode: 1}
+
+	mock := mock_engine.NewMockEngine(c)
+	mock.EXPECT().Setup(gomock.Any(), conf)
+	mock.EXPECT().Create(gomock.Any(), conf, step)
+	mock.EXPECT().Start(gomock.Any(), conf, step)
+	mock.EXPECT().Tail(gomock.Any(), conf, step).Return(ioutil.NopCloser(bytes.NewBuffer(nil)), nil)
+	mock.EXPECT().Wait(gomock.Any(), conf, step).Return(state, nil)
+	mock.EXPECT().Destroy(gomock.Any(), conf)
+
+	var debugged bool
+	run := New(
+		WithEngine(mock),
+		WithConfig(conf),
+		WithDebug(func(context.Context, *State) *engine.State {
+			debugged = true
+			return nil
+		}),
+	)
+	err := run.Run(context.Background())
+	if !debugged {
+		t.Errorf("Want debug function called when the step fails")
+	}
+	if exit, ok := err.(*ExitError); !ok || exit.Code != 1 {
+		t.Errorf("Want step exit error, got %v", err)
+	}
+}
+
 // import (
 // 	"bytes"
 // 	"context"
@@ -0,0 +1,184 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Drone Non-Commercial License
+// that can be found in the LICENSE file.
+
+package term
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/drone/drone-runtime/runtime"
+)
+
+// Timestamp defines the timestamp prefixed to log lines.
+type Timestamp int
+
+// Timestamp enumeration.
+const (
+	TimestampNone Timestamp = iota
+	TimestampElapsed
+	TimestampAbsolute
+)
+
+// ParseTimestamp returns the Timestamp matching string s.
+func ParseTimestamp(s string) (Timestamp, error) {
+	switch s {
+	case "", "none":
+		return TimestampNone, nil
+	case "elapsed":
+		return TimestampElapsed, nil
+	case "absolute":
+		return TimestampAbsolute, nil
+	default:
+		return TimestampNone, fmt.Errorf("unknown timestamp format %q", s)
+	}
+}
+
+// ansi matches ansi escape sequences.
+var ansi = regexp.MustCompile("\x1b\\[[0-9;?]*[ -/]*[@-~]")
+
+// Option configures the log line format.
+type Option func(*format)
+
+// WithTimestamp prefixes log lines with the elapsed or
+// absolute timestamp.
+func WithTimestamp(t Timestamp) Option {
+	return func(f *format) {
+		f.timestamp = t
+	}
+}
+
+// WithStripANSI removes ansi escape codes from log lines.
+func WithStripANSI() Option {
+	return func(f *format) {
+		f.strip = true
+	}
+}
+
+// WithWrap wraps log lines that are longer than the width.
+// Escape codes do not count towards the width.
+func WithWrap(width int) Option {
+	return func(f *format) {
+		f.width = width
+	}
+}
+
+// format defines the log line format.
+type format struct {
+	timestamp Timestamp
+	strip     bool
+	width     int
+}
+
+func newFormat(opts ...Option) *format {
+	f := new(format)
+	for _, opt := range opts {
+		opt(f)
+	}
+	return f
+}
+
+// lines returns the log line message, prefixed with the
+// timestamp and split into lines of the configured width.
+func (f *format) lines(line *runtime.Line) []string {
+	message := strings.TrimRight(line.Message, "\r\n")
+	if f.strip {
+		message = ansi.ReplaceAllString(message, "")
+	}
+	var prefix string
+	switch f.timestamp {
+	case TimestampElapsed:
+		prefix = formatElapsed(line.Elapsed) + " "
+	case TimestampAbsolute:
+		prefix = formatAbsolute(line.Created) + " "
+	}
+	var lines []string
+	for _, part := range wrap(message, f.width) {
+		lines = append(lines, prefix+part)
+	}
+	return lines
+}
+
+// WriteLineFormat writes log lines to io.Writer w in the
+// format defined by the options.
+func WriteLineFormat(w io.Writer, opts ...Option) WriteLineFunc {
+	var (
+		mutex sync.Mutex
+		f     = newFormat(opts...)
+	)
+
+	return func(state *runtime.State, line *runtime.Line) error {
+		name := state.Step.Metadata.Name
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		// the line ending is preserved, so that partial
+		// lines without a trailing newline are not split.
+		message := line.Message
+		eol := message[len(strings.TrimRight(message, "\r\n")):]
+
+		parts := f.lines(line)
+		for i, part := range parts {
+			if i < len(parts)-1 {
+				part += "\n"
+			} else {
+				part += eol
+			}
+			fmt.Fprintf(w, linePlain, name, line.Number, part)
+		}
+		return nil
+	}
+}
+
+// helper function formats the elapsed milliseconds in
+// mm:ss.SSS format.
+func formatElapsed(ms int64) string {
+	d := time.Duration(ms) * time.Millisecond
+	return fmt.Sprintf("%02d:%06.3f", int(d/time.Minute), (d % time.Minute).Seconds())
+}
+
+// helper function formats the unix milliseconds in
+// RFC 3339 format, with millisecond precision.
+func formatAbsolute(ms int64) string {
+	t := time.Unix(0, ms*int64(time.Millisecond)).UTC()
+	return t.Format("2006-01-02T15:04:05.000Z07:00")
+}
+
+// helper function splits the string into lines of the
+// specified width. Escape codes are not split, and do not
+// count towards the width.
+func wrap(s string, width int) []string {
+	if width <= 0 {
+		return []string{s}
+	}
+	var (
+		lines []string
+		line  strings.Builder
+		count int
+	)
+	for len(s) != 0 {
+		if s[0] == '\x1b' {
+			if loc := ansi.FindStringIndex(s); loc != nil && loc[0] == 0 {
+				line.WriteString(s[:loc[1]])
+				s = s[loc[1]:]
+				continue
+			}
+		}
+		if count == width {
+			lines = append(lines, line.String())
+			line.Reset()
+			count = 0
+		}
+		_, n := utf8.DecodeRuneInString(s)
+		line.WriteString(s[:n])
+		s = s[n:]
+		count++
+	}
+	return append(lines, line.String())
+}
@@ -0,0 +1,130 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Drone Non-Commercial License
+// that can be found in the LICENSE file.
+
+package term
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/drone/drone-runtime/engine"
+	"github.com/drone/drone-runtime/runtime"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestWriteLineFormat(t *testing.T) {
+	var (
+		step  = &engine.Step{Metadata: engine.Metadata{Name: "test"}}
+		state = &runtime.State{Step: step}
+		line  = &runtime.Line{
+			Number:  1,
+			Message: "\x1b[31mhello\x1b[0m world\n",
+			Elapsed: 61500,
+			Created: 1566302400123,
+		}
+	)
+
+	tests := []struct {
+		opts []Option
+		want string
+	}{
+		{
+			want: "[test:1] \x1b[31mhello\x1b[0m world\n",
+		},
+		{
+			opts: []Option{WithStripANSI()},
+			want: "[test:1] hello world\n",
+		},
+		{
+			opts: []Option{WithStripANSI(), WithTimestamp(TimestampElapsed)},
+			want: "[test:1] 01:01.500 hello world\n",
+		},
+		{
+			opts: []Option{WithStripANSI(), WithTimestamp(TimestampAbsolute)},
+			want: "[test:1] 2019-08-20T12:00:00.123Z hello world\n",
+		},
+		{
+			opts: []Option{WithWrap(6)},
+			want: "[test:1] \x1b[31mhello\x1b[0m \n[test:1] world\n",
+		},
+	}
+	for i, test := range tests {
+		var buf bytes.Buffer
+		WriteLineFormat(&buf, test.opts...)(state, line)
+		if diff := cmp.Diff(test.want, buf.String()); diff != "" {
+			t.Errorf("Unexpected line format at index %d", i)
+			t.Log(diff)
+		}
+	}
+}
+
+func TestWriteLineFormatPartial(t *testing.T) {
+	var (
+		step  = &engine.Step{Metadata: engine.Metadata{Name: "test"}}
+		state = &runtime.State{Step: step}
+	)
+
+	tests := []struct {
+		message string
+		want    string
+	}{
+		{"hello", "[test:1] hello"},
+		{"hello\r\n", "[test:1] hello\r\n"},
+		{"", "[test:1] "},
+	}
+	for _, test := range tests {
+		var buf bytes.Buffer
+		line := &runtime.Line{Number: 1, Message: test.message}
+		WriteLineFormat(&buf)(state, line)
+		if diff := cmp.Diff(test.want, buf.String()); diff != "" {
+			t.Errorf("Unexpected line format for message %q", test.message)
+			t.Log(diff)
+		}
+	}
+}
+
+func TestParseTimestamp(t *testing.T) {
+	tests := []struct {
+		text string
+		want Timestamp
+	}{
+		{"", TimestampNone},
+		{"none", TimestampNone},
+		{"elapsed", TimestampElapsed},
+		{"absolute", TimestampAbsolute},
+	}
+	for _, test := range tests {
+		got, err := ParseTimestamp(test.text)
+		if err != nil {
+			t.Error(err)
+		}
+		if got != test.want {
+			t.Errorf("Want timestamp %v for %q, got %v", test.want, test.text, got)
+		}
+	}
+	if _, err := ParseTimestamp("relative"); err == nil {
+		t.Errorf("Want error for unknown timestamp format")
+	}
+}
+
+func TestWrap(t *testing.T) {
+	tests := []struct {
+		text  string
+		width int
+		want  []string
+	}{
+		{"hello", 0, []string{"hello"}},
+		{"hello", 5, []string{"hello"}},
+		{"hello", 2, []string{"he", "ll", "o"}},
+		{"héllo", 2, []string{"hé", "ll", "o"}},
+		{"", 2, []string{""}},
+	}
+	for _, test := range tests {
+		got := wrap(test.text, test.width)
+		if diff := cmp.Diff(test.want, got); diff != "" {
+			t.Errorf("Unexpected wrap of %q at width %d", test.text, test.width)
+			t.Log(diff)
+		}
+	}
+}
@@ -0,0 +1,238 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Drone Non-Commercial License
+// that can be found in the LICENSE file.
+
+package term
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/drone/drone-runtime/engine"
+	"github.com/drone/drone-runtime/runtime"
+)
+
+// step status displayed by the renderer.
+const (
+	statusQueued   = "queued"
+	statusPulling  = "pulling"
+	statusRunning  = "running"
+	statusPassed   = "passed"
+	statusFailed   = "failed"
+	statusSkipped  = "skipped"
+	statusDetached = "detached"
+)
+
+// log group markers.
+const (
+	groupBegin = "::group::"
+	groupEnd   = "::endgroup::"
+)
+
+// status symbols and colors.
+var statusFormat = map[string]struct{ symbol, color string }{
+	statusQueued:   {"○", "90m"},
+	statusPulling:  {"↓", "33m"},
+	statusRunning:  {"▶", "34m"},
+	statusPassed:   {"✔", "32m"},
+	statusFailed:   {"✘", "31m"},
+	statusSkipped:  {"–", "90m"},
+	statusDetached: {"▶", "36m"},
+}
+
+// stepStatus tracks the status of a pipeline step.
+type stepStatus struct {
+	step     *engine.Step
+	status   string
+	color    string
+	started  time.Time
+	finished time.Time
+	state    *engine.State
+	group    bool
+}
+
+// Renderer renders the pipeline progress to a terminal. It
+// writes a status header each time a step changes status,
+// separates the logs of concurrent steps, and indents the
+// log lines between ::group:: and ::endgroup:: markers.
+type Renderer struct {
+	mu    sync.Mutex
+	w     io.Writer
+	steps []*stepStatus
+	last  *stepStatus
+	now   func() time.Time
+	fmt   *format
+}
+
+// NewRenderer returns a new Renderer that writes the
+// progress of the pipeline to io.Writer w. The options
+// configure the format of the log lines.
+func NewRenderer(w io.Writer, spec *engine.Spec, opts ...Option) *Renderer {
+	r := &Renderer{w: w, now: time.Now, fmt: newFormat(opts...)}
+	for i, step := range spec.Steps {
+		r.steps = append(r.steps, &stepStatus{
+			step:   step,
+			status: statusQueued,
+			color:  colors[i%len(colors)],
+		})
+	}
+	return r
+}
+
+// Hook returns the runtime hooks that render the pipeline
+// progress.
+func (r *Renderer) Hook() *runtime.Hook {
+	return &runtime.Hook{
+		Before:      r.before,
+		BeforeEach:  r.beforeEach,
+		AfterCreate: r.afterCreate,
+		AfterEach:   r.afterEach,
+		GotLine:     r.gotLine,
+	}
+}
+
+func (r *Renderer) before(*runtime.State) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, s := range r.steps {
+		r.writeStatus(s)
+	}
+	return nil
+}
+
+func (r *Renderer) beforeEach(state *runtime.State) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if s := r.lookup(state.Step); s != nil {
+		s.status = statusPulling
+		s.started = r.now()
+		r.writeStatus(s)
+	}
+	return nil
+}
+
+func (r *Renderer) afterCreate(state *runtime.State) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if s := r.lookup(state.Step); s != nil {
+		s.status = statusRunning
+		if s.step.Detach {
+			s.status = statusDetached
+		}
+		r.writeStatus(s)
+	}
+	return nil
+}
+
+func (r *Renderer) afterEach(state *runtime.State) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if s := r.lookup(state.Step); s != nil {
+		s.state = state.State
+		s.finished = r.now()
+		s.status = statusPassed
+		if state.State.OOMKilled || (state.State.ExitCode != 0 && state.State.ExitCode != 78) {
+			s.status = statusFailed
+		}
+		r.writeStatus(s)
+	}
+	return nil
+}
+
+func (r *Renderer) gotLine(state *runtime.State, line *runtime.Line) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s := r.lookup(state.Step)
+	if s == nil {
+		return nil
+	}
+
+	// if the previous line was written by a different
+	// step a separator is written to identify the step.
+	if r.last != s {
+		fmt.Fprintf(r.w, "\033[%s── %s ──\033[0m\n", s.color, s.step.Metadata.Name)
+		r.last = s
+	}
+
+	message := strings.TrimRight(line.Message, "\r\n")
+	switch {
+	case strings.HasPrefix(message, groupBegin):
+		s.group = true
+		fmt.Fprintf(r.w, "\033[1m▾ %s\033[0m\n", strings.TrimPrefix(message, groupBegin))
+	case strings.HasPrefix(message, groupEnd):
+		s.group = false
+	default:
+		for _, part := range r.fmt.lines(line) {
+			if s.group {
+				part = "  " + part
+			}
+			fmt.Fprintln(r.w, part)
+		}
+	}
+	return nil
+}
+
+// WriteSummary writes the final status and duration of
+// each pipeline step. Steps that did not start are
+// reported as skipped.
+func (r *Renderer) WriteSummary() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	fmt.Fprintln(r.w, "\033[1m── summary ──\033[0m")
+	var width int
+	for _, s := range r.steps {
+		if n := len(s.step.Metadata.Name); n > width {
+			width = n
+		}
+	}
+	for _, s := range r.steps {
+		status := s.status
+		switch {
+		case status == statusQueued:
+			status = statusSkipped
+		case status == statusPulling, status == statusRunning:
+			status = statusFailed
+		}
+		format := statusFormat[status]
+		line := fmt.Sprintf("\033[%s%s\033[0m %-*s  %-8s", format.color, format.symbol, width, s.step.Metadata.Name, status)
+		if !s.finished.IsZero() {
+			line += fmt.Sprintf("  %s", s.finished.Sub(s.started).Round(time.Millisecond))
+		}
+		if status == statusFailed && s.state != nil {
+			if s.state.OOMKilled {
+				line += "  oom killed"
+			} else {
+				line += fmt.Sprintf("  exit code %d", s.state.ExitCode)
+			}
+		}
+		fmt.Fprintln(r.w, strings.TrimRight(line, " "))
+	}
+}
+
+// helper function writes the step status header.
+func (r *Renderer) writeStatus(s *stepStatus) {
+	format := statusFormat[s.status]
+	fmt.Fprintf(r.w, "\033[%s%s %s\033[0m %s", format.color, format.symbol, s.step.Metadata.Name, s.status)
+	switch {
+	case s.status == statusPulling && s.step.Docker != nil:
+		fmt.Fprintf(r.w, " %s", s.step.Docker.Image)
+	case !s.finished.IsZero():
+		fmt.Fprintf(r.w, " (%s)", s.finished.Sub(s.started).Round(time.Millisecond))
+	}
+	fmt.Fprintln(r.w)
+	r.last = nil
+}
+
+// helper function returns the status of the step.
+func (r *Renderer) lookup(step *engine.Step) *stepStatus {
+	for _, s := range r.steps {
+		if s.step == step || s.step.Metadata.Name == step.Metadata.Name {
+			return s
+		}
+	}
+	return nil
+}
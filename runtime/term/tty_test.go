@@ -0,0 +1,81 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Drone Non-Commercial License
+// that can be found in the LICENSE file.
+
+package term
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/drone/drone-runtime/engine"
+	"github.com/drone/drone-runtime/runtime"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRenderer(t *testing.T) {
+	build := &engine.Step{
+		Metadata: engine.Metadata{Name: "build"},
+		Docker:   &engine.DockerStep{Image: "golang:1.11"},
+	}
+	test := &engine.Step{
+		Metadata: engine.Metadata{Name: "test"},
+		Docker:   &engine.DockerStep{Image: "golang:1.11"},
+	}
+	deploy := &engine.Step{
+		Metadata: engine.Metadata{Name: "deploy"},
+	}
+	spec := &engine.Spec{
+		Steps: []*engine.Step{build, test, deploy},
+	}
+
+	var buf bytes.Buffer
+	clock := time.Unix(0, 0)
+	r := NewRenderer(&buf, spec)
+	r.now = func() time.Time {
+		clock = clock.Add(time.Second)
+		return clock
+	}
+
+	hooks := r.Hook()
+	hooks.Before(&runtime.State{})
+	hooks.BeforeEach(&runtime.State{Step: build})
+	hooks.AfterCreate(&runtime.State{Step: build})
+	hooks.GotLine(&runtime.State{Step: build}, &runtime.Line{Message: "::group::go build\n"})
+	hooks.GotLine(&runtime.State{Step: build}, &runtime.Line{Message: "main.go\n"})
+	hooks.GotLine(&runtime.State{Step: build}, &runtime.Line{Message: "::endgroup::\n"})
+	hooks.BeforeEach(&runtime.State{Step: test})
+	hooks.GotLine(&runtime.State{Step: build}, &runtime.Line{Message: "done\n"})
+	hooks.AfterEach(&runtime.State{Step: build, State: &engine.State{Exited: true}})
+	hooks.AfterCreate(&runtime.State{Step: test})
+	hooks.GotLine(&runtime.State{Step: test}, &runtime.Line{Message: "FAIL\n"})
+	hooks.AfterEach(&runtime.State{Step: test, State: &engine.State{Exited: true, ExitCode: 2}})
+	r.WriteSummary()
+
+	want := "" +
+		"\x1b[90m○ build\x1b[0m queued\n" +
+		"\x1b[90m○ test\x1b[0m queued\n" +
+		"\x1b[90m○ deploy\x1b[0m queued\n" +
+		"\x1b[33m↓ build\x1b[0m pulling golang:1.11\n" +
+		"\x1b[34m▶ build\x1b[0m running\n" +
+		"\x1b[32m── build ──\x1b[0m\n" +
+		"\x1b[1m▾ go build\x1b[0m\n" +
+		"  main.go\n" +
+		"\x1b[33m↓ test\x1b[0m pulling golang:1.11\n" +
+		"\x1b[32m── build ──\x1b[0m\n" +
+		"done\n" +
+		"\x1b[32m✔ build\x1b[0m passed (2s)\n" +
+		"\x1b[34m▶ test\x1b[0m running\n" +
+		"\x1b[33m── test ──\x1b[0m\n" +
+		"FAIL\n" +
+		"\x1b[31m✘ test\x1b[0m failed (2s)\n" +
+		"\x1b[1m── summary ──\x1b[0m\n" +
+		"\x1b[32m✔\x1b[0m build   passed    2s\n" +
+		"\x1b[31m✘\x1b[0m test    failed    2s  exit code 2\n" +
+		"\x1b[90m–\x1b[0m deploy  skipped\n"
+	if diff := cmp.Diff(want, buf.String()); diff != "" {
+		t.Errorf("Unexpected terminal output")
+		t.Log(diff)
+	}
+}
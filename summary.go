@@ -0,0 +1,98 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Drone Non-Commercial License
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/drone/drone-runtime/engine"
+	"github.com/drone/drone-runtime/runtime"
+)
+
+// summary records the state of each pipeline step, and
+// writes a summary table when the pipeline completes.
+type summary struct {
+	mu      sync.Mutex
+	started map[string]time.Time
+	elapsed map[string]time.Duration
+	states  map[string]*engine.State
+}
+
+func newSummary() *summary {
+	return &summary{
+		started: map[string]time.Time{},
+		elapsed: map[string]time.Duration{},
+		states:  map[string]*engine.State{},
+	}
+}
+
+// beforeEach records the step start time.
+func (s *summary) beforeEach(state *runtime.State) error {
+	s.mu.Lock()
+	s.started[state.Step.Metadata.Name] = time.Now()
+	s.mu.Unlock()
+	return nil
+}
+
+// afterEach records the step exit state.
+func (s *summary) afterEach(state *runtime.State) error {
+	name := state.Step.Metadata.Name
+	s.mu.Lock()
+	s.states[name] = state.State
+	s.elapsed[name] = time.Since(s.started[name])
+	s.mu.Unlock()
+	return nil
+}
+
+// write writes the summary table to w.
+func (s *summary) write(w io.Writer, spec *engine.Spec) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "STEP\tSTATUS\tEXIT CODE\tDURATION")
+	for _, step := range spec.Steps {
+		name := step.Metadata.Name
+		code, elapsed := "-", "-"
+		if state, ok := s.states[name]; ok {
+			code = fmt.Sprint(state.ExitCode)
+			elapsed = s.elapsed[name].Round(time.Millisecond).String()
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", name, s.status(step), code, elapsed)
+	}
+	tw.Flush()
+}
+
+// helper function returns the step status.
+func (s *summary) status(step *engine.Step) string {
+	name := step.Metadata.Name
+	state, ok := s.states[name]
+	switch {
+	case !ok && step.Detach:
+		if _, ok := s.started[name]; ok {
+			return "detached"
+		}
+		return "skipped"
+	case !ok:
+		if _, ok := s.started[name]; ok {
+			return "incomplete"
+		}
+		return "skipped"
+	case state.OOMKilled:
+		return "oom killed"
+	case state.ExitCode == 0:
+		return "success"
+	case state.ExitCode == 78:
+		return "interrupt"
+	case step.IgnoreErr:
+		return "failure (ignored)"
+	default:
+		return "failure"
+	}
+}
@@ -0,0 +1,43 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Drone Non-Commercial License
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/drone/drone-runtime/engine"
+)
+
+const validateUsage = `Usage: drone-runtime validate [OPTION]... [SOURCE]
+
+Validates the pipeline specification and writes each
+problem found to stderr.
+
+Options:
+  -h, --help        display this help and exit`
+
+func validateCmd(args []string) int {
+	fs := newFlagSet("validate", validateUsage)
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+
+	spec, code, err := readSpec(fs.Args())
+	if err != nil {
+		return failWith(err, code)
+	}
+	err = engine.Validate(spec)
+	if verr, ok := err.(*engine.ValidationError); ok {
+		for _, problem := range verr.Problems {
+			fmt.Fprintln(os.Stderr, problem)
+		}
+		return exitInvalid
+	}
+	if err != nil {
+		return failWith(err, exitInvalid)
+	}
+	return exitOK
+}
@@ -0,0 +1,311 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Drone Non-Commercial License
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/drone/drone-runtime/engine"
+)
+
+// maxWatchFiles defines the maximum number of files that
+// are watched for changes, which limits the cost of
+// polling large host volumes.
+var maxWatchFiles = 10000
+
+// errWatchLimit stops walking the watched paths when the
+// file limit is reached.
+var errWatchLimit = errors.New("watch: file limit reached")
+
+// watcher re-runs the pipeline when the pipeline
+// specification, the host volumes, or the step inputs
+// change.
+type watcher struct {
+	source   string
+	interval time.Duration
+	exclude  []string
+	load     func() (*engine.Spec, int, error)
+	runner   *runner
+	limited  bool
+}
+
+// snapshot maps file paths to the modification time and
+// size of the file.
+type snapshot map[string]fileInfo
+
+type fileInfo struct {
+	modified time.Time
+	size     int64
+}
+
+// watch runs the pipeline, and re-runs the pipeline each
+// time a change is detected, until the context is
+// cancelled. The snapshot of the watched paths is taken
+// when the pipeline starts, and the running pipeline is
+// cancelled if a watched path changes. Paths written by the
+// steps must be excluded, since they would otherwise cancel
+// the pipeline.
+func (w *watcher) watch(ctx context.Context, spec *engine.Spec) int {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	source, _ := filepath.Abs(w.source)
+	next := spec
+	invalid := false
+	for {
+		last := w.snapshot(spec)
+
+		var done chan int
+		cancel := func() {}
+		if next != nil {
+			var runctx context.Context
+			runctx, cancel = context.WithCancel(ctx)
+			done = make(chan int, 1)
+			go func(spec *engine.Spec) {
+				done <- w.runner.run(runctx, spec)
+			}(next)
+		}
+
+		var changed []string
+		for len(changed) == 0 {
+			select {
+			case <-ctx.Done():
+				cancel()
+				if done != nil {
+					<-done
+				}
+				return exitCancel
+			case code := <-done:
+				fmt.Fprintf(os.Stderr, "\nwatch: pipeline exited with code %d, watching for changes\n", code)
+				done = nil
+			case <-ticker.C:
+				current := w.snapshot(spec)
+				changed = diff(last, current)
+				last = current
+			}
+		}
+		if done != nil {
+			fmt.Fprintln(os.Stderr, "\nwatch: changes detected, cancelling the pipeline")
+			cancel()
+			<-done
+		}
+		cancel()
+
+		// if the pipeline specification changed, the
+		// specification is reloaded and all steps are
+		// executed. If the specification is invalid, the
+		// pipeline does not run until it is fixed.
+		if invalid || contains(changed, source) {
+			reload, _, err := w.load()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "watch: %s\n", err)
+				next = nil
+				invalid = true
+				continue
+			}
+			invalid = false
+			spec = reload
+			next = spec
+			fmt.Fprintln(os.Stderr, "watch: pipeline specification changed, running all steps")
+			continue
+		}
+
+		// if the changed paths match the step inputs, only
+		// the affected steps are executed.
+		names := engine.Affected(toAbsInputs(source, spec), changed)
+		if len(names) == 0 {
+			fmt.Fprintln(os.Stderr, "watch: changes detected, running all steps")
+			next = spec
+		} else {
+			fmt.Fprintf(os.Stderr, "watch: changes detected, running steps %s\n", strings.Join(names, ", "))
+			next = toSubset(spec, names)
+		}
+	}
+}
+
+// snapshot returns the modification time and size of the
+// pipeline specification, the host volumes, and the step
+// inputs, except the excluded paths.
+func (w *watcher) snapshot(spec *engine.Spec) snapshot {
+	source, _ := filepath.Abs(w.source)
+	var exclude []string
+	for _, path := range w.exclude {
+		exclude = append(exclude, resolvePath(source, path))
+	}
+	return w.snapshotRoots(watchRoots(source, spec), exclude)
+}
+
+// snapshotRoots returns the modification time and size of
+// the regular files in the root paths, except the excluded
+// paths. Roots that are not regular files or directories,
+// for example sockets, are skipped, and at most
+// maxWatchFiles files are included.
+func (w *watcher) snapshotRoots(roots, exclude []string) snapshot {
+	s := snapshot{}
+	for _, root := range roots {
+		info, err := os.Stat(root)
+		if err != nil || !(info.IsDir() || info.Mode().IsRegular()) {
+			continue
+		}
+		err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return nil
+			}
+			if info.IsDir() {
+				if info.Name() == ".git" || isExcluded(path, exclude) {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !info.Mode().IsRegular() || isExcluded(path, exclude) {
+				return nil
+			}
+			if len(s) >= maxWatchFiles {
+				return errWatchLimit
+			}
+			s[path] = fileInfo{
+				modified: info.ModTime(),
+				size:     info.Size(),
+			}
+			return nil
+		})
+		if err == errWatchLimit {
+			if !w.limited {
+				w.limited = true
+				fmt.Fprintf(os.Stderr, "watch: only the first %d files are watched\n", maxWatchFiles)
+			}
+			break
+		}
+	}
+	return s
+}
+
+// helper function returns the absolute paths of the
+// pipeline specification, the host volumes, and the step
+// inputs. Step inputs are relative to the directory of the
+// pipeline specification, and glob patterns are replaced
+// with the directory that precedes the first wildcard.
+func watchRoots(source string, spec *engine.Spec) []string {
+	paths := []string{source}
+	if spec.Docker != nil {
+		for _, vol := range spec.Docker.Volumes {
+			if vol.HostPath != nil && vol.HostPath.Path != "" {
+				paths = append(paths, vol.HostPath.Path)
+			}
+		}
+	}
+	for _, step := range spec.Steps {
+		for _, input := range step.Inputs {
+			input = resolvePath(source, input)
+			if i := strings.IndexAny(input, "*?["); i != -1 {
+				input = filepath.Dir(input[:i] + "x")
+			}
+			paths = append(paths, input)
+		}
+	}
+
+	var roots []string
+	seen := map[string]bool{}
+	for _, path := range paths {
+		path, err := filepath.Abs(path)
+		if err != nil || seen[path] {
+			continue
+		}
+		seen[path] = true
+		roots = append(roots, path)
+	}
+	return roots
+}
+
+// helper function resolves the path relative to the
+// directory of the pipeline specification.
+func resolvePath(source, path string) string {
+	if filepath.IsAbs(path) {
+		return filepath.Clean(path)
+	}
+	return filepath.Join(filepath.Dir(source), path)
+}
+
+// helper function returns true if the path is one of the
+// excluded paths, or is contained in an excluded directory.
+func isExcluded(path string, exclude []string) bool {
+	for _, prefix := range exclude {
+		if path == prefix || strings.HasPrefix(path, prefix+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// helper function returns the paths that were added,
+// removed, or modified, in sorted order.
+func diff(before, after snapshot) []string {
+	var paths []string
+	for path, info := range after {
+		if prev, ok := before[path]; !ok || prev != info {
+			paths = append(paths, path)
+		}
+	}
+	for path := range before {
+		if _, ok := after[path]; !ok {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// helper function returns a copy of the specification with
+// absolute step input paths, relative to the directory of
+// the pipeline specification.
+func toAbsInputs(source string, spec *engine.Spec) *engine.Spec {
+	out := *spec
+	out.Steps = nil
+	for _, step := range spec.Steps {
+		clone := *step
+		clone.Inputs = nil
+		for _, input := range step.Inputs {
+			clone.Inputs = append(clone.Inputs, resolvePath(source, input))
+		}
+		out.Steps = append(out.Steps, &clone)
+	}
+	return &out
+}
+
+// helper function returns a copy of the specification in
+// which only the named steps are executed. Detached steps
+// are always executed, since dependent steps may require
+// the services they provide.
+func toSubset(spec *engine.Spec, names []string) *engine.Spec {
+	out := *spec
+	out.Steps = nil
+	for _, step := range spec.Steps {
+		if !step.Detach && !contains(names, step.Metadata.Name) {
+			clone := *step
+			clone.RunPolicy = engine.RunNever
+			step = &clone
+		}
+		out.Steps = append(out.Steps, step)
+	}
+	return &out
+}
+
+// helper function returns true if the slice contains the
+// string.
+func contains(s []string, v string) bool {
+	for _, item := range s {
+		if item == v {
+			return true
+		}
+	}
+	return false
+}
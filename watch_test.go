@@ -0,0 +1,159 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Drone Non-Commercial License
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/drone/drone-runtime/engine"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSnapshotRoots(t *testing.T) {
+	dir, err := ioutil.TempDir("", "drone-runtime")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ioutil.WriteFile(filepath.Join(dir, "main.go"), []byte("package main"), 0600)
+	os.Mkdir(filepath.Join(dir, ".git"), 0700)
+	ioutil.WriteFile(filepath.Join(dir, ".git", "HEAD"), []byte("ref"), 0600)
+
+	// sockets are not regular files, and are skipped when
+	// mounted as a host volume.
+	sock := filepath.Join(dir, "docker.sock")
+	l, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Skip(err)
+	}
+	defer l.Close()
+
+	w := &watcher{}
+	s := w.snapshotRoots([]string{dir, sock, filepath.Join(dir, "missing")}, nil)
+	if got, want := len(s), 1; got != want {
+		t.Errorf("Want %d files in snapshot, got %d", want, got)
+	}
+	if _, ok := s[filepath.Join(dir, "main.go")]; !ok {
+		t.Errorf("Want regular file in snapshot")
+	}
+}
+
+func TestSnapshotRootsLimit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "drone-runtime")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"a", "b", "c"} {
+		ioutil.WriteFile(filepath.Join(dir, name), []byte(name), 0600)
+	}
+
+	defer func(limit int) {
+		maxWatchFiles = limit
+	}(maxWatchFiles)
+	maxWatchFiles = 2
+
+	w := &watcher{}
+	s := w.snapshotRoots([]string{dir, filepath.Join(dir, "c")}, nil)
+	if got, want := len(s), 2; got != want {
+		t.Errorf("Want snapshot limited to %d files, got %d", want, got)
+	}
+	if !w.limited {
+		t.Errorf("Want watcher limit reported")
+	}
+}
+
+func TestSnapshotRootsExclude(t *testing.T) {
+	dir, err := ioutil.TempDir("", "drone-runtime")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	os.Mkdir(filepath.Join(dir, "dist"), 0700)
+	ioutil.WriteFile(filepath.Join(dir, "main.go"), []byte("package main"), 0600)
+	ioutil.WriteFile(filepath.Join(dir, "main.log"), []byte("log"), 0600)
+	ioutil.WriteFile(filepath.Join(dir, "dist", "app"), []byte("app"), 0600)
+	ioutil.WriteFile(filepath.Join(dir, "distribution"), []byte("txt"), 0600)
+
+	w := &watcher{}
+	exclude := []string{filepath.Join(dir, "dist"), filepath.Join(dir, "main.log")}
+	s := w.snapshotRoots([]string{dir}, exclude)
+	if got, want := len(s), 2; got != want {
+		t.Errorf("Want %d files in snapshot, got %d", want, got)
+	}
+	for _, name := range []string{"main.go", "distribution"} {
+		if _, ok := s[filepath.Join(dir, name)]; !ok {
+			t.Errorf("Want %s in snapshot", name)
+		}
+	}
+}
+
+func TestWatchSnapshot(t *testing.T) {
+	dir, err := ioutil.TempDir("", "drone-runtime")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	source := filepath.Join(dir, "pipeline.json")
+	ioutil.WriteFile(source, []byte("{}"), 0600)
+	os.Mkdir(filepath.Join(dir, "src"), 0700)
+	os.Mkdir(filepath.Join(dir, "src", "dist"), 0700)
+	ioutil.WriteFile(filepath.Join(dir, "src", "main.go"), []byte("package main"), 0600)
+	ioutil.WriteFile(filepath.Join(dir, "src", "dist", "app"), []byte("app"), 0600)
+
+	// the step inputs and excluded paths are relative to
+	// the pipeline specification, and not to the working
+	// directory.
+	spec := &engine.Spec{
+		Steps: []*engine.Step{
+			{Metadata: engine.Metadata{Name: "build"}, Inputs: []string{"src/*.go"}},
+			{Metadata: engine.Metadata{Name: "test"}, Inputs: []string{"src"}},
+		},
+	}
+	w := &watcher{source: source, exclude: []string{"src/dist"}}
+	s := w.snapshot(spec)
+	if got, want := len(s), 2; got != want {
+		t.Errorf("Want %d files in snapshot, got %d", want, got)
+	}
+	for _, path := range []string{source, filepath.Join(dir, "src", "main.go")} {
+		if _, ok := s[path]; !ok {
+			t.Errorf("Want %s in snapshot", path)
+		}
+	}
+
+	changed := []string{filepath.Join(dir, "src", "main.go")}
+	names := engine.Affected(toAbsInputs(source, spec), changed)
+	if diff := cmp.Diff([]string{"build", "test"}, names); diff != "" {
+		t.Errorf("Unexpected affected steps")
+		t.Log(diff)
+	}
+}
+
+func TestResolvePath(t *testing.T) {
+	source := filepath.FromSlash("/home/octocat/project/.drone.json")
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"src", "/home/octocat/project/src"},
+		{"src/*.go", "/home/octocat/project/src/*.go"},
+		{"../shared", "/home/octocat/shared"},
+		{"/var/cache/", "/var/cache"},
+	}
+	for _, test := range tests {
+		if got, want := resolvePath(source, test.path), filepath.FromSlash(test.want); got != want {
+			t.Errorf("Want path %q resolved to %q, got %q", test.path, want, got)
+		}
+	}
+}